@@ -25,9 +25,11 @@ package cache
 import (
 	"bytes"
 	"encoding/binary"
+	"strconv"
 	"time"
 	"unsafe"
 
+	"github.com/dustin/go-humanize"
 	"github.com/vicanso/pike/config"
 )
 
@@ -53,6 +55,14 @@ func readUint32ToInt(buffer *bytes.Buffer) (int, error) {
 	return int(value), nil
 }
 
+// readBytes read the bytes of size from buffer, ErrDataCorrupted is returned if the data is not enough
+func readBytes(buffer *bytes.Buffer, size int) ([]byte, error) {
+	if size < 0 || buffer.Len() < size {
+		return nil, ErrDataCorrupted
+	}
+	return buffer.Next(size), nil
+}
+
 // uint64ToBytes convert int64 to uint64 and covert to bytes
 func uint64ToBytes(value int64) []byte {
 	buf := make([]byte, 8)
@@ -82,15 +92,55 @@ func RemoveHTTPCache(name string, key []byte) {
 	defaultDispatchers.RemoveHTTPCache(name, key)
 }
 
+// Purge remove the http caches which match the filter from default dispatchers
+func Purge(name string, filter EntryFilter) (int, error) {
+	return defaultDispatchers.Purge(name, filter)
+}
+
+// PurgeTag remove the http caches which have the tag from default dispatchers
+func PurgeTag(name string, tag string) int {
+	return defaultDispatchers.PurgeTag(name, tag)
+}
+
 func convertConfigs(configs []config.CacheConfig) []DispatcherOption {
 	opts := make([]DispatcherOption, 0)
 	for _, item := range configs {
 		d, _ := time.ParseDuration(item.HitForPass)
+		staleWhileRevalidate, _ := time.ParseDuration(item.StaleWhileRevalidate)
+		staleIfError, _ := time.ParseDuration(item.StaleIfError)
+		maxBytes, _ := humanize.ParseBytes(item.MaxBytes)
+		maxObjectSize, _ := humanize.ParseBytes(item.MaxObjectSize)
+		waitTimeout, _ := time.ParseDuration(item.WaitTimeout)
+		var statusTTL map[int]int
+		if len(item.StatusTTL) != 0 {
+			statusTTL = make(map[int]int)
+			for key, value := range item.StatusTTL {
+				code, err := strconv.Atoi(key)
+				if err != nil {
+					continue
+				}
+				ttl, _ := time.ParseDuration(value)
+				statusTTL[code] = int(ttl.Seconds())
+			}
+		}
 		opts = append(opts, DispatcherOption{
-			Name:       item.Name,
-			Size:       item.Size,
-			HitForPass: int(d.Seconds()),
-			Store:      item.Store,
+			Name:                  item.Name,
+			Size:                  item.Size,
+			HitForPass:            int(d.Seconds()),
+			Store:                 item.Store,
+			StaleWhileRevalidate:  int(staleWhileRevalidate.Seconds()),
+			StaleIfError:          int(staleIfError.Seconds()),
+			MaxBytes:              int64(maxBytes),
+			MaxObjectSize:         int(maxObjectSize),
+			TagHeader:             item.TagHeader,
+			WaitTimeout:           waitTimeout,
+			PassOnWaitTimeout:     item.PassOnWaitTimeout,
+			SkipHitForPassOnError: item.SkipHitForPassOnError,
+			StatusTTL:             statusTTL,
+			HeuristicFreshness:    item.HeuristicFreshness,
+			InvalidateOnUnsafe:    item.InvalidateOnUnsafe,
+			PrefetchHits:          item.PrefetchHits,
+			PrefetchPercent:       item.PrefetchPercent,
 		})
 	}
 	return opts
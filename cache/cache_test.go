@@ -25,6 +25,7 @@ package cache
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vicanso/pike/config"
@@ -38,9 +39,24 @@ func TestConvertConfig(t *testing.T) {
 	hitForPass := 60
 	configs := []config.CacheConfig{
 		{
-			Name:       name,
-			Size:       size,
-			HitForPass: "1m",
+			Name:                  name,
+			Size:                  size,
+			HitForPass:            "1m",
+			StaleWhileRevalidate:  "10s",
+			StaleIfError:          "1h",
+			MaxBytes:              "1mb",
+			MaxObjectSize:         "10kb",
+			TagHeader:             "Surrogate-Key",
+			WaitTimeout:           "3s",
+			PassOnWaitTimeout:     true,
+			SkipHitForPassOnError: true,
+			InvalidateOnUnsafe:    true,
+			PrefetchHits:          10,
+			PrefetchPercent:       20,
+			StatusTTL: map[string]string{
+				"200": "0s",
+				"404": "30s",
+			},
 		},
 	}
 	opts := convertConfigs(configs)
@@ -48,6 +64,21 @@ func TestConvertConfig(t *testing.T) {
 	assert.Equal(name, opts[0].Name)
 	assert.Equal(size, opts[0].Size)
 	assert.Equal(hitForPass, opts[0].HitForPass)
+	assert.Equal(10, opts[0].StaleWhileRevalidate)
+	assert.Equal(3600, opts[0].StaleIfError)
+	assert.Equal(int64(1000*1000), opts[0].MaxBytes)
+	assert.Equal(10*1000, opts[0].MaxObjectSize)
+	assert.Equal("Surrogate-Key", opts[0].TagHeader)
+	assert.Equal(3*time.Second, opts[0].WaitTimeout)
+	assert.True(opts[0].PassOnWaitTimeout)
+	assert.True(opts[0].SkipHitForPassOnError)
+	assert.True(opts[0].InvalidateOnUnsafe)
+	assert.Equal(10, opts[0].PrefetchHits)
+	assert.Equal(20, opts[0].PrefetchPercent)
+	assert.Equal(map[int]int{
+		200: 0,
+		404: 30,
+	}, opts[0].StatusTTL)
 }
 
 func TestDefaultDispatcher(t *testing.T) {
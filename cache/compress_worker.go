@@ -0,0 +1,131 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 可缓存数据的压缩，缓存数据先以原始（或upstream压缩的）数据发布，
+// 由后台有限数量的worker使用best compression压缩后替换，避免压缩时阻塞缓存的读取
+
+package cache
+
+import (
+	"runtime"
+
+	"github.com/vicanso/pike/compress"
+	"github.com/vicanso/pike/log"
+	"go.uber.org/zap"
+)
+
+// defaultCompressQueueSize default size of compress job queue
+const defaultCompressQueueSize = 1024
+
+type (
+	// compressJob the job of compressing the response of http cache
+	compressJob struct {
+		hc   *httpCache
+		resp *HTTPResponse
+	}
+	// compressWorkers the bounded workers of compressing
+	compressWorkers struct {
+		jobs chan *compressJob
+	}
+)
+
+var defaultCompressWorkers = newCompressWorkers(runtime.NumCPU(), defaultCompressQueueSize)
+
+func newCompressWorkers(count, queueSize int) *compressWorkers {
+	w := &compressWorkers{
+		jobs: make(chan *compressJob, queueSize),
+	}
+	for i := 0; i < count; i++ {
+		go w.run()
+	}
+	return w
+}
+
+func (w *compressWorkers) run() {
+	for job := range w.jobs {
+		job.do()
+	}
+}
+
+// submit submits the job to queue, it returns false if the queue is full
+func (w *compressWorkers) submit(job *compressJob) bool {
+	select {
+	case w.jobs <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// do compresses a copy of response with best compression and swaps it into http cache
+func (job *compressJob) do() {
+	compressed := *job.resp
+	compressed.CompressSrv = compress.BestCompression
+	err := compressed.Compress()
+	if err != nil {
+		log.Default().Error("compress http response fail",
+			zap.String("key", string(job.hc.key)),
+			zap.Error(err),
+		)
+		job.hc.swapCompressed(job.resp, nil)
+		return
+	}
+	job.hc.swapCompressed(job.resp, &compressed)
+}
+
+// deferToHit defers the job to a later hit of http cache if the queue is full,
+// the uncompressed response is saved to store first
+func (job *compressJob) deferToHit() {
+	hc := job.hc
+	hc.mu.Lock()
+	// 缓存数据已更新，无需再压缩
+	if hc.status != StatusHit || hc.response != job.resp {
+		hc.mu.Unlock()
+		return
+	}
+	hc.compressDeferred = true
+	err := hc.saveToStore()
+	hc.mu.Unlock()
+	if err != nil {
+		log.Default().Error("save uncompressed cache to store fail",
+			zap.String("key", string(hc.key)),
+			zap.Error(err),
+		)
+	}
+}
+
+// dispatch dispatches the job to compress workers,
+// the job is deferred to a later hit if the queue is full
+func (w *compressWorkers) dispatch(job *compressJob) {
+	if job == nil {
+		return
+	}
+	// 队列已满时不在当前请求中压缩，避免阻塞请求
+	if !w.submit(job) {
+		job.deferToHit()
+	}
+}
+
+// dispatch dispatches the job to default compress workers
+func (job *compressJob) dispatch() {
+	defaultCompressWorkers.dispatch(job)
+}
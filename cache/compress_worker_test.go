@@ -0,0 +1,234 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/store"
+)
+
+type testCompressStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (s *testCompressStore) Get(key []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.data[string(key)]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return data, nil
+}
+
+func (s *testCompressStore) Set(key []byte, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[string(key)] = data
+	return nil
+}
+
+func (s *testCompressStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, string(key))
+	return nil
+}
+
+func (s *testCompressStore) Scan(prefix []byte, fn func(key []byte) bool) error {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		if strings.HasPrefix(key, string(prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	s.mu.Unlock()
+	for _, key := range keys {
+		if !fn([]byte(key)) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *testCompressStore) Close() error {
+	return nil
+}
+
+func newTestCompressResponse() *HTTPResponse {
+	return &HTTPResponse{
+		Header: http.Header{
+			"Content-Type": []string{"application/json"},
+		},
+		RawBody: bytes.Repeat([]byte(`{"name": "pike"}`), 200),
+	}
+}
+
+func TestCompressJob(t *testing.T) {
+	assert := assert.New(t)
+	s := &testCompressStore{
+		data: make(map[string][]byte),
+	}
+	key := []byte("GET test.com /compress")
+	hc := NewHTTPStoreCache(key, s)
+	resp := newTestCompressResponse()
+
+	hc.mu.Lock()
+	job := hc.cacheable(resp, CacheableOption{
+		TTL: 60,
+	})
+	hc.mu.Unlock()
+	assert.NotNil(job)
+	// 未压缩前直接发布原始数据，且不保存至store
+	status, data := hc.Get()
+	assert.Equal(StatusHit, status)
+	assert.Equal(resp, data)
+	_, err := s.Get(key)
+	assert.Equal(store.ErrNotFound, err)
+
+	job.do()
+	status, data = hc.Get()
+	assert.Equal(StatusHit, status)
+	assert.NotEqual(resp, data)
+	assert.NotEmpty(data.EncodedBodies["gzip"])
+	assert.NotEmpty(data.EncodedBodies["br"])
+	assert.Empty(data.RawBody)
+	// 原有的响应数据不修改
+	assert.Empty(resp.EncodedBodies["gzip"])
+	assert.NotEmpty(resp.RawBody)
+	_, err = s.Get(key)
+	assert.Nil(err)
+
+	// 已压缩的数据不再压缩
+	hc.mu.Lock()
+	assert.Nil(hc.cacheable(data, CacheableOption{
+		TTL: 60,
+	}))
+	hc.mu.Unlock()
+
+	// 缓存已更新时忽略压缩的数据
+	hc.mu.Lock()
+	job = hc.cacheable(newTestCompressResponse(), CacheableOption{
+		TTL: 60,
+	})
+	hc.mu.Unlock()
+	hc.HitForPass(60)
+	job.do()
+	status, data = hc.Get()
+	assert.Equal(StatusHitForPass, status)
+	assert.Nil(data)
+}
+
+func TestCompressWorkers(t *testing.T) {
+	assert := assert.New(t)
+	w := newCompressWorkers(0, 1)
+	assert.True(w.submit(&compressJob{}))
+	// 队列已满
+	assert.False(w.submit(&compressJob{}))
+
+	hc := NewHTTPCache()
+	resp := newTestCompressResponse()
+	hc.Cacheable(resp, 60)
+	// 由后台压缩后替换
+	for i := 0; i < 100; i++ {
+		hc.mu.RLock()
+		swapped := hc.response != resp
+		hc.mu.RUnlock()
+		if swapped {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, data := hc.Get()
+	assert.NotEqual(resp, data)
+	assert.NotEmpty(data.EncodedBodies["br"])
+}
+
+func TestCompressWorkersDeferToHit(t *testing.T) {
+	assert := assert.New(t)
+	s := &testCompressStore{
+		data: make(map[string][]byte),
+	}
+	key := []byte("GET test.com /compress-deferred")
+	hc := NewHTTPStoreCache(key, s)
+	resp := newTestCompressResponse()
+
+	hc.mu.Lock()
+	job := hc.cacheable(resp, CacheableOption{
+		TTL: 60,
+	})
+	hc.mu.Unlock()
+	assert.NotNil(job)
+
+	// 队列已满时不在当前goroutine压缩，以未压缩的数据保存至store
+	w := newCompressWorkers(0, 1)
+	assert.True(w.submit(&compressJob{}))
+	w.dispatch(job)
+	hc.mu.RLock()
+	assert.Equal(resp, hc.response)
+	assert.True(hc.compressDeferred)
+	hc.mu.RUnlock()
+	_, err := s.Get(key)
+	assert.Nil(err)
+
+	// 命中时再提交压缩任务
+	status, data := hc.Get()
+	assert.Equal(StatusHit, status)
+	assert.Equal(resp, data)
+	hc.mu.RLock()
+	assert.False(hc.compressDeferred)
+	hc.mu.RUnlock()
+	for i := 0; i < 100; i++ {
+		hc.mu.RLock()
+		swapped := hc.response != resp
+		hc.mu.RUnlock()
+		if swapped {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, data = hc.Get()
+	assert.NotEqual(resp, data)
+	assert.NotEmpty(data.EncodedBodies["br"])
+
+	// 缓存已更新时忽略延迟的压缩
+	hc.mu.Lock()
+	job = hc.cacheable(newTestCompressResponse(), CacheableOption{
+		TTL: 60,
+	})
+	hc.mu.Unlock()
+	hc.HitForPass(60)
+	w.dispatch(job)
+	hc.mu.RLock()
+	assert.False(hc.compressDeferred)
+	hc.mu.RUnlock()
+}
@@ -26,9 +26,10 @@
 package cache
 
 import (
+	"net/http"
 	"sync"
+	"time"
 
-	"github.com/golang/groupcache/lru"
 	"github.com/vicanso/pike/log"
 	"github.com/vicanso/pike/store"
 	"github.com/vicanso/pike/util"
@@ -38,18 +39,65 @@ import (
 // defaultZoneSize default zone size
 const defaultZoneSize = 128
 
+// maxEvictScanCount the max count of http caches(with data) to check from the oldest of lru when evicting
+const maxEvictScanCount = 16
+
 type (
 	// httpLRUCache http lru cache
 	httpLRUCache struct {
-		cache *lru.Cache
+		cache *lruCache
 		mu    *sync.Mutex
 	}
 	// dispatcher http cache dispatcher
 	dispatcher struct {
-		zoneSize   uint64
-		hitForPass int
-		list       []*httpLRUCache
-		store      store.Store
+		zoneSize uint64
+		list     []*httpLRUCache
+		store    store.Store
+
+		// optionMu 保护可通过配置更新的选项
+		optionMu             *sync.RWMutex
+		hitForPass           int
+		staleWhileRevalidate int
+		staleIfError         int
+
+		// maxBytes 缓存数据的最大字节数
+		maxBytes int64
+		// maxObjectSize 单个缓存数据的最大字节数
+		maxObjectSize int
+		// waitTimeout 等待fetching完成的最大时长
+		waitTimeout time.Duration
+		// passOnWaitTimeout 等待超时后是否转发至upstream
+		passOnWaitTimeout bool
+		// skipHitForPassOnError 出错的响应是否不设置hit for pass
+		skipHitForPassOnError bool
+		// statusTTL 可缓存的状态码及其默认缓存有效期
+		statusTTL map[int]int
+		// heuristicFreshness 是否使用启发式的缓存有效期
+		heuristicFreshness bool
+		// invalidateOnUnsafe 非安全请求成功后是否删除对应的缓存
+		invalidateOnUnsafe bool
+		// prefetchHits 预先更新缓存的最少命中次数
+		prefetchHits int
+		// prefetchPercent 在有效期的最后百分之几内预先更新缓存
+		prefetchPercent int
+		// tagHeader 缓存标签的响应头
+		tagHeader string
+
+		// sizeMu 保护bytes以及各httpCache的size与evicted
+		sizeMu *sync.Mutex
+		// bytes 当前缓存数据的字节数
+		bytes int64
+
+		// tagMu 保护tags与keyTags
+		tagMu *sync.Mutex
+		// tags 标签对应的缓存key
+		tags map[string]map[string]struct{}
+		// keyTags 缓存key对应的标签
+		keyTags map[string][]string
+		// storeTagsMu 保护storeTagsLoaded
+		storeTagsMu *sync.Mutex
+		// storeTagsLoaded store中缓存的标签是否已加载
+		storeTagsLoaded bool
 	}
 	// dispatchers http cache dispatchers
 	dispatchers struct {
@@ -61,12 +109,38 @@ type (
 		Size       int
 		HitForPass int
 		Store      string
+		// 默认的stale-while-revalidate时长(秒)
+		StaleWhileRevalidate int
+		// 默认的stale-if-error时长(秒)
+		StaleIfError int
+		// 缓存数据的最大字节数，0表示不限制
+		MaxBytes int64
+		// 单个缓存数据的最大字节数，0表示不限制
+		MaxObjectSize int
+		// 缓存标签的响应头，为空则不使用标签
+		TagHeader string
+		// 等待fetching完成的最大时长，0表示不限制
+		WaitTimeout time.Duration
+		// 等待超时后是否转发至upstream，否则返回出错
+		PassOnWaitTimeout bool
+		// 出错的响应（获取失败或状态码大于等于400）不设置hit for pass
+		SkipHitForPassOnError bool
+		// 可缓存的状态码及其默认缓存有效期(秒)，为空时除5xx外的状态码均可缓存
+		StatusTTL map[int]int
+		// 响应未设置缓存有效期时，根据Last-Modified计算启发式的缓存有效期
+		HeuristicFreshness bool
+		// 非安全请求成功后删除对应url（以及Location与Content-Location）的缓存
+		InvalidateOnUnsafe bool
+		// 命中次数达到该值的缓存在过期前预先更新，0表示不启用
+		PrefetchHits int
+		// 在有效期的最后百分之几内预先更新，默认为10
+		PrefetchPercent int
 	}
 )
 
 func newHTTPLRUCache(size int) *httpLRUCache {
 	c := &httpLRUCache{
-		cache: lru.New(size),
+		cache: newLRUCache(size),
 		mu:    &sync.Mutex{},
 	}
 	return c
@@ -74,24 +148,17 @@ func newHTTPLRUCache(size int) *httpLRUCache {
 
 // getCache get http cache by key
 func (lru *httpLRUCache) getCache(key []byte) (*httpCache, bool) {
-	value, ok := lru.cache.Get(byteSliceToString(key))
-	if !ok {
-		return nil, false
-	}
-	if hc, ok := value.(*httpCache); ok {
-		return hc, true
-	}
-	return nil, false
+	return lru.cache.get(byteSliceToString(key))
 }
 
 // addCache add http cache by key
 func (lru *httpLRUCache) addCache(key []byte, hc *httpCache) {
-	lru.cache.Add(byteSliceToString(key), hc)
+	lru.cache.add(byteSliceToString(key), hc)
 }
 
 // removeCache remove http cache by key
 func (lru *httpLRUCache) removeCache(key []byte) {
-	lru.cache.Remove(byteSliceToString(key))
+	lru.cache.remove(byteSliceToString(key))
 }
 
 // NewDispatcher new a http cache dispatcher
@@ -110,13 +177,24 @@ func NewDispatcher(option DispatcherOption) *dispatcher {
 	lruSize := size / zoneSize
 	list := make([]*httpLRUCache, zoneSize)
 	// 根据zone size生成一个缓存对列
+	disp := &dispatcher{
+		zoneSize: uint64(zoneSize),
+		list:     list,
+		optionMu: &sync.RWMutex{},
+		sizeMu:   &sync.Mutex{},
+		tagMu:    &sync.Mutex{},
+		tags:     make(map[string]map[string]struct{}),
+		keyTags:  make(map[string][]string),
+
+		storeTagsMu: &sync.Mutex{},
+	}
+	disp.setOption(option)
 	for i := 0; i < zoneSize; i++ {
 		list[i] = newHTTPLRUCache(lruSize)
-	}
-	disp := &dispatcher{
-		zoneSize:   uint64(zoneSize),
-		list:       list,
-		hitForPass: option.HitForPass,
+		// 淘汰时（包括删除）减去该缓存的数据大小
+		list[i].cache.onEvicted = func(_ string, hc *httpCache) {
+			disp.onEvicted(hc)
+		}
 	}
 	// 如果有配置store
 	if option.Store != "" {
@@ -134,6 +212,29 @@ func NewDispatcher(option DispatcherOption) *dispatcher {
 	return disp
 }
 
+// setOption set the option of dispatcher, the size and store are not changed
+func (d *dispatcher) setOption(option DispatcherOption) {
+	d.optionMu.Lock()
+	defer d.optionMu.Unlock()
+	d.hitForPass = option.HitForPass
+	d.staleWhileRevalidate = option.StaleWhileRevalidate
+	d.staleIfError = option.StaleIfError
+	d.maxBytes = option.MaxBytes
+	d.maxObjectSize = option.MaxObjectSize
+	d.waitTimeout = option.WaitTimeout
+	d.passOnWaitTimeout = option.PassOnWaitTimeout
+	d.skipHitForPassOnError = option.SkipHitForPassOnError
+	d.statusTTL = option.StatusTTL
+	d.heuristicFreshness = option.HeuristicFreshness
+	d.invalidateOnUnsafe = option.InvalidateOnUnsafe
+	d.prefetchHits = option.PrefetchHits
+	d.prefetchPercent = option.PrefetchPercent
+	if d.prefetchPercent <= 0 || d.prefetchPercent >= 100 {
+		d.prefetchPercent = defaultPrefetchPercent
+	}
+	d.tagHeader = http.CanonicalHeaderKey(option.TagHeader)
+}
+
 func (d *dispatcher) getLRU(key []byte) *httpLRUCache {
 	// 计算hash值
 	index := MemHash(key) % d.zoneSize
@@ -151,37 +252,228 @@ func (d *dispatcher) GetHTTPCache(key []byte) *httpCache {
 	if ok {
 		return hc
 	}
-	if d.store != nil {
-		hc = NewHTTPStoreCache(key, d.store)
-	} else {
-		hc = NewHTTPCache()
-	}
+	// store为nil时则不会保存至store，key用于生成vary的缓存key
+	hc = NewHTTPStoreCache(key, d.store)
+	hc.disp = d
 	lru.addCache(key, hc)
 	return hc
 }
 
 // RemoveHTTPCache remove http cache
 func (d *dispatcher) RemoveHTTPCache(key []byte) {
+	d.removeHTTPCache(key, false)
+}
+
+// removeHTTPCache remove http cache, it returns true if the http cache is removed from lru or store,
+// the store is checked only if checkStore is true
+func (d *dispatcher) removeHTTPCache(key []byte, checkStore bool) bool {
 	lru := d.getLRU(key)
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
+	_, removed := lru.cache.peek(byteSliceToString(key))
 	lru.removeCache(key)
-	if d.store != nil {
-		err := d.store.Delete(key)
-		if err != nil {
-			log.Default().Error("delete from store fail",
-				zap.String("key", string(key)),
-				zap.Error(err),
-			)
-		}
+	d.removeTags(string(key))
+	if d.store == nil {
+		return removed
 	}
+	// 不在lru中的缓存，判断store中是否有该数据
+	if !removed && checkStore {
+		_, err := d.store.Get(key)
+		removed = err == nil
+	}
+	err := d.store.Delete(key)
+	if err != nil {
+		log.Default().Error("delete from store fail",
+			zap.String("key", string(key)),
+			zap.Error(err),
+		)
+	}
+	return removed
 }
 
 // GetHitForPass get hit for pass
 func (d *dispatcher) GetHitForPass() int {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
 	return d.hitForPass
 }
 
+// setSize set the size of http cache
+func (d *dispatcher) setSize(hc *httpCache, size int64) {
+	d.sizeMu.Lock()
+	defer d.sizeMu.Unlock()
+	// 已淘汰的缓存不再统计
+	if hc.evicted {
+		return
+	}
+	d.bytes += size - hc.size
+	hc.size = size
+}
+
+// onEvicted remove the size of evicted http cache
+func (d *dispatcher) onEvicted(hc *httpCache) {
+	d.sizeMu.Lock()
+	defer d.sizeMu.Unlock()
+	d.bytes -= hc.size
+	hc.size = 0
+	hc.evicted = true
+	// 有store时数据仍保存在store中，保留标签索引
+	if d.store == nil {
+		d.removeTags(string(hc.key))
+	}
+}
+
+// GetBytes get the bytes of all http cache
+func (d *dispatcher) GetBytes() int64 {
+	d.sizeMu.Lock()
+	defer d.sizeMu.Unlock()
+	return d.bytes
+}
+
+// isEmpty check the http cache has no data(such as hit for pass),
+// it is skipped when evicting because evicting it does not release any bytes
+func (d *dispatcher) isEmpty(hc *httpCache) bool {
+	d.sizeMu.Lock()
+	defer d.sizeMu.Unlock()
+	return hc.size <= 0
+}
+
+// isEvictable check the http cache can be evicted,
+// the fetching http cache(has waiting requests) is not evictable
+func (d *dispatcher) isEvictable(hc *httpCache) bool {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	return hc.status != StatusFetching
+}
+
+// evict remove the least recently used http cache of all lru until the bytes is less than max bytes
+func (d *dispatcher) evict() {
+	d.optionMu.RLock()
+	maxBytes := d.maxBytes
+	d.optionMu.RUnlock()
+	if maxBytes <= 0 {
+		return
+	}
+	for d.GetBytes() > maxBytes {
+		// 从各lru中选择最久未访问的缓存
+		var target *httpLRUCache
+		var targetEntry lruEntry
+		for _, lru := range d.list {
+			lru.mu.Lock()
+			entry, ok := lru.cache.oldest(maxEvictScanCount, d.isEmpty, d.isEvictable)
+			lru.mu.Unlock()
+			if ok && (target == nil || entry.accessedAt < targetEntry.accessedAt) {
+				target = lru
+				targetEntry = entry
+			}
+		}
+		// 无可淘汰的缓存
+		if target == nil {
+			return
+		}
+		target.mu.Lock()
+		// 选择期间有可能已被访问或删除，则重新选择
+		entry, ok := target.cache.peek(targetEntry.key)
+		if ok &&
+			entry.hc == targetEntry.hc &&
+			entry.accessedAt == targetEntry.accessedAt {
+			target.cache.remove(entry.key)
+		}
+		target.mu.Unlock()
+	}
+}
+
+// IsOversize check the response is bigger than max object size
+func (d *dispatcher) IsOversize(resp *HTTPResponse) bool {
+	d.optionMu.RLock()
+	maxObjectSize := d.maxObjectSize
+	d.optionMu.RUnlock()
+	if maxObjectSize <= 0 || resp == nil {
+		return false
+	}
+	return resp.Size() > maxObjectSize
+}
+
+// ShouldPassOnWaitTimeout check the request should be passed to upstream if waiting for fetching timeout
+func (d *dispatcher) ShouldPassOnWaitTimeout() bool {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.passOnWaitTimeout
+}
+
+// ShouldSkipHitForPassOnError check the error response should not set hit for pass
+func (d *dispatcher) ShouldSkipHitForPassOnError() bool {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.skipHitForPassOnError
+}
+
+// IsCacheableStatus check the status code of response is cacheable,
+// the response of 5xx is never cacheable
+func (d *dispatcher) IsCacheableStatus(statusCode int) bool {
+	if statusCode >= http.StatusInternalServerError {
+		return false
+	}
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	if len(d.statusTTL) == 0 {
+		return true
+	}
+	_, ok := d.statusTTL[statusCode]
+	return ok
+}
+
+// GetStatusTTL get the default ttl of status code
+func (d *dispatcher) GetStatusTTL(statusCode int) int {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.statusTTL[statusCode]
+}
+
+// ShouldUseHeuristicFreshness check the heuristic freshness should be used
+// if the response has no explicit expiration time
+func (d *dispatcher) ShouldUseHeuristicFreshness() bool {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.heuristicFreshness
+}
+
+// ShouldInvalidateOnUnsafe check the http caches of the url should be removed
+// after the unsafe request is successful
+func (d *dispatcher) ShouldInvalidateOnUnsafe() bool {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.invalidateOnUnsafe
+}
+
+// GetStale get the default stale-while-revalidate and stale-if-error
+func (d *dispatcher) GetStale() (whileRevalidate, ifError int) {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.staleWhileRevalidate, d.staleIfError
+}
+
+// getWaitTimeout get the max duration of waiting for fetching
+func (d *dispatcher) getWaitTimeout() time.Duration {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.waitTimeout
+}
+
+// getPrefetch get the min hits and the percent of ttl for prefetching
+func (d *dispatcher) getPrefetch() (hits, percent int) {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.prefetchHits, d.prefetchPercent
+}
+
+// getTagHeader get the header of cache tags
+func (d *dispatcher) getTagHeader() string {
+	d.optionMu.RLock()
+	defer d.optionMu.RUnlock()
+	return d.tagHeader
+}
+
 // NewDispatchers new dispatchers
 func NewDispatchers(opts []DispatcherOption) *dispatchers {
 	ds := &dispatchers{
@@ -226,7 +518,56 @@ func (ds *dispatchers) RemoveHTTPCache(name string, key []byte) {
 	})
 }
 
-// Reset reset the dispatchers, remove not exists dispatchers and create new dispatcher. If the dispatcher is exists, then use the old one.
+// PurgeTag remove the http caches which have the tag
+func (ds *dispatchers) PurgeTag(name string, tag string) int {
+	if name != "" {
+		d := ds.Get(name)
+		if d == nil {
+			return 0
+		}
+		return d.PurgeTag(tag)
+	}
+	// 如果未指定名称，则从所有缓存中删除
+	count := 0
+	ds.m.Range(func(_, v interface{}) bool {
+		d, ok := v.(*dispatcher)
+		if ok {
+			count += d.PurgeTag(tag)
+		}
+		return true
+	})
+	return count
+}
+
+// Purge remove the http caches which match the filter
+func (ds *dispatchers) Purge(name string, filter EntryFilter) (int, error) {
+	if name != "" {
+		d := ds.Get(name)
+		if d == nil {
+			return 0, nil
+		}
+		return d.Purge(filter)
+	}
+	// 如果未指定名称，则从所有缓存中删除
+	count := 0
+	var err error
+	ds.m.Range(func(_, v interface{}) bool {
+		d, ok := v.(*dispatcher)
+		if !ok {
+			return true
+		}
+		n, e := d.Purge(filter)
+		count += n
+		if e != nil {
+			err = e
+		}
+		return true
+	})
+	return count, err
+}
+
+// Reset reset the dispatchers, remove not exists dispatchers and create new dispatcher.
+// If the dispatcher is exists, the option is applied to it except the size and store.
 func (ds *dispatchers) Reset(opts []DispatcherOption) {
 	// 删除不再使用的dispatcher
 	_ = util.MapDelete(ds.m, func(key string) bool {
@@ -242,11 +583,15 @@ func (ds *dispatchers) Reset(opts []DispatcherOption) {
 	})
 
 	for _, opt := range opts {
-		_, ok := ds.m.Load(opt.Name)
 		// 如果当前dispatcher不存在，则创建
-		// 如果存在，对原来的size不调整
-		if !ok {
+		d := ds.Get(opt.Name)
+		if d == nil {
 			ds.m.Store(opt.Name, NewDispatcher(opt))
+			continue
 		}
+		// 如果存在，对原来的size与store不调整，其它选项则更新
+		d.setOption(opt)
+		// 最大字节数有可能调小，需要淘汰缓存
+		d.evict()
 	}
 }
@@ -23,7 +23,9 @@
 package cache
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -36,13 +38,8 @@ func TestLRUGetCache(t *testing.T) {
 	assert.False(ok)
 	assert.Nil(c)
 
-	httpLRU.cache.Add(string(key), "abc")
-	c, ok = httpLRU.getCache(key)
-	assert.False(ok)
-	assert.Nil(c)
-
 	hc := &httpCache{}
-	httpLRU.cache.Add(string(key), hc)
+	httpLRU.addCache(key, hc)
 	c, ok = httpLRU.getCache(key)
 	assert.True(ok)
 	assert.Equal(hc, c)
@@ -67,6 +64,119 @@ func TestDispatcher(t *testing.T) {
 	assert.Empty(hc.createdAt)
 }
 
+func TestDispatcherMaxBytes(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDispatcher(DispatcherOption{
+		Size:          100,
+		MaxBytes:      25,
+		MaxObjectSize: 20,
+	})
+	newResp := func(size int) *HTTPResponse {
+		return &HTTPResponse{
+			RawBody: make([]byte, size),
+		}
+	}
+	assert.False(d.IsOversize(newResp(20)))
+	assert.True(d.IsOversize(newResp(21)))
+
+	hc1 := d.GetHTTPCache([]byte("key1"))
+	hc1.Cacheable(newResp(10), 60)
+	assert.Equal(int64(10), d.GetBytes())
+
+	hc2 := d.GetHTTPCache([]byte("key2"))
+	hc2.Cacheable(newResp(10), 60)
+	assert.Equal(int64(20), d.GetBytes())
+
+	// 设置为hit for pass后，数据大小为0
+	hc2.HitForPass(60)
+	assert.Equal(int64(10), d.GetBytes())
+	hc2.Cacheable(newResp(10), 60)
+	assert.Equal(int64(20), d.GetBytes())
+
+	// 超出限制，淘汰缓存
+	hc3 := d.GetHTTPCache([]byte("key3"))
+	hc3.Cacheable(newResp(10), 60)
+	assert.LessOrEqual(d.GetBytes(), int64(25))
+	assert.True(hc1.evicted || hc2.evicted || hc3.evicted)
+
+	// 已淘汰的缓存不再统计
+	bytes := d.GetBytes()
+	for _, hc := range []*httpCache{hc1, hc2, hc3} {
+		if hc.evicted {
+			hc.Cacheable(newResp(10), 60)
+		}
+	}
+	assert.Equal(bytes, d.GetBytes())
+
+	// 删除缓存
+	d.RemoveHTTPCache([]byte("key1"))
+	d.RemoveHTTPCache([]byte("key2"))
+	d.RemoveHTTPCache([]byte("key3"))
+	assert.Equal(int64(0), d.GetBytes())
+}
+
+func TestDispatcherEvict(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDispatcher(DispatcherOption{
+		Size:     100,
+		MaxBytes: 25,
+	})
+	newResp := func(size int) *HTTPResponse {
+		return &HTTPResponse{
+			RawBody: make([]byte, size),
+		}
+	}
+	hc1 := d.GetHTTPCache([]byte("key1"))
+	hc1.Cacheable(newResp(10), 60)
+	hc2 := d.GetHTTPCache([]byte("key2"))
+	hc2.Cacheable(newResp(10), 60)
+	// 无数据的缓存
+	d.GetHTTPCache([]byte("key0"))
+
+	// 过期后fetching的缓存有等待的请求，不淘汰
+	hc1.expiredAt = nowUnix() - 1
+	status, _ := hc1.Get()
+	assert.Equal(StatusFetching, status)
+	// 访问后更新为最近使用
+	assert.Equal(hc2, d.GetHTTPCache([]byte("key2")))
+
+	hc3 := d.GetHTTPCache([]byte("key3"))
+	hc3.Cacheable(newResp(10), 60)
+	assert.Equal(int64(20), d.GetBytes())
+	assert.False(hc1.evicted)
+	assert.True(hc2.evicted)
+	assert.False(hc3.evicted)
+
+	// 其它缓存均为fetching，只能淘汰新的缓存
+	hc3.expiredAt = nowUnix() - 1
+	status, _ = hc3.Get()
+	assert.Equal(StatusFetching, status)
+	hc4 := d.GetHTTPCache([]byte("key4"))
+	hc4.Cacheable(newResp(10), 60)
+	assert.True(hc4.evicted)
+	assert.Equal(int64(20), d.GetBytes())
+}
+
+func TestDispatcherEvictSkipEmpty(t *testing.T) {
+	assert := assert.New(t)
+	maxBytes := int64(100)
+	d := NewDispatcher(DispatcherOption{
+		MaxBytes: maxBytes,
+	})
+	// 大量hit for pass的缓存（无数据）占据各lru最旧的位置
+	for i := 0; i < 5000; i++ {
+		d.GetHTTPCache([]byte(fmt.Sprintf("hit-for-pass-%d", i))).HitForPass(60)
+	}
+	for i := 0; i < 5; i++ {
+		hc := d.GetHTTPCache([]byte(fmt.Sprintf("key%d", i)))
+		hc.Cacheable(&HTTPResponse{
+			RawBody: make([]byte, 80),
+		}, 60)
+		assert.LessOrEqual(d.GetBytes(), maxBytes)
+	}
+	assert.Equal(int64(80), d.GetBytes())
+}
+
 func TestDispatchers(t *testing.T) {
 	assert := assert.New(t)
 	name1 := "test1"
@@ -88,15 +198,62 @@ func TestDispatchers(t *testing.T) {
 	assert.Nil(ds.Get(name1))
 	assert.NotNil(ds.Get(name2))
 
-	// 再次reset
+	// 再次reset，使用原有的dispatcher并更新选项
+	disp := ds.Get(name2)
 	ds.Reset([]DispatcherOption{
 		{
-			Name: name2,
-			Size: 100,
+			Name:                 name2,
+			Size:                 200,
+			HitForPass:           30,
+			StaleWhileRevalidate: 10,
+			StaleIfError:         20,
+			MaxObjectSize:        10,
+			WaitTimeout:          time.Second,
+			PassOnWaitTimeout:    true,
+			StatusTTL: map[int]int{
+				200: 60,
+			},
+			HeuristicFreshness: true,
+			InvalidateOnUnsafe: true,
+			PrefetchHits:       5,
+			PrefetchPercent:    20,
+			TagHeader:          "surrogate-key",
 		},
 	})
 	assert.Nil(ds.Get(name1))
-	assert.NotNil(ds.Get(name2))
+	assert.Equal(disp, ds.Get(name2))
+	assert.Equal(30, disp.GetHitForPass())
+	whileRevalidate, ifError := disp.GetStale()
+	assert.Equal(10, whileRevalidate)
+	assert.Equal(20, ifError)
+	assert.True(disp.IsOversize(&HTTPResponse{
+		RawBody: make([]byte, 11),
+	}))
+	assert.Equal(time.Second, disp.getWaitTimeout())
+	assert.True(disp.ShouldPassOnWaitTimeout())
+	assert.Equal(60, disp.GetStatusTTL(200))
+	assert.False(disp.IsCacheableStatus(404))
+	assert.True(disp.ShouldUseHeuristicFreshness())
+	assert.True(disp.ShouldInvalidateOnUnsafe())
+	hits, percent := disp.getPrefetch()
+	assert.Equal(5, hits)
+	assert.Equal(20, percent)
+	assert.Equal("Surrogate-Key", disp.getTagHeader())
+
+	// 调小最大字节数时淘汰缓存
+	disp.GetHTTPCache([]byte("GET test.com /max-bytes")).Cacheable(&HTTPResponse{
+		StatusCode: 200,
+		RawBody:    make([]byte, 10),
+	}, 60)
+	assert.Equal(int64(10), disp.GetBytes())
+	ds.Reset([]DispatcherOption{
+		{
+			Name:     name2,
+			MaxBytes: 5,
+		},
+	})
+	assert.Equal(int64(0), disp.GetBytes())
+	assert.Equal(0, disp.GetHitForPass())
 
 	key := []byte("abc")
 	hc := ds.Get(name2).GetHTTPCache(key)
@@ -107,4 +264,58 @@ func TestDispatchers(t *testing.T) {
 	hc1 := ds.Get(name2).GetHTTPCache(key)
 	assert.Empty(hc1.createdAt)
 
+	ds.Get(name2).GetHTTPCache([]byte("GET test.com /users/me"))
+	count, err := ds.Purge("", EntryFilter{
+		Host: "test.com",
+	})
+	assert.Nil(err)
+	assert.Equal(1, count)
+	count, err = ds.Purge(name1, EntryFilter{
+		Host: "test.com",
+	})
+	assert.Nil(err)
+	assert.Equal(0, count)
+}
+
+func TestDispatcherStatusTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	// 未配置时，5xx之外均可缓存
+	disp := NewDispatcher(DispatcherOption{
+		Size: 100,
+	})
+	assert.True(disp.IsCacheableStatus(200))
+	assert.True(disp.IsCacheableStatus(404))
+	assert.False(disp.IsCacheableStatus(500))
+	assert.Equal(0, disp.GetStatusTTL(404))
+
+	disp = NewDispatcher(DispatcherOption{
+		Size: 100,
+		StatusTTL: map[int]int{
+			200: 0,
+			404: 30,
+			500: 10,
+		},
+	})
+	assert.True(disp.IsCacheableStatus(200))
+	assert.True(disp.IsCacheableStatus(404))
+	assert.False(disp.IsCacheableStatus(403))
+	assert.False(disp.IsCacheableStatus(500))
+	assert.Equal(30, disp.GetStatusTTL(404))
+
+	// 不可缓存的状态码设置为hit for pass
+	hc := disp.GetHTTPCache([]byte("GET test.com /status-ttl"))
+	hc.Cacheable(&HTTPResponse{
+		StatusCode: 403,
+	}, 60)
+	assert.Equal(StatusHitForPass, hc.GetStatus())
+	assert.False(hc.PromoteHitForPass(&HTTPResponse{
+		StatusCode: 403,
+	}, CacheableOption{
+		TTL: 60,
+	}))
+	hc.Cacheable(&HTTPResponse{
+		StatusCode: 404,
+	}, 60)
+	assert.Equal(StatusHit, hc.GetStatus())
 }
@@ -0,0 +1,326 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 缓存的查询与清除，按条件从lru或store中获取缓存的信息或删除缓存，
+// 从lru获取时每个lru只在复制缓存列表时加锁，避免长时间影响缓存的读写
+
+package cache
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// defaultEntryLimit default limit of entries
+const defaultEntryLimit = 100
+
+// ErrStoreIsNil the store of dispatcher is nil
+var ErrStoreIsNil = errors.New("store is nil")
+
+type (
+	// Entry the info of http cache
+	Entry struct {
+		Key string `json:"key,omitempty"`
+		// Variant vary缓存对应的请求头的值（url编码），key为其原始的key
+		Variant string `json:"variant,omitempty"`
+		Status  string `json:"status,omitempty"`
+		// Age 缓存已创建的时长(秒)，未设置时为0
+		Age int `json:"age"`
+		// TTL 缓存剩余的有效期(秒)，小于0表示已过期，未设置时为0
+		TTL     int `json:"ttl"`
+		RawSize int `json:"rawSize"`
+		// EncodedSizes 各编码压缩数据的大小
+		EncodedSizes map[string]int `json:"encodedSizes,omitempty"`
+		Vary         []string       `json:"vary,omitempty"`
+		Tags         []string       `json:"tags,omitempty"`
+	}
+	// Entries the entries of http cache
+	Entries struct {
+		// Total 符合条件的缓存总数
+		Total   int      `json:"total"`
+		Entries []*Entry `json:"entries"`
+	}
+	// EntryFilter the filter of entries
+	EntryFilter struct {
+		// Host 请求的host
+		Host string
+		// Prefix 请求url的前缀
+		Prefix string
+		// Regexp 请求url的正则匹配
+		Regexp *regexp.Regexp
+		// Status 缓存状态，StatusUnknown表示不限制
+		Status Status
+		Offset int
+		Limit  int
+	}
+)
+
+// ParseStatus parse status from string
+func ParseStatus(value string) Status {
+	for _, status := range []Status{
+		StatusFetching,
+		StatusHitForPass,
+		StatusHit,
+		StatusPassed,
+		StatusStale,
+	} {
+		if status.String() == value {
+			return status
+		}
+	}
+	return StatusUnknown
+}
+
+// splitVaryKey split the vary key of http cache to the base key and the vary values,
+// the vary key is generated as "method host uri createdAt:values"(see GetVaryKey)
+func splitVaryKey(key string) (base, values string) {
+	arr := strings.SplitN(key, " ", 4)
+	if len(arr) != 4 {
+		return key, ""
+	}
+	index := strings.Index(arr[3], ":")
+	if index <= 0 {
+		return key, ""
+	}
+	if _, err := strconv.ParseInt(arr[3][:index], 10, 64); err != nil {
+		return key, ""
+	}
+	return key[:len(key)-len(arr[3])-1], arr[3][index+1:]
+}
+
+// splitKey split the key of http cache to method, host and uri,
+// the vary values of vary key are removed
+func splitKey(key string) (method, host, uri string) {
+	key, _ = splitVaryKey(key)
+	arr := strings.SplitN(key, " ", 3)
+	switch len(arr) {
+	case 3:
+		return arr[0], arr[1], arr[2]
+	case 2:
+		return arr[0], arr[1], ""
+	default:
+		return arr[0], "", ""
+	}
+}
+
+// matchKey check the key matches the filter, the vary key is matched by its base key,
+// so the vary caches are matched(and purged) with the base key
+func (f *EntryFilter) matchKey(key string) bool {
+	_, host, uri := splitKey(key)
+	if f.Host != "" && f.Host != host {
+		return false
+	}
+	if f.Prefix != "" && !strings.HasPrefix(uri, f.Prefix) {
+		return false
+	}
+	if f.Regexp != nil && !f.Regexp.MatchString(uri) {
+		return false
+	}
+	return true
+}
+
+// matchEntry check the entry matches the filter
+func (f *EntryFilter) matchEntry(entry *Entry) bool {
+	if f.Status == StatusUnknown {
+		return true
+	}
+	return entry.Status == f.Status.String()
+}
+
+func (f *EntryFilter) getLimit() int {
+	if f.Limit <= 0 {
+		return defaultEntryLimit
+	}
+	return f.Limit
+}
+
+// getStorePrefixes get the prefixes of store to scan
+func (f *EntryFilter) getStorePrefixes() [][]byte {
+	if f.Host == "" {
+		return [][]byte{
+			nil,
+		}
+	}
+	// 只有GET与HEAD的请求可缓存
+	return [][]byte{
+		[]byte("GET " + f.Host + " " + f.Prefix),
+		[]byte("HEAD " + f.Host + " " + f.Prefix),
+	}
+}
+
+// add add the entry to entries if it's in the page of filter
+func (entries *Entries) add(f *EntryFilter, entry *Entry) {
+	entries.Total++
+	if entries.Total > f.Offset && len(entries.Entries) < f.getLimit() {
+		entries.Entries = append(entries.Entries, entry)
+	}
+}
+
+// entry get the entry of http cache
+func (hc *httpCache) entry(now int64) *Entry {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	key, variant := splitVaryKey(string(hc.key))
+	entry := &Entry{
+		Key:     key,
+		Variant: variant,
+		Status:  hc.status.String(),
+	}
+	// 未设置时间的缓存（如首次fetching）则为0
+	if hc.createdAt != 0 {
+		entry.Age = int(now - hc.createdAt)
+	}
+	if hc.expiredAt != 0 {
+		entry.TTL = int(hc.expiredAt - now)
+	}
+	if hc.response != nil {
+		entry.RawSize = len(hc.response.RawBody)
+		if len(hc.response.EncodedBodies) != 0 {
+			entry.EncodedSizes = make(map[string]int, len(hc.response.EncodedBodies))
+			for encoding, body := range hc.response.EncodedBodies {
+				entry.EncodedSizes[encoding] = len(body)
+			}
+		}
+	}
+	if len(hc.vary) != 0 {
+		entry.Vary = append([]string{}, hc.vary...)
+	}
+	if len(hc.tags) != 0 {
+		entry.Tags = append([]string{}, hc.tags...)
+	}
+	return entry
+}
+
+// GetEntries get the entries of lru which match the filter
+func (d *dispatcher) GetEntries(filter EntryFilter) *Entries {
+	entries := &Entries{
+		Entries: make([]*Entry, 0),
+	}
+	now := nowUnix()
+	for _, lru := range d.list {
+		// 只在复制列表时加锁
+		lru.mu.Lock()
+		values := lru.cache.values()
+		lru.mu.Unlock()
+		for _, hc := range values {
+			if !filter.matchKey(byteSliceToString(hc.key)) {
+				continue
+			}
+			entry := hc.entry(now)
+			if !filter.matchEntry(entry) {
+				continue
+			}
+			entries.add(&filter, entry)
+		}
+	}
+	return entries
+}
+
+// ScanEntries scan the entries of store which match the filter
+func (d *dispatcher) ScanEntries(filter EntryFilter) (*Entries, error) {
+	if d.store == nil {
+		return nil, ErrStoreIsNil
+	}
+	keys := make([][]byte, 0)
+	for _, prefix := range filter.getStorePrefixes() {
+		err := d.store.Scan(prefix, func(key []byte) bool {
+			if filter.matchKey(byteSliceToString(key)) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := &Entries{
+		Entries: make([]*Entry, 0),
+	}
+	now := nowUnix()
+	for _, key := range keys {
+		hc := NewHTTPStoreCache(key, d.store)
+		// 有可能数据已过期删除，忽略出错的数据（不计入总数）
+		if err := hc.initFromStore(); err != nil {
+			continue
+		}
+		entry := hc.entry(now)
+		if !filter.matchEntry(entry) {
+			continue
+		}
+		entries.add(&filter, entry)
+	}
+	return entries, nil
+}
+
+// getKeys get the keys of lru and store which match the filter(only host, prefix and regexp are used)
+func (d *dispatcher) getKeys(filter EntryFilter) ([][]byte, error) {
+	keys := make([][]byte, 0)
+	exists := make(map[string]struct{})
+	add := func(key []byte) {
+		k := string(key)
+		if _, ok := exists[k]; ok {
+			return
+		}
+		exists[k] = struct{}{}
+		keys = append(keys, key)
+	}
+	for _, lru := range d.list {
+		lru.mu.Lock()
+		values := lru.cache.values()
+		lru.mu.Unlock()
+		for _, hc := range values {
+			if filter.matchKey(byteSliceToString(hc.key)) {
+				add(hc.key)
+			}
+		}
+	}
+	if d.store == nil {
+		return keys, nil
+	}
+	for _, prefix := range filter.getStorePrefixes() {
+		err := d.store.Scan(prefix, func(key []byte) bool {
+			if filter.matchKey(byteSliceToString(key)) {
+				add(key)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// Purge remove the http caches of lru and store which match the filter, it returns the count of removed caches
+func (d *dispatcher) Purge(filter EntryFilter) (int, error) {
+	keys, err := d.getKeys(filter)
+	if err != nil {
+		return 0, err
+	}
+	for _, key := range keys {
+		d.RemoveHTTPCache(key)
+	}
+	return len(keys), nil
+}
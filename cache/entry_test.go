@@ -0,0 +1,315 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cache
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatus(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(StatusHit, ParseStatus("hit"))
+	assert.Equal(StatusHitForPass, ParseStatus("hitForPass"))
+	assert.Equal(StatusUnknown, ParseStatus("abc"))
+}
+
+func TestEntryFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		filter EntryFilter
+		key    string
+		result bool
+	}{
+		{
+			filter: EntryFilter{},
+			key:    "GET test.com /users/me",
+			result: true,
+		},
+		{
+			filter: EntryFilter{
+				Host: "test.com",
+			},
+			key:    "GET test.com /users/me",
+			result: true,
+		},
+		{
+			filter: EntryFilter{
+				Host: "test.com",
+			},
+			key:    "GET example.com /users/me",
+			result: false,
+		},
+		{
+			filter: EntryFilter{
+				Prefix: "/users/",
+			},
+			key:    "GET test.com /users/me",
+			result: true,
+		},
+		{
+			filter: EntryFilter{
+				Prefix: "/books/",
+			},
+			key:    "GET test.com /users/me",
+			result: false,
+		},
+		{
+			filter: EntryFilter{
+				Regexp: regexp.MustCompile(`/me$`),
+			},
+			key:    "GET test.com /users/me",
+			result: true,
+		},
+		{
+			filter: EntryFilter{
+				Regexp: regexp.MustCompile(`\.js$`),
+			},
+			key:    "GET test.com /users/me",
+			result: false,
+		},
+		// vary的缓存以原始的key匹配
+		{
+			filter: EntryFilter{
+				Regexp: regexp.MustCompile(`/me$`),
+			},
+			key:    "GET test.com /users/me 1609459200:Accept-Language=zh",
+			result: true,
+		},
+		{
+			filter: EntryFilter{
+				Prefix: "/users/me",
+			},
+			key:    "GET test.com /users/me 1609459200:Accept-Language=zh",
+			result: true,
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.result, tt.filter.matchKey(tt.key))
+	}
+}
+
+func TestSplitVaryKey(t *testing.T) {
+	assert := assert.New(t)
+	base, values := splitVaryKey("GET test.com /users/me 1609459200:Accept-Language=zh")
+	assert.Equal("GET test.com /users/me", base)
+	assert.Equal("Accept-Language=zh", values)
+
+	base, values = splitVaryKey("GET test.com /users/me")
+	assert.Equal("GET test.com /users/me", base)
+	assert.Empty(values)
+}
+
+func TestHTTPCacheEntry(t *testing.T) {
+	assert := assert.New(t)
+	now := nowUnix()
+
+	// fetching的缓存未设置时间
+	hc := NewHTTPCache()
+	status, _ := hc.Get()
+	assert.Equal(StatusFetching, status)
+	entry := hc.entry(now)
+	assert.Equal(StatusFetching.String(), entry.Status)
+	assert.Equal(0, entry.Age)
+	assert.Equal(0, entry.TTL)
+
+	hc.HitForPass(30)
+	entry = hc.entry(now)
+	assert.Equal(StatusHitForPass.String(), entry.Status)
+	assert.Equal(0, entry.Age)
+	assert.Equal(30, entry.TTL)
+	entry = hc.entry(now + 10)
+	assert.Equal(10, entry.Age)
+	assert.Equal(20, entry.TTL)
+}
+
+func TestGetEntries(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDispatcher(DispatcherOption{
+		Size: 100,
+	})
+	d.GetHTTPCache([]byte("GET test.com /users/1")).Cacheable(&HTTPResponse{
+		RawBody: []byte("abc"),
+	}, 30)
+	d.GetHTTPCache([]byte("GET test.com /users/2")).HitForPass(30)
+	d.GetHTTPCache([]byte("GET example.com /users/1")).Cacheable(&HTTPResponse{
+		RawBody: []byte("abcd"),
+	}, 30)
+
+	entries := d.GetEntries(EntryFilter{})
+	assert.Equal(3, entries.Total)
+	assert.Equal(3, len(entries.Entries))
+
+	entries = d.GetEntries(EntryFilter{
+		Host:   "test.com",
+		Status: StatusHit,
+	})
+	assert.Equal(1, entries.Total)
+	assert.Equal(&Entry{
+		Key:     "GET test.com /users/1",
+		Status:  "hit",
+		TTL:     30,
+		RawSize: 3,
+	}, entries.Entries[0])
+
+	entries = d.GetEntries(EntryFilter{
+		Prefix: "/users/",
+		Offset: 1,
+		Limit:  1,
+	})
+	assert.Equal(3, entries.Total)
+	assert.Equal(1, len(entries.Entries))
+}
+
+func TestScanEntries(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDispatcher(DispatcherOption{
+		Size: 100,
+	})
+	_, err := d.ScanEntries(EntryFilter{})
+	assert.Equal(ErrStoreIsNil, err)
+
+	d = NewDispatcher(DispatcherOption{
+		Size:  100,
+		Store: "badger://" + filepath.Join(os.TempDir(), "pike-entries"),
+	})
+	assert.NotNil(d.store)
+	keys := []string{
+		"GET test.com /users/1",
+		"GET test.com /users/2",
+		"GET example.com /users/1",
+	}
+	for _, key := range keys {
+		d.GetHTTPCache([]byte(key)).Cacheable(&HTTPResponse{
+			RawBody: []byte("abc"),
+		}, 30)
+	}
+	defer func() {
+		for _, key := range keys {
+			d.RemoveHTTPCache([]byte(key))
+		}
+	}()
+
+	// 损坏的数据不计入总数
+	badKey := []byte("GET test.com /users/bad")
+	err = d.store.Set(badKey, []byte("bad data"), time.Minute)
+	assert.Nil(err)
+	defer func() {
+		_ = d.store.Delete(badKey)
+	}()
+
+	// 不在当前页的数据也只统计有效的
+	entries, err := d.ScanEntries(EntryFilter{
+		Host:  "test.com",
+		Limit: 1,
+	})
+	assert.Nil(err)
+	assert.Equal(2, entries.Total)
+	assert.Equal(1, len(entries.Entries))
+
+	entries, err = d.ScanEntries(EntryFilter{
+		Host:   "test.com",
+		Prefix: "/users/",
+	})
+	assert.Nil(err)
+	assert.Equal(2, entries.Total)
+	assert.Equal(2, len(entries.Entries))
+
+	entries, err = d.ScanEntries(EntryFilter{
+		Status: StatusHit,
+		Limit:  1,
+	})
+	assert.Nil(err)
+	assert.Equal(3, entries.Total)
+	assert.Equal(1, len(entries.Entries))
+	assert.Equal(3, entries.Entries[0].RawSize)
+}
+
+func TestPurge(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDispatcher(DispatcherOption{
+		Size:  100,
+		Store: "badger://" + filepath.Join(os.TempDir(), "pike-purge"),
+	})
+	assert.NotNil(d.store)
+	keys := []string{
+		"GET test.com /api/products/1",
+		"GET test.com /api/products/2",
+		"GET test.com /api/users/1",
+		"GET example.com /api/products/1",
+	}
+	for _, key := range keys {
+		d.GetHTTPCache([]byte(key)).Cacheable(&HTTPResponse{
+			RawBody: []byte("abc"),
+		}, 30)
+	}
+	// 从lru中删除，只保留store中的数据
+	lru := d.getLRU([]byte(keys[1]))
+	lru.mu.Lock()
+	lru.removeCache([]byte(keys[1]))
+	lru.mu.Unlock()
+
+	count, err := d.Purge(EntryFilter{
+		Host:   "test.com",
+		Prefix: "/api/products/",
+	})
+	assert.Nil(err)
+	assert.Equal(2, count)
+	_, err = d.store.Get([]byte(keys[1]))
+	assert.NotNil(err)
+
+	// vary的缓存与原始的key一起删除
+	varyCache := d.GetHTTPCache([]byte(keys[2]))
+	varyCache.Vary([]string{"Accept-Language"}, 30)
+	header := http.Header{}
+	header.Set("Accept-Language", "zh")
+	varyKey := varyCache.GetVaryKey(header)
+	d.GetHTTPCache(varyKey).Cacheable(&HTTPResponse{
+		RawBody: []byte("abc"),
+	}, 30)
+	entries := d.GetEntries(EntryFilter{
+		Regexp: regexp.MustCompile(`/users/1$`),
+	})
+	assert.Equal(2, entries.Total)
+	for _, entry := range entries.Entries {
+		assert.Equal(keys[2], entry.Key)
+	}
+
+	count, err = d.Purge(EntryFilter{
+		Regexp: regexp.MustCompile(`/1$`),
+	})
+	assert.Nil(err)
+	assert.Equal(3, count)
+	_, err = d.store.Get(varyKey)
+	assert.NotNil(err)
+
+	entries = d.GetEntries(EntryFilter{})
+	assert.Equal(0, entries.Total)
+}
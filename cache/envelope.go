@@ -0,0 +1,92 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 持久化数据的格式：magic(4字节) + version(1字节) + crc32(4字节) + data，
+// 旧版本的数据无magic，直接为data，以0开头(状态码或长度)，因此不会与magic冲突
+
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+const (
+	// envelopeVersion 当前数据格式的版本
+	envelopeVersion = 1
+	// envelopeHeaderSize magic + version + crc32
+	envelopeHeaderSize = 9
+)
+
+var envelopeMagic = []byte("PIKE")
+
+var (
+	// ErrDataCorrupted the data is corrupted(checksum mismatch or truncated)
+	ErrDataCorrupted = errors.New("cache data is corrupted")
+	// ErrUnknownVersion the version of data is unknown
+	ErrUnknownVersion = errors.New("unknown version of cache data")
+)
+
+// sealEnvelope wrap the data with magic, version and checksum
+func sealEnvelope(data []byte) []byte {
+	buf := make([]byte, envelopeHeaderSize+len(data))
+	copy(buf, envelopeMagic)
+	buf[4] = envelopeVersion
+	binary.BigEndian.PutUint32(buf[5:envelopeHeaderSize], crc32.ChecksumIEEE(data))
+	copy(buf[envelopeHeaderSize:], data)
+	return buf
+}
+
+// openEnvelope get the data from envelope, the data is returned directly
+// if it is legacy format(without magic)
+func openEnvelope(data []byte) (payload []byte, legacy bool, err error) {
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return data, true, nil
+	}
+	if len(data) < envelopeHeaderSize {
+		return nil, false, ErrDataCorrupted
+	}
+	if data[4] != envelopeVersion {
+		return nil, false, ErrUnknownVersion
+	}
+	payload = data[envelopeHeaderSize:]
+	if binary.BigEndian.Uint32(data[5:envelopeHeaderSize]) != crc32.ChecksumIEEE(payload) {
+		return nil, false, ErrDataCorrupted
+	}
+	return payload, false, nil
+}
+
+// isInvalidData check the error is caused by corrupted or unknown version data
+func isInvalidData(err error) bool {
+	return errors.Is(err, ErrDataCorrupted) || errors.Is(err, ErrUnknownVersion)
+}
+
+// wrapCorrupted wrap the error of parsing data as ErrDataCorrupted
+func wrapCorrupted(err error) error {
+	if err == nil || isInvalidData(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrDataCorrupted, err)
+}
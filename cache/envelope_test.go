@@ -0,0 +1,74 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cache
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvelope(t *testing.T) {
+	assert := assert.New(t)
+
+	data := []byte("Hello world!")
+	sealed := sealEnvelope(data)
+	assert.Equal(envelopeHeaderSize+len(data), len(sealed))
+	payload, legacy, err := openEnvelope(sealed)
+	assert.Nil(err)
+	assert.False(legacy)
+	assert.Equal(data, payload)
+
+	// 旧版本的数据
+	payload, legacy, err = openEnvelope(data)
+	assert.Nil(err)
+	assert.True(legacy)
+	assert.Equal(data, payload)
+
+	// 数据被修改
+	corrupted := append([]byte{}, sealed...)
+	corrupted[len(corrupted)-1] = 'a'
+	_, _, err = openEnvelope(corrupted)
+	assert.Equal(ErrDataCorrupted, err)
+
+	// 数据被截断
+	_, _, err = openEnvelope(sealed[:len(sealed)-1])
+	assert.Equal(ErrDataCorrupted, err)
+	_, _, err = openEnvelope(sealed[:6])
+	assert.Equal(ErrDataCorrupted, err)
+
+	// 未知版本
+	unknown := append([]byte{}, sealed...)
+	unknown[4] = envelopeVersion + 1
+	_, _, err = openEnvelope(unknown)
+	assert.Equal(ErrUnknownVersion, err)
+
+	assert.True(isInvalidData(ErrDataCorrupted))
+	assert.True(isInvalidData(ErrUnknownVersion))
+	assert.False(isInvalidData(errors.New("abc")))
+	err = wrapCorrupted(errors.New("abc"))
+	assert.True(errors.Is(err, ErrDataCorrupted))
+	assert.Equal("cache data is corrupted: abc", err.Error())
+	assert.Nil(wrapCorrupted(nil))
+}
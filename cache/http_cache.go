@@ -28,6 +28,12 @@ package cache
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -50,8 +56,16 @@ const (
 	StatusHit
 	// StatusPassed pass status
 	StatusPassed
+	// StatusStale stale status
+	StatusStale
 )
 
+// ErrWaitTimeout wait for fetching timeout
+var ErrWaitTimeout = errors.New("wait for fetching timeout")
+
+// ErrNotCached the http cache is not cached(only-if-cached)
+var ErrNotCached = errors.New("http cache is not cached")
+
 // defaultHitForPassSeconds default hit for pass: 300 seconds
 const defaultHitForPassSeconds = 300
 
@@ -69,6 +83,60 @@ type (
 		response  *HTTPResponse
 		createdAt int64
 		expiredAt int64
+		// vary 响应的vary请求头列表，若不为空则表示该缓存仅记录vary，
+		// 响应数据根据vary的请求头值保存在对应的缓存中
+		vary []string
+		// staleWhileRevalidate 过期后仍可使用的时长，在此期间后台更新缓存
+		staleWhileRevalidate int64
+		// staleIfError 过期后若获取数据失败时仍可使用的时长
+		staleIfError int64
+		// mustRevalidate 响应设置了must-revalidate或proxy-revalidate，过期后不可使用过期数据
+		mustRevalidate bool
+		// revalidating 是否正在后台更新缓存
+		revalidating bool
+		// compressDeferred 压缩队列已满而延迟的压缩，在之后命中时再提交
+		compressDeferred bool
+		// prefetching 是否在过期前预先更新缓存，更新完成后释放prefetch的并发数
+		prefetching bool
+		// hits 缓存数据的命中次数，缓存数据更新时重置
+		hits int64
+		// tags 缓存的标签
+		tags []string
+
+		// disp 所属的dispatcher，用于统计缓存数据大小
+		disp *dispatcher
+		// size 已统计的缓存数据大小，由dispatcher的sizeMu保护
+		size int64
+		// evicted 是否已被淘汰，由dispatcher的sizeMu保护
+		evicted bool
+	}
+	// GetOption the option of getting http cache, it's set by the request cache control
+	GetOption struct {
+		// MaxStale the seconds the stale response can be accepted(max-stale)
+		MaxStale int
+		// MinFresh the minimum seconds the response should be fresh(min-fresh), otherwise passed
+		MinFresh int
+		// MaxAge the max age(seconds) of response can be accepted(max-age), it's used only if HasMaxAge is true
+		MaxAge int
+		// HasMaxAge the request has max-age
+		HasMaxAge bool
+		// OnlyIfCached only the cached response is accepted(only-if-cached)
+		OnlyIfCached bool
+		// Refresh the cached response is skipped and fetched from upstream(no-cache)
+		Refresh bool
+	}
+	// CacheableOption the option of cacheable http cache
+	CacheableOption struct {
+		// TTL the ttl(seconds) of http cache
+		TTL int
+		// StaleWhileRevalidate the seconds the stale response can be used while revalidating
+		StaleWhileRevalidate int
+		// StaleIfError the seconds the stale response can be used if fetching fails
+		StaleIfError int
+		// MustRevalidate the stale response can't be used(must-revalidate or proxy-revalidate)
+		MustRevalidate bool
+		// Tags the tags of http cache
+		Tags []string
 	}
 )
 
@@ -86,6 +154,8 @@ func (i Status) String() string {
 		return "hit"
 	case StatusPassed:
 		return "passed"
+	case StatusStale:
+		return "stale"
 	default:
 		return "unknown"
 	}
@@ -108,22 +178,92 @@ func NewHTTPStoreCache(key []byte, store store.Store) *httpCache {
 
 // Get get http cache
 func (hc *httpCache) Get() (status Status, response *HTTPResponse) {
+	status, response, _ = hc.GetWithContext(context.Background())
+	return
+}
+
+// GetWithContext get http cache, if the http cache is fetching, it waits until the fetching is done,
+// the context is canceled or the wait timeout of dispatcher is expired
+func (hc *httpCache) GetWithContext(ctx context.Context) (status Status, response *HTTPResponse, err error) {
+	return hc.GetWithOption(ctx, GetOption{})
+}
+
+// GetWithOption get http cache with the option of request cache control,
+// it returns ErrNotCached if the option is only-if-cached and the http cache is not cached
+func (hc *httpCache) GetWithOption(ctx context.Context, opt GetOption) (status Status, response *HTTPResponse, err error) {
 	hc.mu.Lock()
-	status, done, response := hc.get()
+	// 状态为unknown时有可能从store中加载数据，需要更新缓存的数据大小
+	shouldUpdateSize := hc.status == StatusUnknown
+	status, done, response := hc.get(opt)
+	var job *compressJob
+	if status == StatusHit && hc.compressDeferred {
+		hc.compressDeferred = false
+		job = &compressJob{
+			hc:   hc,
+			resp: hc.response,
+		}
+	}
 	hc.mu.Unlock()
+	// 延迟的压缩任务在释放锁之后再提交
+	job.dispatch()
+	if shouldUpdateSize {
+		hc.updateTags()
+		hc.updateSize()
+	}
+	if status == StatusUnknown {
+		err = ErrNotCached
+		return
+	}
 	// 如果done不为空，表示需要等待确认当前请求状态
 	if done != nil {
-		// TODO 后续再考虑是否需要添加timeout（proxy部分有超时，因此暂时可不添加)
-		<-done
+		err = hc.wait(ctx, done)
+		if err != nil {
+			return
+		}
 		// 完成后重新获取当前状态与响应
-		// 此时状态只可能是hit for pass 或者 hit
+		// 此时状态只可能是hit for pass、hit 或者 unknown
 		// 而此两种状态的数据缓存均不会立即失效，因此可以从hc中获取
+		hc.mu.RLock()
 		status = hc.status
-		response = hc.response
+		// fetching被重置（出错时不设置hit for pass），等待的请求直接转发
+		if status == StatusUnknown {
+			status = StatusPassed
+		}
+		if status == StatusHit {
+			response = hc.response
+			// 获取失败时使用的过期数据
+			if hc.isExpired(nowUnix()) {
+				status = StatusStale
+			}
+		}
+		hc.mu.RUnlock()
 	}
 	return
 }
 
+// wait wait until the fetching is done
+func (hc *httpCache) wait(ctx context.Context, done chan struct{}) error {
+	// chan在完成时close，因此放弃等待的chan无需从列表中删除
+	var timeout <-chan time.Time
+	var waitTimeout time.Duration
+	if hc.disp != nil {
+		waitTimeout = hc.disp.getWaitTimeout()
+	}
+	if waitTimeout > 0 {
+		timer := time.NewTimer(waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timeout:
+		return ErrWaitTimeout
+	}
+}
+
 // Bytes httpcache to bytes
 func (hc *httpCache) Bytes() (data []byte, err error) {
 	statusBuf := uint32ToBytes(int(hc.status))
@@ -141,29 +281,85 @@ func (hc *httpCache) Bytes() (data []byte, err error) {
 	createdAtBuf := uint64ToBytes(hc.createdAt)
 	expiredAtBuf := uint64ToBytes(hc.expiredAt)
 
-	return bytes.Join([][]byte{
+	// vary，4个字节保存长度
+	varyBuf := []byte(strings.Join(hc.vary, ","))
+	varySizeBuf := uint32ToBytes(len(varyBuf))
+
+	// stale的时长，各4个字节
+	staleWhileRevalidateBuf := uint32ToBytes(int(hc.staleWhileRevalidate))
+	staleIfErrorBuf := uint32ToBytes(int(hc.staleIfError))
+
+	// tags，4个字节保存长度
+	tagsBuf := []byte(strings.Join(hc.tags, ","))
+	tagsSizeBuf := uint32ToBytes(len(tagsBuf))
+
+	// must-revalidate，4个字节
+	mustRevalidate := 0
+	if hc.mustRevalidate {
+		mustRevalidate = 1
+	}
+	mustRevalidateBuf := uint32ToBytes(mustRevalidate)
+
+	return sealEnvelope(bytes.Join([][]byte{
 		statusBuf,
 		respSizeBuf,
 		respBuf,
 		createdAtBuf,
 		expiredAtBuf,
-	}, []byte("")), nil
+		varySizeBuf,
+		varyBuf,
+		staleWhileRevalidateBuf,
+		staleIfErrorBuf,
+		tagsSizeBuf,
+		tagsBuf,
+		mustRevalidateBuf,
+	}, []byte(""))), nil
 }
 
-// FromBytes restore httpcache from bytes
+// FromBytes restore httpcache from bytes, the legacy format(without envelope) is supported,
+// ErrDataCorrupted or ErrUnknownVersion is returned if the data is invalid and the http cache is not changed
 func (hc *httpCache) FromBytes(data []byte) (err error) {
-	buffer := bytes.NewBuffer(data)
+	payload, _, err := openEnvelope(data)
+	if err != nil {
+		return
+	}
+	// 先解析至临时的数据，成功后再赋值，避免出错时修改了部分数据
+	item := &httpCache{}
+	err = item.readFrom(bytes.NewBuffer(payload))
+	if err != nil {
+		return wrapCorrupted(err)
+	}
+	hc.status = item.status
+	hc.response = item.response
+	hc.createdAt = item.createdAt
+	hc.expiredAt = item.expiredAt
+	hc.vary = item.vary
+	hc.staleWhileRevalidate = item.staleWhileRevalidate
+	hc.staleIfError = item.staleIfError
+	hc.tags = item.tags
+	hc.mustRevalidate = item.mustRevalidate
+	return
+}
+
+// readFrom read the fields of http cache from buffer
+func (hc *httpCache) readFrom(buffer *bytes.Buffer) (err error) {
 	status, err := readUint32ToInt(buffer)
 	if err != nil {
 		return
 	}
 	hc.status = Status(status)
+	if hc.status < StatusUnknown || hc.status > StatusStale {
+		return ErrDataCorrupted
+	}
 
 	respSize, err := readUint32ToInt(buffer)
 	if err != nil {
 		return
 	}
-	respBuf := buffer.Next(respSize)
+	respBuf, err := readBytes(buffer, respSize)
+	if err != nil {
+		return
+	}
 	resp := &HTTPResponse{}
 	err = resp.FromBytes(respBuf)
 	if err != nil {
@@ -181,6 +377,63 @@ func (hc *httpCache) FromBytes(data []byte) (err error) {
 		return
 	}
 
+	// 旧版本的数据无vary
+	if buffer.Len() == 0 {
+		return
+	}
+	size, err := readUint32ToInt(buffer)
+	if err != nil {
+		return
+	}
+	varyBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
+	if size != 0 {
+		hc.vary = strings.Split(string(varyBuf), ",")
+	}
+
+	// 旧版本的数据无stale的时长
+	if buffer.Len() == 0 {
+		return
+	}
+	staleWhileRevalidate, err := readUint32ToInt(buffer)
+	if err != nil {
+		return
+	}
+	hc.staleWhileRevalidate = int64(staleWhileRevalidate)
+	staleIfError, err := readUint32ToInt(buffer)
+	if err != nil {
+		return
+	}
+	hc.staleIfError = int64(staleIfError)
+
+	// 旧版本的数据无tags
+	if buffer.Len() == 0 {
+		return
+	}
+	size, err = readUint32ToInt(buffer)
+	if err != nil {
+		return
+	}
+	tagsBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
+	if size != 0 {
+		hc.tags = strings.Split(string(tagsBuf), ",")
+	}
+
+	// 旧版本的数据无must-revalidate
+	if buffer.Len() == 0 {
+		return
+	}
+	mustRevalidate, err := readUint32ToInt(buffer)
+	if err != nil {
+		return
+	}
+	hc.mustRevalidate = mustRevalidate != 0
+
 	return
 }
 
@@ -193,7 +446,17 @@ func (hc *httpCache) initFromStore() (err error) {
 	if err != nil {
 		return
 	}
-	return hc.FromBytes(data)
+	err = hc.FromBytes(data)
+	// 数据已损坏或版本未知，则删除该数据，当作未命中处理
+	if isInvalidData(err) {
+		if e := hc.store.Delete(hc.key); e != nil {
+			log.Default().Error("delete invalid data from store fail",
+				zap.String("key", string(hc.key)),
+				zap.Error(e),
+			)
+		}
+	}
+	return
 }
 
 // saveToStore save cache to store
@@ -205,11 +468,21 @@ func (hc *httpCache) saveToStore() (err error) {
 	if err != nil {
 		return
 	}
-	ttl := time.Duration(hc.expiredAt-nowUnix()) * time.Second
+	// 保存时长需要包括stale的时长
+	staleTTL := hc.staleWhileRevalidate
+	if hc.staleIfError > staleTTL {
+		staleTTL = hc.staleIfError
+	}
+	ttl := time.Duration(hc.expiredAt+staleTTL-nowUnix()) * time.Second
 	return hc.store.Set(hc.key, data, ttl)
 }
 
-func (hc *httpCache) get() (status Status, done chan struct{}, data *HTTPResponse) {
+// isTooOld check the age of http cache is bigger than max-age of request
+func (opt GetOption) isTooOld(createdAt, now int64) bool {
+	return opt.HasMaxAge && now-createdAt > int64(opt.MaxAge)
+}
+
+func (hc *httpCache) get(opt GetOption) (status Status, done chan struct{}, data *HTTPResponse) {
 	now := nowUnix()
 	// 如果首次创建并且设置store
 	if hc.status == StatusUnknown {
@@ -223,11 +496,58 @@ func (hc *httpCache) get() (status Status, done chan struct{}, data *HTTPRespons
 		}
 	}
 
-	// 如果缓存已过期，设置为StatusUnknown
-	if hc.expiredAt != 0 && hc.expiredAt < now {
+	// 强制刷新，缓存数据设置为已过期，由当前请求重新获取，
+	// 过期的数据仍用于校验与stale-if-error
+	if opt.Refresh && hc.status == StatusHit {
+		if !hc.isExpired(now) {
+			hc.expiredAt = now - 1
+		}
 		hc.status = StatusUnknown
-		// 将有效期重置（若不重置则导致hs.status每次都被重置为Unknown)
-		hc.expiredAt = 0
+	}
+
+	if hc.isExpired(now) {
+		// must-revalidate的缓存过期后不可使用过期数据，
+		// 过期数据的age大于请求的max-age也不可使用
+		if !hc.mustRevalidate && !opt.isTooOld(hc.createdAt, now) {
+			// 如果缓存已过期但仍在stale-while-revalidate时长内，则返回过期数据
+			if hc.status == StatusHit &&
+				hc.response != nil &&
+				now <= hc.expiredAt+hc.staleWhileRevalidate {
+				status = StatusStale
+				data = hc.response
+				return
+			}
+			// 请求可接受的过期时长内(max-stale)，返回过期数据
+			if (hc.status == StatusHit || hc.status == StatusFetching) &&
+				hc.response != nil &&
+				now <= hc.expiredAt+int64(opt.MaxStale) {
+				status = StatusStale
+				data = hc.response
+				return
+			}
+		}
+		// 如果缓存已过期，设置为StatusUnknown
+		// 已过期的响应数据并不清除，用于获取失败时stale-if-error使用
+		// fetching的状态则不重置，避免每次都被重置为Unknown
+		if hc.status != StatusFetching {
+			hc.status = StatusUnknown
+		}
+	}
+
+	if hc.status == StatusHit && !hc.isExpired(now) {
+		// 剩余有效期小于请求的min-fresh或age大于请求的max-age，直接转发
+		if hc.expiredAt-now < int64(opt.MinFresh) || opt.isTooOld(hc.createdAt, now) {
+			status = StatusPassed
+			if opt.OnlyIfCached {
+				status = StatusUnknown
+			}
+			return
+		}
+	} else if opt.OnlyIfCached && (hc.status != StatusHitForPass || len(hc.vary) == 0) {
+		// 只使用缓存数据，不更新状态，返回unknown
+		// vary的hit for pass则需要根据vary key再获取
+		status = StatusUnknown
+		return
 	}
 
 	// 仅有同类请求为fetching，才会需要等待
@@ -248,6 +568,7 @@ func (hc *httpCache) get() (status Status, done chan struct{}, data *HTTPRespons
 	// 因为有可能在函数调用完成后，刚好缓存过期了，如果此时不返回status与data
 	// 当其它goroutine获取锁之后，有可能刚好重置数据
 	if status == StatusHit {
+		hc.hits++
 		data = hc.response
 	}
 	return
@@ -255,17 +576,31 @@ func (hc *httpCache) get() (status Status, done chan struct{}, data *HTTPRespons
 
 // HitForPass set the http cache hit for pass
 func (hc *httpCache) HitForPass(ttl int) {
+	// 在释放锁之后再更新缓存的标签与数据大小，标签先于数据大小（有可能淘汰）更新
+	defer hc.updateSize()
+	defer hc.updateTags()
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
+	hc.hitForPass(ttl)
+}
+
+// hitForPass set http cache hit for pass, it should be called with lock
+func (hc *httpCache) hitForPass(ttl int) {
 	if ttl <= 0 {
 		ttl = defaultHitForPassSeconds
 	}
-	hc.expiredAt = nowUnix() + int64(ttl)
+	now := nowUnix()
+	hc.createdAt = now
+	hc.expiredAt = now + int64(ttl)
 	hc.status = StatusHitForPass
+	hc.response = nil
+	hc.vary = nil
+	hc.tags = nil
+	hc.stopRevalidating()
 	list := hc.chanList
 	hc.chanList = nil
 	for _, ch := range list {
-		ch <- struct{}{}
+		close(ch)
 	}
 	err := hc.saveToStore()
 	if err != nil {
@@ -279,19 +614,108 @@ func (hc *httpCache) HitForPass(ttl int) {
 
 // Cacheable set http cache cacheable and compress it
 func (hc *httpCache) Cacheable(resp *HTTPResponse, ttl int) {
+	hc.CacheableWithOption(resp, CacheableOption{
+		TTL: ttl,
+	})
+}
+
+// CacheableWithOption set http cache cacheable with option and compress it
+func (hc *httpCache) CacheableWithOption(resp *HTTPResponse, opt CacheableOption) {
+	// 压缩任务在释放锁之后再提交
+	var job *compressJob
+	defer func() {
+		job.dispatch()
+	}()
+	// 在释放锁之后再更新缓存的标签与数据大小，标签先于数据大小（有可能淘汰）更新
+	defer hc.updateSize()
+	defer hc.updateTags()
 	hc.mu.Lock()
 	defer hc.mu.Unlock()
-	// 如果是可缓存数据，则选择默认的best compression
-	resp.CompressSrv = compress.BestCompression
-	_ = resp.Compress()
+	// 状态码不可缓存的响应则设置为hit for pass
+	if !hc.isCacheableStatus(resp) {
+		hc.hitForPass(hc.disp.GetHitForPass())
+		return
+	}
+	job = hc.cacheable(resp, opt)
+}
+
+// PromoteHitForPass set the hit for pass http cache cacheable,
+// it returns false if the http cache is not hit for pass(or it's vary)
+func (hc *httpCache) PromoteHitForPass(resp *HTTPResponse, opt CacheableOption) bool {
+	// 压缩任务在释放锁之后再提交
+	var job *compressJob
+	defer func() {
+		job.dispatch()
+	}()
+	// 在释放锁之后再更新缓存的标签与数据大小，标签先于数据大小（有可能淘汰）更新
+	defer hc.updateSize()
+	defer hc.updateTags()
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	// 在锁中判断状态，避免覆盖其它请求已更新的缓存
+	if hc.status != StatusHitForPass || len(hc.vary) != 0 || !hc.isCacheableStatus(resp) {
+		return false
+	}
+	job = hc.cacheable(resp, opt)
+	return true
+}
+
+// ResetFetching reset the fetching http cache to unknown status without hit for pass,
+// the waiting requests will be passed to upstream
+func (hc *httpCache) ResetFetching() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.status != StatusFetching {
+		return
+	}
+	hc.status = StatusUnknown
+	list := hc.chanList
+	hc.chanList = nil
+	for _, ch := range list {
+		close(ch)
+	}
+}
+
+// isCacheableStatus check the status code of response is cacheable by the rule of dispatcher
+func (hc *httpCache) isCacheableStatus(resp *HTTPResponse) bool {
+	if hc.disp == nil {
+		return true
+	}
+	return hc.disp.IsCacheableStatus(resp.StatusCode)
+}
+
+// cacheable set http cache cacheable, it should be called with lock,
+// the response is published immediately and a compress job is returned if it should be compressed,
+// the store is saved after the job is done
+func (hc *httpCache) cacheable(resp *HTTPResponse, opt CacheableOption) *compressJob {
+	needCompress := resp.needCompress()
+	// 无需压缩的数据，则直接设置为默认的best compression
+	if !needCompress {
+		resp.CompressSrv = compress.BestCompression
+	}
 	hc.createdAt = nowUnix()
-	hc.expiredAt = hc.createdAt + int64(ttl)
+	hc.expiredAt = hc.createdAt + int64(opt.TTL)
+	hc.staleWhileRevalidate = int64(opt.StaleWhileRevalidate)
+	hc.staleIfError = int64(opt.StaleIfError)
+	hc.mustRevalidate = opt.MustRevalidate
 	hc.status = StatusHit
 	hc.response = resp
+	hc.vary = nil
+	hc.tags = opt.Tags
+	hc.hits = 0
+	hc.compressDeferred = false
+	hc.stopRevalidating()
 	list := hc.chanList
 	hc.chanList = nil
 	for _, ch := range list {
-		ch <- struct{}{}
+		close(ch)
+	}
+	// 需要压缩的数据，在压缩完成后再保存至store
+	if needCompress {
+		return &compressJob{
+			hc:   hc,
+			resp: resp,
+		}
 	}
 	err := hc.saveToStore()
 	if err != nil {
@@ -301,6 +725,198 @@ func (hc *httpCache) Cacheable(resp *HTTPResponse, ttl int) {
 			zap.Error(err),
 		)
 	}
+	return nil
+}
+
+// swapCompressed replaces the response with the compressed one and saves it to store,
+// it's ignored if the response of http cache has been changed
+func (hc *httpCache) swapCompressed(resp, compressed *HTTPResponse) {
+	hc.mu.Lock()
+	if hc.status != StatusHit || hc.response != resp {
+		hc.mu.Unlock()
+		return
+	}
+	// 压缩失败则保存原有数据
+	if compressed != nil {
+		hc.response = compressed
+	}
+	err := hc.saveToStore()
+	hc.mu.Unlock()
+	if err != nil {
+		log.Default().Error("save cache to store fail",
+			zap.String("category", "compress"),
+			zap.String("key", string(hc.key)),
+			zap.Error(err),
+		)
+	}
+	// 释放锁之后再更新缓存的数据大小
+	hc.updateSize()
+}
+
+// StaleIfError restores the http cache to the stale response if it is within stale-if-error,
+// it returns nil if there is no available stale response
+func (hc *httpCache) StaleIfError() *HTTPResponse {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.status != StatusFetching ||
+		hc.response == nil ||
+		nowUnix() > hc.expiredAt+hc.staleIfError {
+		return nil
+	}
+	// 恢复为过期的缓存数据，等待的请求也使用该数据
+	hc.status = StatusHit
+	list := hc.chanList
+	hc.chanList = nil
+	for _, ch := range list {
+		close(ch)
+	}
+	return hc.response
+}
+
+// GetRevalidationResponse get the expired response which can be revalidated with upstream,
+// it returns nil if the response is not expired or has no ETag and Last-Modified
+func (hc *httpCache) GetRevalidationResponse() *HTTPResponse {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	if hc.response == nil || !hc.isExpired(nowUnix()) {
+		return nil
+	}
+	if !hc.response.HasValidator() {
+		return nil
+	}
+	return hc.response
+}
+
+// Revalidate marks the stale http cache as revalidating,
+// it returns false if the http cache is not stale or is revalidating
+func (hc *httpCache) Revalidate() bool {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	now := nowUnix()
+	if hc.revalidating ||
+		hc.status != StatusHit ||
+		!hc.isExpired(now) ||
+		now > hc.expiredAt+hc.staleWhileRevalidate {
+		return false
+	}
+	hc.revalidating = true
+	return true
+}
+
+// CancelRevalidate cancels the revalidating of http cache, the stale response will be used
+func (hc *httpCache) CancelRevalidate() {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.stopRevalidating()
+}
+
+// stopRevalidating stops the revalidating of http cache, it should be called with lock
+func (hc *httpCache) stopRevalidating() {
+	if hc.prefetching {
+		defaultPrefetchLimiter.release()
+		hc.prefetching = false
+	}
+	hc.revalidating = false
+}
+
+// Prefetch marks the popular http cache as revalidating before it's expired,
+// it returns false if the hits are not enough, the ttl is not in the prefetch range
+// or the prefetch limit is reached
+func (hc *httpCache) Prefetch() bool {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.disp == nil {
+		return false
+	}
+	prefetchHits, prefetchPercent := hc.disp.getPrefetch()
+	if prefetchHits <= 0 {
+		return false
+	}
+	now := nowUnix()
+	if hc.revalidating ||
+		hc.status != StatusHit ||
+		hc.expiredAt == 0 ||
+		hc.isExpired(now) ||
+		hc.hits < int64(prefetchHits) {
+		return false
+	}
+	// 剩余有效期在最后的prefetchPercent%内才预先更新
+	ttl := hc.expiredAt - hc.createdAt
+	if (hc.expiredAt-now)*100 > ttl*int64(prefetchPercent) {
+		return false
+	}
+	if !defaultPrefetchLimiter.acquire() {
+		return false
+	}
+	hc.revalidating = true
+	hc.prefetching = true
+	return true
+}
+
+// Vary set the http cache as vary, the response will be cached by the vary key
+func (hc *httpCache) Vary(vary []string, ttl int) {
+	// 在释放锁之后再更新缓存的标签与数据大小，标签先于数据大小（有可能淘汰）更新
+	defer hc.updateSize()
+	defer hc.updateTags()
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	// vary的缓存只记录vary列表，对于等待的请求以hit for pass返回，
+	// 由其根据vary重新获取对应的缓存
+	hc.createdAt = nowUnix()
+	hc.expiredAt = hc.createdAt + int64(ttl)
+	hc.status = StatusHitForPass
+	hc.response = nil
+	hc.vary = vary
+	hc.tags = nil
+	list := hc.chanList
+	hc.chanList = nil
+	for _, ch := range list {
+		close(ch)
+	}
+	err := hc.saveToStore()
+	if err != nil {
+		log.Default().Error("save cache to store fail",
+			zap.String("category", "vary"),
+			zap.String("key", string(hc.key)),
+			zap.Error(err),
+		)
+	}
+}
+
+// GetVaryKey get the vary key of http cache by request header,
+// it returns nil if the http cache is not vary
+func (hc *httpCache) GetVaryKey(header http.Header) []byte {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	if len(hc.vary) == 0 || hc.status != StatusHitForPass {
+		return nil
+	}
+	if hc.isExpired(nowUnix()) {
+		return nil
+	}
+	values := make(url.Values)
+	for _, name := range hc.vary {
+		values.Set(name, strings.Join(header.Values(name), ","))
+	}
+	// 添加vary的创建时间，保证vary重新生成时，
+	// 原有各vary的缓存不再使用
+	return []byte(string(hc.key) + " " + strconv.FormatInt(hc.createdAt, 10) + ":" + values.Encode())
+}
+
+// updateSize update the size of http cache's response to dispatcher
+func (hc *httpCache) updateSize() {
+	if hc.disp == nil {
+		return
+	}
+	hc.mu.RLock()
+	size := 0
+	if hc.response != nil {
+		size = hc.response.Size()
+	}
+	hc.disp.setSize(hc, int64(size))
+	hc.mu.RUnlock()
+	// 释放锁之后再淘汰，避免与lru的锁冲突
+	hc.disp.evict()
 }
 
 // Age get http cache's age
@@ -317,12 +933,16 @@ func (hc *httpCache) GetStatus() Status {
 	return hc.status
 }
 
+func (hc *httpCache) isExpired(now int64) bool {
+	if hc.expiredAt == 0 {
+		return false
+	}
+	return hc.expiredAt < now
+}
+
 // IsExpired the cache is expired
 func (hc *httpCache) IsExpired() bool {
 	hc.mu.RLock()
 	defer hc.mu.RUnlock()
-	if hc.expiredAt == 0 {
-		return false
-	}
-	return hc.expiredAt < nowUnix()
+	return hc.isExpired(nowUnix())
 }
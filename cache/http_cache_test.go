@@ -1,11 +1,16 @@
 package cache
 
 import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/store"
 )
 
 func TestCacheStatusString(t *testing.T) {
@@ -15,6 +20,7 @@ func TestCacheStatusString(t *testing.T) {
 	assert.Equal("hitForPass", StatusHitForPass.String())
 	assert.Equal("hit", StatusHit.String())
 	assert.Equal("passed", StatusPassed.String())
+	assert.Equal("stale", StatusStale.String())
 	assert.Equal("unknown", StatusUnknown.String())
 }
 
@@ -27,6 +33,16 @@ func TestHTTPCacheBytes(t *testing.T) {
 		},
 		createdAt: 1,
 		expiredAt: 2,
+		vary: []string{
+			"Accept-Language",
+			"X-Device",
+		},
+		staleWhileRevalidate: 10,
+		staleIfError:         20,
+		tags: []string{
+			"product-1",
+			"products",
+		},
 	}
 	data, err := hc.Bytes()
 	assert.Nil(err)
@@ -38,6 +54,237 @@ func TestHTTPCacheBytes(t *testing.T) {
 	assert.Equal(hc.response.CompressSrv, newHC.response.CompressSrv)
 	assert.Equal(hc.createdAt, newHC.createdAt)
 	assert.Equal(hc.expiredAt, newHC.expiredAt)
+	assert.Equal(hc.vary, newHC.vary)
+	assert.Equal(hc.staleWhileRevalidate, newHC.staleWhileRevalidate)
+	assert.Equal(hc.staleIfError, newHC.staleIfError)
+	assert.Equal(hc.tags, newHC.tags)
+}
+
+func TestHTTPCacheFromInvalidBytes(t *testing.T) {
+	assert := assert.New(t)
+	hc := httpCache{
+		status: StatusHit,
+		response: &HTTPResponse{
+			StatusCode: 200,
+			RawBody:    []byte("Hello world!"),
+		},
+		createdAt: 1,
+		expiredAt: 2,
+	}
+	data, err := hc.Bytes()
+	assert.Nil(err)
+
+	newHC := NewHTTPCache()
+
+	// 数据被修改
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-5] ^= 0xff
+	err = newHC.FromBytes(corrupted)
+	assert.Equal(ErrDataCorrupted, err)
+
+	// 数据被截断
+	err = newHC.FromBytes(data[:len(data)-2])
+	assert.Equal(ErrDataCorrupted, err)
+
+	// 未知版本
+	unknown := append([]byte{}, data...)
+	unknown[4] = envelopeVersion + 1
+	err = newHC.FromBytes(unknown)
+	assert.Equal(ErrUnknownVersion, err)
+
+	// 旧版本的数据被截断
+	payload, _, err := openEnvelope(data)
+	assert.Nil(err)
+	err = newHC.FromBytes(payload[:len(payload)/2])
+	assert.True(isInvalidData(err))
+
+	// 出错时不修改数据
+	assert.Equal(StatusUnknown, newHC.status)
+	assert.Nil(newHC.response)
+}
+
+func TestHTTPCacheFromLegacyBytes(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		StatusCode: 200,
+		Header:     http.Header{},
+		RawBody:    []byte("Hello world!"),
+	}
+	respData, err := resp.Bytes()
+	assert.Nil(err)
+	// 旧版本的数据无envelope
+	data := bytes.Join([][]byte{
+		uint32ToBytes(int(StatusHit)),
+		uint32ToBytes(len(respData)),
+		respData,
+		uint64ToBytes(1),
+		uint64ToBytes(2),
+	}, []byte(""))
+
+	hc := NewHTTPCache()
+	err = hc.FromBytes(data)
+	assert.Nil(err)
+	assert.Equal(StatusHit, hc.status)
+	assert.Equal(int64(1), hc.createdAt)
+	assert.Equal(int64(2), hc.expiredAt)
+	assert.Equal(resp.RawBody, hc.response.RawBody)
+
+	// 非法的状态
+	data[3] = 0xff
+	err = hc.FromBytes(data)
+	assert.Equal(ErrDataCorrupted, err)
+}
+
+func TestHTTPCacheInitFromInvalidStore(t *testing.T) {
+	assert := assert.New(t)
+	key := []byte("GET test.com /invalid")
+	s := &testCompressStore{
+		data: map[string][]byte{
+			string(key): append(append([]byte{}, envelopeMagic...), envelopeVersion+1, 0, 0, 0, 0),
+		},
+	}
+	hc := NewHTTPStoreCache(key, s)
+	// 无法识别的数据当作未命中处理并从store中删除
+	status, _, data := hc.get(GetOption{})
+	assert.Equal(StatusFetching, status)
+	assert.Nil(data)
+	_, err := s.Get(key)
+	assert.Equal(store.ErrNotFound, err)
+}
+
+func TestHTTPCacheStaleWhileRevalidate(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPCache()
+	resp := &HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}
+	hc.CacheableWithOption(resp, CacheableOption{
+		TTL:                  -1,
+		StaleWhileRevalidate: 60,
+	})
+	status, data := hc.Get()
+	assert.Equal(StatusStale, status)
+	assert.Equal(resp, data)
+
+	// 只允许一个后台更新
+	assert.True(hc.Revalidate())
+	assert.False(hc.Revalidate())
+	hc.CancelRevalidate()
+	assert.True(hc.Revalidate())
+
+	// 超过stale-while-revalidate则需要重新获取
+	hc.expiredAt = nowUnix() - 61
+	assert.False(hc.Revalidate())
+	status, data = hc.Get()
+	assert.Equal(StatusFetching, status)
+	assert.Nil(data)
+}
+
+func TestHTTPCachePrefetch(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPCache()
+	resp := &HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}
+	hc.Cacheable(resp, 100)
+	// 未设置dispatcher，不预先更新
+	assert.False(hc.Prefetch())
+
+	hc.disp = NewDispatcher(DispatcherOption{
+		Size:         10,
+		PrefetchHits: 2,
+	})
+	// 命中次数不足
+	hc.Get()
+	assert.False(hc.Prefetch())
+	hc.Get()
+	// 剩余有效期不在最后的10%内
+	assert.False(hc.Prefetch())
+
+	// 剩余有效期为5秒
+	hc.createdAt -= 95
+	hc.expiredAt -= 95
+	assert.True(hc.Prefetch())
+	assert.Equal(1, defaultPrefetchLimiter.getRunning())
+	// 只允许一个后台更新
+	assert.False(hc.Prefetch())
+	status, data := hc.Get()
+	assert.Equal(StatusHit, status)
+	assert.Equal(resp, data)
+
+	// 更新后释放并发数并重置命中次数
+	hc.Cacheable(resp, 100)
+	assert.Equal(0, defaultPrefetchLimiter.getRunning())
+	assert.Equal(int64(0), hc.hits)
+}
+
+func TestHTTPCacheStaleIfError(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPCache()
+	resp := &HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}
+	hc.CacheableWithOption(resp, CacheableOption{
+		TTL:          -1,
+		StaleIfError: 60,
+	})
+	// 非fetching状态，不可使用过期数据
+	assert.Nil(hc.StaleIfError())
+
+	status, _ := hc.Get()
+	assert.Equal(StatusFetching, status)
+
+	done := make(chan struct{})
+	go func() {
+		// 等待的请求也使用过期数据
+		status, data := hc.Get()
+		assert.Equal(StatusStale, status)
+		assert.Equal(resp, data)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(resp, hc.StaleIfError())
+	<-done
+
+	// 超过stale-if-error则不可使用
+	hc.expiredAt = nowUnix() - 61
+	status, _ = hc.Get()
+	assert.Equal(StatusFetching, status)
+	assert.Nil(hc.StaleIfError())
+}
+
+func TestHTTPCacheVary(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPStoreCache([]byte("GET test.com /"), nil)
+	status, _ := hc.Get()
+	assert.Equal(StatusFetching, status)
+	assert.Nil(hc.GetVaryKey(http.Header{}))
+
+	hc.Vary([]string{
+		"Accept-Language",
+	}, 60)
+	status, resp := hc.Get()
+	assert.Equal(StatusHitForPass, status)
+	assert.Nil(resp)
+
+	zhHeader := http.Header{}
+	zhHeader.Set("Accept-Language", "zh")
+	enHeader := http.Header{}
+	enHeader.Set("Accept-Language", "en")
+	zhKey := hc.GetVaryKey(zhHeader)
+	assert.Equal("GET test.com / "+strconv.FormatInt(hc.createdAt, 10)+":Accept-Language=zh", string(zhKey))
+	assert.NotEqual(zhKey, hc.GetVaryKey(enHeader))
+
+	// 设置为可缓存后，则不再是vary
+	hc.Cacheable(&HTTPResponse{}, 60)
+	assert.Nil(hc.GetVaryKey(zhHeader))
+
+	// 已过期的vary
+	hc.Vary([]string{
+		"Accept-Language",
+	}, 60)
+	hc.expiredAt = 1
+	assert.Nil(hc.GetVaryKey(zhHeader))
 }
 
 func TestHTTPCacheGet(t *testing.T) {
@@ -149,3 +396,278 @@ func TestHTTPCacheIsExpired(t *testing.T) {
 	hc.expiredAt = nowUnix() + 10
 	assert.False(hc.IsExpired())
 }
+
+func TestHTTPCacheGetRevalidationResponse(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPCache()
+	resp := &HTTPResponse{
+		Header: http.Header{
+			"Etag": []string{
+				`"123"`,
+			},
+		},
+		RawBody: []byte("Hello world!"),
+	}
+	hc.Cacheable(resp, 60)
+	// 未过期
+	assert.Nil(hc.GetRevalidationResponse())
+
+	hc.Cacheable(resp, -1)
+	status, _ := hc.Get()
+	assert.Equal(StatusFetching, status)
+	assert.Equal(resp, hc.GetRevalidationResponse())
+
+	// 无ETag与Last-Modified
+	hc.Cacheable(&HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}, -1)
+	assert.Nil(hc.GetRevalidationResponse())
+}
+
+func TestHTTPCacheWait(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDispatcher(DispatcherOption{
+		Size:        100,
+		WaitTimeout: 10 * time.Millisecond,
+	})
+	hc := d.GetHTTPCache([]byte("GET test.com /wait"))
+	status, _, err := hc.GetWithContext(context.Background())
+	assert.Nil(err)
+	assert.Equal(StatusFetching, status)
+
+	// 等待超时
+	start := time.Now()
+	_, _, err = hc.GetWithContext(context.Background())
+	assert.Equal(ErrWaitTimeout, err)
+	assert.True(time.Since(start) < time.Second)
+
+	// context取消则不再等待
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = hc.GetWithContext(ctx)
+	assert.Equal(context.Canceled, err)
+
+	// 放弃等待的请求不影响后续的完成处理
+	done := make(chan struct{})
+	go func() {
+		status, _, err := hc.GetWithContext(context.Background())
+		assert.Nil(err)
+		assert.Equal(StatusHitForPass, status)
+		close(done)
+	}()
+	time.Sleep(time.Millisecond)
+	hc.HitForPass(60)
+	<-done
+}
+
+func TestHTTPCachePromoteHitForPass(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPCache()
+	resp := &HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}
+	// 非hit for pass不可更新
+	assert.False(hc.PromoteHitForPass(resp, CacheableOption{
+		TTL: 60,
+	}))
+
+	hc.HitForPass(60)
+	assert.True(hc.PromoteHitForPass(resp, CacheableOption{
+		TTL: 60,
+	}))
+	status, data := hc.Get()
+	assert.Equal(StatusHit, status)
+	assert.Equal(resp, data)
+
+	// vary的hit for pass不可更新
+	hc.Vary([]string{
+		"Accept-Language",
+	}, 60)
+	assert.False(hc.PromoteHitForPass(resp, CacheableOption{
+		TTL: 60,
+	}))
+}
+
+func TestHTTPCacheResetFetching(t *testing.T) {
+	assert := assert.New(t)
+	hc := NewHTTPCache()
+	// 非fetching不处理
+	hc.ResetFetching()
+	assert.Equal(StatusUnknown, hc.GetStatus())
+
+	status, _ := hc.Get()
+	assert.Equal(StatusFetching, status)
+
+	done := make(chan struct{})
+	go func() {
+		// 等待的请求直接转发
+		status, _ := hc.Get()
+		assert.Equal(StatusPassed, status)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	hc.ResetFetching()
+	<-done
+	assert.Equal(StatusUnknown, hc.GetStatus())
+
+	// 重置后的请求重新获取
+	status, _ = hc.Get()
+	assert.Equal(StatusFetching, status)
+}
+
+func TestHTTPCacheRefresh(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		RawBody: []byte("Hello world!"),
+		Header: http.Header{
+			"Etag": []string{`"123"`},
+		},
+	}
+	hc := NewHTTPCache()
+	hc.Cacheable(resp, 10)
+
+	// 强制刷新，状态为fetching，原缓存数据可用于校验
+	status, data, err := hc.GetWithOption(context.Background(), GetOption{
+		Refresh: true,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusFetching, status)
+	assert.Nil(data)
+	assert.Equal(resp, hc.GetRevalidationResponse())
+
+	hc.Cacheable(resp, 10)
+	status, _, err = hc.GetWithOption(context.Background(), GetOption{})
+	assert.Nil(err)
+	assert.Equal(StatusHit, status)
+}
+
+func TestHTTPCacheGetWithOption(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}
+
+	// only-if-cached，未缓存时不更新状态
+	hc := NewHTTPCache()
+	_, _, err := hc.GetWithOption(context.Background(), GetOption{
+		OnlyIfCached: true,
+	})
+	assert.Equal(ErrNotCached, err)
+	assert.Equal(StatusUnknown, hc.GetStatus())
+
+	hc.Cacheable(resp, 10)
+	status, data, err := hc.GetWithOption(context.Background(), GetOption{
+		OnlyIfCached: true,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusHit, status)
+	assert.Equal(resp, data)
+
+	// 剩余有效期小于min-fresh
+	status, data, err = hc.GetWithOption(context.Background(), GetOption{
+		MinFresh: 60,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusPassed, status)
+	assert.Nil(data)
+	_, _, err = hc.GetWithOption(context.Background(), GetOption{
+		MinFresh:     60,
+		OnlyIfCached: true,
+	})
+	assert.Equal(ErrNotCached, err)
+
+	// age大于请求的max-age，直接转发
+	hc.createdAt = nowUnix() - 5
+	status, data, err = hc.GetWithOption(context.Background(), GetOption{
+		MaxAge:    1,
+		HasMaxAge: true,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusPassed, status)
+	assert.Nil(data)
+	status, data, err = hc.GetWithOption(context.Background(), GetOption{
+		MaxAge:    10,
+		HasMaxAge: true,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusHit, status)
+	assert.Equal(resp, data)
+
+	// age大于请求的max-age，过期的数据在max-stale内也不可使用
+	hc.mu.Lock()
+	hc.expiredAt = nowUnix() - 1
+	hc.mu.Unlock()
+	status, _, err = hc.GetWithOption(context.Background(), GetOption{
+		MaxStale:  10,
+		MaxAge:    1,
+		HasMaxAge: true,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusFetching, status)
+	hc.Cacheable(resp, 10)
+
+	// 过期的数据在max-stale内
+	hc.expiredAt = nowUnix() - 5
+	status, data, err = hc.GetWithOption(context.Background(), GetOption{
+		MaxStale: 10,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusStale, status)
+	assert.Equal(resp, data)
+
+	// 超过max-stale
+	status, _, err = hc.GetWithOption(context.Background(), GetOption{
+		MaxStale: 1,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusFetching, status)
+
+	// fetching中的过期数据在max-stale内也可使用
+	status, data, err = hc.GetWithOption(context.Background(), GetOption{
+		MaxStale: 10,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusStale, status)
+	assert.Equal(resp, data)
+}
+
+func TestHTTPCacheMustRevalidate(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		StatusCode: 200,
+		RawBody:    []byte("abcd"),
+	}
+	hc := NewHTTPCache()
+	hc.cacheable(resp, CacheableOption{
+		TTL:                  10,
+		StaleWhileRevalidate: 60,
+		MustRevalidate:       true,
+	})
+	assert.True(hc.mustRevalidate)
+
+	// 序列化后仍保留must-revalidate
+	data, err := hc.Bytes()
+	assert.Nil(err)
+	restored := NewHTTPCache()
+	err = restored.FromBytes(data)
+	assert.Nil(err)
+	assert.True(restored.mustRevalidate)
+
+	// 过期后即使在max-stale与stale-while-revalidate内也不可使用过期数据
+	hc.expiredAt = nowUnix() - 5
+	status, result, err := hc.GetWithOption(context.Background(), GetOption{
+		MaxStale: 60,
+	})
+	assert.Nil(err)
+	assert.Equal(StatusFetching, status)
+	assert.Nil(result)
+
+	// fetching中的过期数据也不可使用
+	status, result, err = hc.GetWithOption(context.Background(), GetOption{
+		MaxStale:     60,
+		OnlyIfCached: true,
+	})
+	assert.Equal(ErrNotCached, err)
+	assert.Nil(result)
+	assert.NotEqual(StatusStale, status)
+}
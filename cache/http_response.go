@@ -22,8 +22,8 @@
 
 // HTTP响应数据，只用于根据客户端支持编码以及最小压缩长度返回对应的数据
 
-// 对于可缓存且大于最小缓存则可使用compress方法保存gzip与br两种缓存数据，
-// 在客户端请求时根据客户端支持的编码返回，若不支持压缩，则从解压获取原始数据返回
+// 对于可缓存且大于最小缓存则可使用compress方法保存默认编码(gzip、br与zstd)的缓存数据，
+// 在客户端请求时根据客户端支持的编码(q值)以及服务端的编码优先顺序返回，若不支持压缩，则从解压获取原始数据返回
 // 对于不可缓存数据，根据客户端支持的编码以及数据长度返回对应数据
 
 package cache
@@ -34,12 +34,17 @@ import (
 	"errors"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/vicanso/elton"
+	"github.com/vicanso/pike/cachecontrol"
 	"github.com/vicanso/pike/compress"
+	"github.com/vicanso/pike/util"
 )
 
+const headerVary = "Vary"
+
 var ignoreHeaders = []string{
 	"Content-Encoding",
 	"Content-Length",
@@ -49,6 +54,9 @@ var ignoreHeaders = []string{
 
 var ErrBodyIsNil = errors.New("body is nil")
 
+// ErrNotAcceptable identity is refused by client and no acceptable encoding
+var ErrNotAcceptable = util.NewError("No acceptable content encoding", http.StatusNotAcceptable)
+
 var defaultCompressContentTypeFilter = regexp.MustCompile(`text|javascript|json|wasm|xml|font`)
 
 type (
@@ -60,13 +68,15 @@ type (
 		CompressMinLength int `json:"compressMinLength,omitempty"`
 		// 压缩数据类型
 		CompressContentTypeFilter *regexp.Regexp `json:"-"`
+		// 预先压缩的编码，为空则使用默认编码(br, zstd, gzip)
+		CompressEncodings []string `json:"compressEncodings,omitempty"`
 		// 响应头
 		Header http.Header `json:"header,omitempty"`
 		// 响应状态码
-		StatusCode int    `json:"statusCode,omitempty"`
-		GzipBody   []byte `json:"gzipBody,omitempty"`
-		BrBody     []byte `json:"brBody,omitempty"`
-		RawBody    []byte `json:"rawBody,omitempty"`
+		StatusCode int `json:"statusCode,omitempty"`
+		// 各编码的压缩数据，key为编码名称，如gzip、br
+		EncodedBodies map[string][]byte `json:"encodedBodies,omitempty"`
+		RawBody       []byte            `json:"rawBody,omitempty"`
 	}
 )
 
@@ -84,13 +94,14 @@ func NewHTTPResponse(statusCode int, header http.Header, encoding string, data [
 		StatusCode: statusCode,
 		Header:     cloneHeaderAndIgnore(header),
 	}
-	switch encoding {
-	case compress.EncodingGzip:
-		resp.GzipBody = data
-	case compress.EncodingBrotli:
-		resp.BrBody = data
-	case "":
+	switch {
+	case encoding == "":
 		resp.RawBody = data
+	// 默认编码的数据直接保存
+	case compress.IsDefaultEncoding(encoding):
+		resp.EncodedBodies = map[string][]byte{
+			encoding: data,
+		}
 	default:
 		// 取默认的compress来解压
 		compressSrv := compress.Get("")
@@ -132,15 +143,36 @@ func (resp *HTTPResponse) Bytes() (data []byte, err error) {
 	// 响应码，4个字节
 	statusCodeBuf := uint32ToBytes(resp.StatusCode)
 
+	gzipBody := resp.getEncodedBody(compress.EncodingGzip)
+	brBody := resp.getEncodedBody(compress.EncodingBrotli)
+	zstdBody := resp.getEncodedBody(compress.EncodingZstd)
+
 	// gzip，4个字节保存长度
-	gzipBufSize := uint32ToBytes(len(resp.GzipBody))
+	gzipBufSize := uint32ToBytes(len(gzipBody))
 
 	// br，4个字节保存长度
-	brBufSize := uint32ToBytes(len(resp.BrBody))
+	brBufSize := uint32ToBytes(len(brBody))
 
 	// raw，4个字节保存长度
 	rawBufSize := uint32ToBytes(len(resp.RawBody))
 
+	// zstd，4个字节保存长度，放在最后兼容旧版本的数据
+	zstdBufSize := uint32ToBytes(len(zstdBody))
+
+	// 其它编码的数据，旧版本读取时忽略
+	encodedBuf := resp.encodedBodiesToBytes()
+
+	// 预先压缩的编码，4个字节保存长度，放在最后兼容旧版本的数据
+	var compressEncodingsBuf []byte
+	if len(resp.CompressEncodings) != 0 {
+		// 无其它编码的数据时也需要保存数量
+		if len(encodedBuf) == 0 {
+			encodedBuf = uint32ToBytes(0)
+		}
+		buf := []byte(strings.Join(resp.CompressEncodings, ","))
+		compressEncodingsBuf = append(uint32ToBytes(len(buf)), buf...)
+	}
+
 	return bytes.Join([][]byte{
 		compressSrvBufSize,
 		compressSrvBuf,
@@ -151,27 +183,44 @@ func (resp *HTTPResponse) Bytes() (data []byte, err error) {
 		headerBuf,
 		statusCodeBuf,
 		gzipBufSize,
-		resp.GzipBody,
+		gzipBody,
 		brBufSize,
-		resp.BrBody,
+		brBody,
 		rawBufSize,
 		resp.RawBody,
+		zstdBufSize,
+		zstdBody,
+		encodedBuf,
+		compressEncodingsBuf,
 	}, []byte("")), nil
-
 }
 
-// FromBytes http response from bytes
+// FromBytes http response from bytes, ErrDataCorrupted is returned if the data is invalid
 func (resp *HTTPResponse) FromBytes(data []byte) (err error) {
 	if len(data) == 0 {
 		return
 	}
-	buffer := bytes.NewBuffer(data)
+	// 先解析至临时的数据，成功后再赋值，避免出错时修改了部分数据
+	item := &HTTPResponse{}
+	err = item.readFrom(bytes.NewBuffer(data))
+	if err != nil {
+		return wrapCorrupted(err)
+	}
+	*resp = *item
+	return
+}
 
+// readFrom read the fields of http response from buffer
+func (resp *HTTPResponse) readFrom(buffer *bytes.Buffer) (err error) {
 	size, err := readUint32ToInt(buffer)
 	if err != nil {
 		return
 	}
-	resp.CompressSrv = string(buffer.Next(size))
+	compressSrvBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
+	resp.CompressSrv = string(compressSrvBuf)
 
 	resp.CompressMinLength, err = readUint32ToInt(buffer)
 	if err != nil {
@@ -182,7 +231,11 @@ func (resp *HTTPResponse) FromBytes(data []byte) (err error) {
 	if err != nil {
 		return
 	}
-	contentTypeFilter := string(buffer.Next(size))
+	filterBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
+	contentTypeFilter := string(filterBuf)
 	if contentTypeFilter != "" {
 		resp.CompressContentTypeFilter, err = regexp.Compile(contentTypeFilter)
 		if err != nil {
@@ -194,7 +247,10 @@ func (resp *HTTPResponse) FromBytes(data []byte) (err error) {
 	if err != nil {
 		return
 	}
-	headerBuf := buffer.Next(size)
+	headerBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
 	err = json.Unmarshal(headerBuf, &resp.Header)
 	if err != nil {
 		return
@@ -209,28 +265,232 @@ func (resp *HTTPResponse) FromBytes(data []byte) (err error) {
 	if err != nil {
 		return
 	}
-	resp.GzipBody = buffer.Next(size)
+	gzipBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
+	resp.setEncodedBody(compress.EncodingGzip, gzipBuf)
 
 	size, err = readUint32ToInt(buffer)
 	if err != nil {
 		return
 	}
-	resp.BrBody = buffer.Next(size)
+	brotliBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
+	resp.setEncodedBody(compress.EncodingBrotli, brotliBuf)
 
 	size, err = readUint32ToInt(buffer)
 	if err != nil {
 		return
 	}
-	resp.RawBody = buffer.Next(size)
+	resp.RawBody, err = readBytes(buffer, size)
+	if err != nil {
+		return
+	}
 
+	// 旧版本的数据无zstd
+	if buffer.Len() == 0 {
+		return
+	}
+	size, err = readUint32ToInt(buffer)
+	if err != nil {
+		return
+	}
+	zstdBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
+	resp.setEncodedBody(compress.EncodingZstd, zstdBuf)
+
+	// 无其它编码的数据
+	if buffer.Len() == 0 {
+		return
+	}
+	err = resp.encodedBodiesFromBuffer(buffer)
+	if err != nil {
+		return
+	}
+
+	// 未指定预先压缩的编码
+	if buffer.Len() == 0 {
+		return
+	}
+	size, err = readUint32ToInt(buffer)
+	if err != nil {
+		return
+	}
+	compressEncodingsBuf, err := readBytes(buffer, size)
+	if err != nil {
+		return
+	}
+	if len(compressEncodingsBuf) != 0 {
+		resp.CompressEncodings = strings.Split(string(compressEncodingsBuf), ",")
+	}
+	return
+}
+
+// legacyEncodings 固定位置保存的编码数据
+var legacyEncodings = []string{
+	compress.EncodingGzip,
+	compress.EncodingBrotli,
+	compress.EncodingZstd,
+}
+
+func isLegacyEncoding(encoding string) bool {
+	for _, item := range legacyEncodings {
+		if item == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// encodedBodiesToBytes convert the encoded bodies(exclude legacy encodings) to bytes,
+// the format is: count, [name size, name, body size, body]...
+func (resp *HTTPResponse) encodedBodiesToBytes() []byte {
+	encodings := make([]string, 0, len(resp.EncodedBodies))
+	for encoding, body := range resp.EncodedBodies {
+		if len(body) == 0 || isLegacyEncoding(encoding) {
+			continue
+		}
+		encodings = append(encodings, encoding)
+	}
+	if len(encodings) == 0 {
+		return nil
+	}
+	sort.Strings(encodings)
+	arr := make([][]byte, 0, 4*len(encodings)+1)
+	arr = append(arr, uint32ToBytes(len(encodings)))
+	for _, encoding := range encodings {
+		body := resp.EncodedBodies[encoding]
+		arr = append(arr,
+			uint32ToBytes(len(encoding)),
+			[]byte(encoding),
+			uint32ToBytes(len(body)),
+			body,
+		)
+	}
+	return bytes.Join(arr, []byte(""))
+}
+
+// encodedBodiesFromBuffer read the encoded bodies(exclude legacy encodings) from buffer,
+// the encoding which is not registered is also kept
+func (resp *HTTPResponse) encodedBodiesFromBuffer(buffer *bytes.Buffer) (err error) {
+	count, err := readUint32ToInt(buffer)
+	if err != nil {
+		return
+	}
+	for i := 0; i < count; i++ {
+		size, err := readUint32ToInt(buffer)
+		if err != nil {
+			return err
+		}
+		encodingBuf, err := readBytes(buffer, size)
+		if err != nil {
+			return err
+		}
+		size, err = readUint32ToInt(buffer)
+		if err != nil {
+			return err
+		}
+		body, err := readBytes(buffer, size)
+		if err != nil {
+			return err
+		}
+		resp.setEncodedBody(string(encodingBuf), body)
+	}
 	return
 }
 
+// Size get the size of http response's body
+func (resp *HTTPResponse) Size() int {
+	size := len(resp.RawBody)
+	for _, body := range resp.EncodedBodies {
+		size += len(body)
+	}
+	return size
+}
+
+// GetVary get the vary header list of http response,
+// Accept-Encoding is ignored because the encoding is selected by pike
+func (resp *HTTPResponse) GetVary() []string {
+	result := make([]string, 0)
+	for _, value := range resp.Header.Values(headerVary) {
+		for _, item := range strings.Split(value, ",") {
+			name := http.CanonicalHeaderKey(strings.TrimSpace(item))
+			if name == "" || name == elton.HeaderAcceptEncoding {
+				continue
+			}
+			exists := false
+			for _, v := range result {
+				if v == name {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				result = append(result, name)
+			}
+		}
+	}
+	return result
+}
+
+// HasValidator check the response has ETag or Last-Modified
+func (resp *HTTPResponse) HasValidator() bool {
+	return resp.Header.Get(elton.HeaderETag) != "" ||
+		resp.Header.Get(elton.HeaderLastModified) != ""
+}
+
+// SetConditionalHeader set If-None-Match and If-Modified-Since of request header
+// from the ETag and Last-Modified of response
+func (resp *HTTPResponse) SetConditionalHeader(header http.Header) {
+	if etag := resp.Header.Get(elton.HeaderETag); etag != "" {
+		header.Set(elton.HeaderIfNoneMatch, etag)
+	}
+	if lastModified := resp.Header.Get(elton.HeaderLastModified); lastModified != "" {
+		header.Set(elton.HeaderIfModifiedSince, lastModified)
+	}
+}
+
+// Refresh create a new response with the header of 304 response,
+// the body is shared with the original response and not compressed again
+func (resp *HTTPResponse) Refresh(header http.Header) *HTTPResponse {
+	newResp := *resp
+	newResp.Header = resp.Header.Clone()
+	if newResp.Header == nil {
+		newResp.Header = make(http.Header)
+	}
+	for key, values := range cloneHeaderAndIgnore(header) {
+		newResp.Header[key] = values
+	}
+	return &newResp
+}
+
+// isNoTransform check the response is no-transform, it should not be compressed
+func (resp *HTTPResponse) isNoTransform() bool {
+	values := resp.Header.Values(elton.HeaderCacheControl)
+	if len(values) == 0 {
+		return false
+	}
+	return cachecontrol.ParseResponse(values...).NoTransform
+}
+
 func (resp *HTTPResponse) shouldCompressed() bool {
+	// no-transform的响应不压缩
+	if resp.isNoTransform() {
+		return false
+	}
 	// 如果数据都小于最小压缩长度，则表示无需压缩
-	if len(resp.RawBody) <= resp.CompressMinLength &&
-		len(resp.GzipBody) <= resp.CompressMinLength &&
-		len(resp.BrBody) <= resp.CompressMinLength {
+	maxLength := len(resp.RawBody)
+	for _, body := range resp.EncodedBodies {
+		if len(body) > maxLength {
+			maxLength = len(body)
+		}
+	}
+	if maxLength <= resp.CompressMinLength {
 		return false
 	}
 	filter := resp.CompressContentTypeFilter
@@ -241,31 +501,63 @@ func (resp *HTTPResponse) shouldCompressed() bool {
 	return filter.MatchString(resp.Header.Get(elton.HeaderContentType))
 }
 
+// getCompressEncodings get the encodings to compress, the default encodings are returned if it is not set
+func (resp *HTTPResponse) getCompressEncodings() []string {
+	if len(resp.CompressEncodings) == 0 {
+		return compress.DefaultEncodings
+	}
+	return resp.CompressEncodings
+}
+
+// isCompressed check the response has been compressed to all compress encodings
+func (resp *HTTPResponse) isCompressed() bool {
+	for _, encoding := range resp.getCompressEncodings() {
+		if len(resp.getEncodedBody(encoding)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// needCompress check the response should be compressed and is not compressed
+func (resp *HTTPResponse) needCompress() bool {
+	if resp.isCompressed() {
+		return false
+	}
+	return resp.shouldCompressed()
+}
+
 // GetRawBody get raw body of http response(not compress)
 func (resp *HTTPResponse) GetRawBody() (rawBody []byte, err error) {
 	rawBody = resp.RawBody
 	if len(rawBody) != 0 {
 		return
 	}
-	compressSrv := compress.Get("")
-	// 原始数据为空，需要从gzip或br中解压
-	if len(resp.GzipBody) != 0 {
-		return compressSrv.Gunzip(resp.GzipBody)
+	// 原始数据为空，需要从已注册编码的数据中解压
+	encodings := make([]string, 0, len(resp.EncodedBodies))
+	for encoding, body := range resp.EncodedBodies {
+		if len(body) != 0 && compress.GetEncoder(encoding) != nil {
+			encodings = append(encodings, encoding)
+		}
 	}
-	if len(resp.BrBody) != 0 {
-		return compressSrv.BrotliDecode(resp.BrBody)
+	if len(encodings) == 0 {
+		return
 	}
-	return
+	// 保证每次选择的编码一致
+	sort.Strings(encodings)
+	encoding := encodings[0]
+	return compress.Get("").Decompress(encoding, resp.EncodedBodies[encoding])
 }
 
-// Compress compress http response's data
+// Compress compress http response's data to the compress encodings,
+// the encoded bodies is replaced by a new map, so it is safe for the copy of response
 func (resp *HTTPResponse) Compress() (err error) {
 	// 如果数据不需要压缩，则直接返回
 	if !resp.shouldCompressed() {
 		return
 	}
-	// 如果gzip与br均已压缩
-	if len(resp.GzipBody) != 0 && len(resp.BrBody) != 0 {
+	// 如果预先压缩的编码均已压缩
+	if resp.isCompressed() {
 		return
 	}
 	rawBody, err := resp.GetRawBody()
@@ -278,37 +570,55 @@ func (resp *HTTPResponse) Compress() (err error) {
 		return
 	}
 	compressSrv := compress.Get(resp.CompressSrv)
-	if len(resp.GzipBody) == 0 {
-		resp.GzipBody, err = compressSrv.Gzip(rawBody)
-		if err != nil {
-			return
+	encodings := resp.getCompressEncodings()
+	bodies := make(map[string][]byte, len(encodings))
+	for encoding, body := range resp.EncodedBodies {
+		bodies[encoding] = body
+	}
+	for _, encoding := range encodings {
+		if len(bodies[encoding]) != 0 {
+			continue
 		}
-	}
-	if len(resp.BrBody) == 0 {
-		resp.BrBody, err = compressSrv.Brotli(rawBody)
+		bodies[encoding], err = compressSrv.Encode(encoding, rawBody)
 		if err != nil {
 			return
 		}
 	}
+	resp.EncodedBodies = bodies
 	// 压缩后清空原始数据，因为基本所有的客户端都支持gzip，
 	// 没必要再保存原始数据，如果有需要，可以从gzip中解压
 	resp.RawBody = nil
 	return
 }
 
-func (resp *HTTPResponse) getBodyByAcceptEncoding(acceptEncoding string) (encoding string, body []byte, err error) {
-	compressSrv := compress.Get(resp.CompressSrv)
+// getEncodedBody get the encoded body of encoding
+func (resp *HTTPResponse) getEncodedBody(encoding string) []byte {
+	return resp.EncodedBodies[encoding]
+}
 
-	// 如果支持br，而且br有数据
-	acceptBr := strings.Contains(acceptEncoding, compress.EncodingBrotli)
-	if acceptBr && len(resp.BrBody) != 0 {
-		return compress.EncodingBrotli, resp.BrBody, nil
+// setEncodedBody set the encoded body of encoding, empty body is ignored
+func (resp *HTTPResponse) setEncodedBody(encoding string, body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	if resp.EncodedBodies == nil {
+		resp.EncodedBodies = make(map[string][]byte)
 	}
+	resp.EncodedBodies[encoding] = body
+}
 
-	// 如果支持gzip，而且gzip有数据
-	acceptGzip := strings.Contains(acceptEncoding, compress.EncodingGzip)
-	if acceptGzip && len(resp.GzipBody) != 0 {
-		return compress.EncodingGzip, resp.GzipBody, nil
+// getBodyByAcceptEncoding get the body by the Accept-Encoding of client and
+// the preference order of encodings(default is br, zstd, gzip), if the identity is refused,
+// the body is encoded on demand and ErrNotAcceptable is returned only if no registered encoder is acceptable
+func (resp *HTTPResponse) getBodyByAcceptEncoding(acceptEncoding string, preferences ...string) (encoding string, body []byte, err error) {
+	encodings, identity := compress.Negotiate(acceptEncoding, preferences)
+
+	// 如果客户端支持的编码已有压缩数据，优先返回
+	for _, item := range encodings {
+		body := resp.getEncodedBody(item)
+		if len(body) != 0 {
+			return item, body, nil
+		}
 	}
 
 	// 获取原始数据压缩
@@ -316,44 +626,72 @@ func (resp *HTTPResponse) getBodyByAcceptEncoding(acceptEncoding string) (encodi
 	if err != nil {
 		return "", nil, err
 	}
-	shouldCompressed := resp.shouldCompressed()
-	// 数据不应该压缩，直接返回
-	if !shouldCompressed {
-		return "", rawBody, nil
-	}
-
-	// 支持br，数据从原始数据压缩
-	if acceptBr {
-		brBody, err := compressSrv.Brotli(rawBody)
-		if err != nil {
-			return "", nil, err
+	if identity || len(rawBody) == 0 {
+		// 数据不应该压缩或客户端不支持压缩，直接返回
+		if len(encodings) == 0 || !resp.shouldCompressed() {
+			return "", rawBody, nil
 		}
-		return compress.EncodingBrotli, brBody, nil
-	}
-
-	// 支持gzip，数据从原始数据压缩
-	if acceptGzip {
-		gzipBody, err := compressSrv.Gzip(rawBody)
-		if err != nil {
-			return "", nil, err
+	} else {
+		// 客户端不接受identity，则使用可接受的编码按需压缩，
+		// 优先顺序中无可接受的编码时，从所有已注册的编码中选择
+		if len(encodings) == 0 {
+			encodings, _ = compress.Negotiate(acceptEncoding, compress.Encoders())
+		}
+		// no-transform的响应不可压缩
+		if len(encodings) == 0 || resp.isNoTransform() {
+			return "", nil, ErrNotAcceptable
 		}
-		return compress.EncodingGzip, gzipBody, nil
 	}
 
-	// 都不支持，返回原始数据
-	return "", rawBody, nil
+	// 使用客户端支持的最优编码从原始数据压缩
+	encoding = encodings[0]
+	body, err = compress.Get(resp.CompressSrv).Encode(encoding, rawBody)
+	if err != nil {
+		return "", nil, err
+	}
+	return encoding, body, nil
 }
 
-// Fill fill response to context
-func (resp *HTTPResponse) Fill(c *elton.Context) (err error) {
-	encoding, body, err := resp.getBodyByAcceptEncoding(c.GetRequestHeader(elton.HeaderAcceptEncoding))
+// Fill fill response to context, the encodings is the preference order of server
+func (resp *HTTPResponse) Fill(c *elton.Context, encodings ...string) (err error) {
+	encoding, body, err := resp.getBodyByAcceptEncoding(c.GetRequestHeader(elton.HeaderAcceptEncoding), encodings...)
 	if err != nil {
 		return
 	}
 	c.MergeHeader(resp.Header)
+	// 可压缩（或按需压缩）的响应根据Accept-Encoding返回不同的数据
+	if encoding != "" || resp.isEncodingVaried() {
+		addVary(c.Header(), elton.HeaderAcceptEncoding)
+	}
 	c.SetHeader(elton.HeaderContentEncoding, encoding)
 	c.StatusCode = resp.StatusCode
 
 	c.BodyBuffer = bytes.NewBuffer(body)
 	return
 }
+
+// isEncodingVaried check the body of response is selected by Accept-Encoding
+func (resp *HTTPResponse) isEncodingVaried() bool {
+	if resp.shouldCompressed() {
+		return true
+	}
+	for _, body := range resp.EncodedBodies {
+		if len(body) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// addVary add the name to Vary header if it is not exists
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values(headerVary) {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "*" || strings.EqualFold(item, name) {
+				return
+			}
+		}
+	}
+	header.Add(headerVary, name)
+}
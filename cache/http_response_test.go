@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"bytes"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -39,9 +40,12 @@ func TestHTTPResponseMarshal(t *testing.T) {
 		CompressContentTypeFilter: regexp.MustCompile(`a|b|c`),
 		Header:                    header,
 		StatusCode:                200,
-		GzipBody:                  []byte("gzip"),
-		BrBody:                    []byte("br"),
 		RawBody:                   []byte("raw"),
+		EncodedBodies: map[string][]byte{
+			"gzip": []byte("gzip"),
+			"br":   []byte("br"),
+			"zstd": []byte("zstd"),
+		},
 	}
 	data, err := resp.Bytes()
 	assert.Nil(err)
@@ -49,17 +53,110 @@ func TestHTTPResponseMarshal(t *testing.T) {
 	newResp := &HTTPResponse{}
 	err = newResp.FromBytes(data)
 	assert.Nil(err)
+	assert.Equal(resp.EncodedBodies["zstd"], newResp.EncodedBodies["zstd"])
+	assert.Nil(newResp.CompressEncodings)
+
+	// 预先压缩的编码
+	resp.CompressEncodings = []string{
+		"br",
+		"gzip",
+	}
+	encodingsData, err := resp.Bytes()
+	assert.Nil(err)
+	encodingsResp := &HTTPResponse{}
+	err = encodingsResp.FromBytes(encodingsData)
+	assert.Nil(err)
+	assert.Equal(resp.CompressEncodings, encodingsResp.CompressEncodings)
+	assert.Equal(resp.EncodedBodies, encodingsResp.EncodedBodies)
+	resp.CompressEncodings = nil
+
+	// 响应数据不使用envelope
+	_, legacy, err := openEnvelope(data)
+	assert.Nil(err)
+	assert.True(legacy)
+
+	// 旧版本的数据无zstd
+	legacyResp := &HTTPResponse{}
+	err = legacyResp.FromBytes(data[:len(data)-8])
+	assert.Nil(err)
+	assert.Equal(resp.RawBody, legacyResp.RawBody)
+	assert.Empty(legacyResp.EncodedBodies["zstd"])
 
 	assert.Equal(resp.CompressSrv, newResp.CompressSrv)
 	assert.Equal(resp.CompressMinLength, newResp.CompressMinLength)
 	assert.Equal(resp.CompressContentTypeFilter, newResp.CompressContentTypeFilter)
 	assert.Equal(resp.Header, newResp.Header)
 	assert.Equal(resp.StatusCode, newResp.StatusCode)
-	assert.Equal(resp.GzipBody, newResp.GzipBody)
-	assert.Equal(resp.BrBody, newResp.BrBody)
+	assert.Equal(resp.EncodedBodies["gzip"], newResp.EncodedBodies["gzip"])
+	assert.Equal(resp.EncodedBodies["br"], newResp.EncodedBodies["br"])
 	assert.Equal(resp.RawBody, newResp.RawBody)
 }
 
+func TestHTTPResponseMarshalEncodedBodies(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		StatusCode: 200,
+		Header:     http.Header{},
+		EncodedBodies: map[string][]byte{
+			"gzip": []byte("gzip"),
+			// 未注册的编码也保存
+			"x-custom": []byte("custom"),
+			"deflate":  []byte("deflate"),
+			"empty":    nil,
+		},
+	}
+	data, err := resp.Bytes()
+	assert.Nil(err)
+
+	newResp := &HTTPResponse{}
+	err = newResp.FromBytes(data)
+	assert.Nil(err)
+	assert.Equal(map[string][]byte{
+		"gzip":     []byte("gzip"),
+		"x-custom": []byte("custom"),
+		"deflate":  []byte("deflate"),
+	}, newResp.EncodedBodies)
+
+	// 固定位置的数据与旧版本一致，旧版本读取时忽略其它编码的数据
+	legacyData, err := (&HTTPResponse{
+		StatusCode: 200,
+		Header:     http.Header{},
+		EncodedBodies: map[string][]byte{
+			"gzip": []byte("gzip"),
+		},
+	}).Bytes()
+	assert.Nil(err)
+	assert.True(bytes.HasPrefix(data, legacyData))
+}
+
+func TestHTTPResponseSize(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		RawBody: []byte("raw"),
+		EncodedBodies: map[string][]byte{
+			"gzip": []byte("gzip"),
+			"br":   []byte("br"),
+			"zstd": []byte("zstd"),
+		},
+	}
+	assert.Equal(13, resp.Size())
+}
+
+func TestHTTPResponseGetVary(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		Header: http.Header{},
+	}
+	assert.Empty(resp.GetVary())
+
+	resp.Header.Add("Vary", "Accept-Encoding, accept-language")
+	resp.Header.Add("Vary", "X-Device,Accept-Language")
+	assert.Equal([]string{
+		"Accept-Language",
+		"X-Device",
+	}, resp.GetVary())
+}
+
 func TestNewHTTPResponse(t *testing.T) {
 	assert := assert.New(t)
 	data := []byte("Hello world!")
@@ -75,7 +172,7 @@ func TestNewHTTPResponse(t *testing.T) {
 			header:     http.Header{},
 			encoding:   compress.EncodingGzip,
 			fn: func() ([]byte, error) {
-				return compressSrv.Gzip(data)
+				return compressSrv.Encode(compress.EncodingGzip, data)
 			},
 		},
 		{
@@ -83,7 +180,15 @@ func TestNewHTTPResponse(t *testing.T) {
 			header:     http.Header{},
 			encoding:   compress.EncodingBrotli,
 			fn: func() ([]byte, error) {
-				return compressSrv.Brotli(data)
+				return compressSrv.Encode(compress.EncodingBrotli, data)
+			},
+		},
+		{
+			statusCode: 200,
+			header:     http.Header{},
+			encoding:   compress.EncodingZstd,
+			fn: func() ([]byte, error) {
+				return compressSrv.Encode(compress.EncodingZstd, data)
 			},
 		},
 		{
@@ -106,17 +211,21 @@ func TestNewHTTPResponse(t *testing.T) {
 		assert.Equal(tt.statusCode, resp.StatusCode)
 		switch tt.encoding {
 		case compress.EncodingGzip:
-			assert.NotNil(resp.GzipBody)
+			assert.NotNil(resp.EncodedBodies["gzip"])
 			assert.Nil(resp.RawBody)
-			assert.Nil(resp.BrBody)
+			assert.Nil(resp.EncodedBodies["br"])
 		case compress.EncodingBrotli:
-			assert.NotNil(resp.BrBody)
-			assert.Nil(resp.GzipBody)
+			assert.NotNil(resp.EncodedBodies["br"])
+			assert.Nil(resp.EncodedBodies["gzip"])
+			assert.Nil(resp.RawBody)
+		case compress.EncodingZstd:
+			assert.NotNil(resp.EncodedBodies["zstd"])
+			assert.Nil(resp.EncodedBodies["gzip"])
 			assert.Nil(resp.RawBody)
 		default:
 			assert.NotNil(resp.RawBody)
-			assert.Nil(resp.GzipBody)
-			assert.Nil(resp.BrBody)
+			assert.Nil(resp.EncodedBodies["gzip"])
+			assert.Nil(resp.EncodedBodies["br"])
 		}
 	}
 }
@@ -162,13 +271,24 @@ func TestShouldCompressed(t *testing.T) {
 			brBody:           data,
 			shouldCompressed: true,
 		},
+		// no-transform的响应不压缩
+		{
+			header: http.Header{
+				elton.HeaderContentType:  []string{"application/json"},
+				elton.HeaderCacheControl: []string{"max-age=60, no-transform"},
+			},
+			rawBody:          data,
+			shouldCompressed: false,
+		},
 	}
 	for _, tt := range tests {
 		resp := &HTTPResponse{
-			Header:            tt.header,
-			RawBody:           tt.rawBody,
-			GzipBody:          tt.gzipBody,
-			BrBody:            tt.brBody,
+			Header:  tt.header,
+			RawBody: tt.rawBody,
+			EncodedBodies: map[string][]byte{
+				"gzip": tt.gzipBody,
+				"br":   tt.brBody,
+			},
 			CompressMinLength: 1,
 		}
 		result := resp.shouldCompressed()
@@ -180,15 +300,18 @@ func TestGetRawBody(t *testing.T) {
 	assert := assert.New(t)
 	compressSrv := compress.Get("")
 	data := []byte("Hello world!")
-	gzipData, err := compressSrv.Gzip(data)
+	gzipData, err := compressSrv.Encode(compress.EncodingGzip, data)
+	assert.Nil(err)
+	brData, err := compressSrv.Encode(compress.EncodingBrotli, data)
 	assert.Nil(err)
-	brData, err := compressSrv.Brotli(data)
+	zstdData, err := compressSrv.Encode(compress.EncodingZstd, data)
 	assert.Nil(err)
 
 	tests := []struct {
 		rawBody  []byte
 		gzipBody []byte
 		brBody   []byte
+		zstdBody []byte
 	}{
 		{
 			rawBody: data,
@@ -199,12 +322,18 @@ func TestGetRawBody(t *testing.T) {
 		{
 			brBody: brData,
 		},
+		{
+			zstdBody: zstdData,
+		},
 	}
 	for _, tt := range tests {
 		resp := &HTTPResponse{
-			RawBody:  tt.rawBody,
-			BrBody:   tt.brBody,
-			GzipBody: tt.gzipBody,
+			RawBody: tt.rawBody,
+			EncodedBodies: map[string][]byte{
+				"br":   tt.brBody,
+				"gzip": tt.gzipBody,
+				"zstd": tt.zstdBody,
+			},
 		}
 		rawBody, err := resp.GetRawBody()
 		assert.Nil(err)
@@ -216,9 +345,11 @@ func TestCompress(t *testing.T) {
 	assert := assert.New(t)
 	data := []byte("Hello world!")
 	compressSrv := compress.Get("")
-	gzipData, err := compressSrv.Gzip(data)
+	gzipData, err := compressSrv.Encode(compress.EncodingGzip, data)
 	assert.Nil(err)
-	brData, err := compressSrv.Brotli(data)
+	brData, err := compressSrv.Encode(compress.EncodingBrotli, data)
+	assert.Nil(err)
+	zstdData, err := compressSrv.Encode(compress.EncodingZstd, data)
 	assert.Nil(err)
 
 	tests := []struct {
@@ -239,33 +370,75 @@ func TestCompress(t *testing.T) {
 			Header: http.Header{
 				elton.HeaderContentType: []string{"application/json"},
 			},
-			RawBody:           tt.rawBody,
-			GzipBody:          tt.gzipBody,
-			BrBody:            tt.brBody,
+			RawBody: tt.rawBody,
+			EncodedBodies: map[string][]byte{
+				"gzip": tt.gzipBody,
+				"br":   tt.brBody,
+			},
 			CompressMinLength: 1,
 		}
 		err := resp.Compress()
 		assert.Nil(err)
 		assert.Nil(resp.RawBody)
-		assert.Equal(gzipData, resp.GzipBody)
-		assert.Equal(brData, resp.BrBody)
+		assert.Equal(gzipData, resp.EncodedBodies["gzip"])
+		assert.Equal(brData, resp.EncodedBodies["br"])
+		assert.Equal(zstdData, resp.EncodedBodies["zstd"])
+	}
+
+	// 压缩数据保存至新的map，不影响复制前的响应
+	resp := &HTTPResponse{
+		Header: http.Header{
+			elton.HeaderContentType: []string{"application/json"},
+		},
+		EncodedBodies: map[string][]byte{
+			"gzip": gzipData,
+		},
+		CompressMinLength: 1,
+	}
+	compressedResp := *resp
+	err = compressedResp.Compress()
+	assert.Nil(err)
+	assert.Equal(1, len(resp.EncodedBodies))
+	assert.Equal(3, len(compressedResp.EncodedBodies))
+
+	// 只压缩指定的编码
+	resp = &HTTPResponse{
+		Header: http.Header{
+			elton.HeaderContentType: []string{"application/json"},
+		},
+		RawBody:           data,
+		CompressMinLength: 1,
+		CompressEncodings: []string{
+			"gzip",
+		},
 	}
+	assert.True(resp.needCompress())
+	err = resp.Compress()
+	assert.Nil(err)
+	assert.Equal(map[string][]byte{
+		"gzip": gzipData,
+	}, resp.EncodedBodies)
+	assert.False(resp.needCompress())
 }
 
 func TestGetBodyByAcceptEncoding(t *testing.T) {
 	assert := assert.New(t)
 	data := []byte("Hello world!")
 	compressSrv := compress.Get("")
-	gzipData, err := compressSrv.Gzip(data)
+	gzipData, err := compressSrv.Encode(compress.EncodingGzip, data)
+	assert.Nil(err)
+	brData, err := compressSrv.Encode(compress.EncodingBrotli, data)
 	assert.Nil(err)
-	brData, err := compressSrv.Brotli(data)
+	zstdData, err := compressSrv.Encode(compress.EncodingZstd, data)
 	assert.Nil(err)
 
 	tests := []struct {
 		rawBody        []byte
 		gzipBody       []byte
 		brBody         []byte
+		zstdBody       []byte
 		acceptEncoding string
+		encodings      []string
 		minLength      int
 		resultEncoding string
 		result         []byte
@@ -328,18 +501,74 @@ func TestGetBodyByAcceptEncoding(t *testing.T) {
 			resultEncoding: "",
 			result:         data,
 		},
+		// 支持zstd且已存在zstd
+		{
+			zstdBody:       zstdData,
+			acceptEncoding: compress.EncodingZstd,
+			resultEncoding: compress.EncodingZstd,
+			result:         zstdData,
+		},
+		// 支持zstd，压缩后返回
+		{
+			rawBody:        data,
+			acceptEncoding: compress.EncodingZstd,
+			resultEncoding: compress.EncodingZstd,
+			result:         zstdData,
+		},
+		// 均已压缩，默认优先返回br
+		{
+			gzipBody:       gzipData,
+			brBody:         brData,
+			zstdBody:       zstdData,
+			acceptEncoding: "gzip, br, zstd",
+			resultEncoding: compress.EncodingBrotli,
+			result:         brData,
+		},
+		// 均已压缩，按q值返回
+		{
+			gzipBody:       gzipData,
+			brBody:         brData,
+			zstdBody:       zstdData,
+			acceptEncoding: "gzip;q=0.5, br;q=0.8, zstd",
+			resultEncoding: compress.EncodingZstd,
+			result:         zstdData,
+		},
+		// 均已压缩，按服务端的优先顺序返回
+		{
+			gzipBody:       gzipData,
+			brBody:         brData,
+			zstdBody:       zstdData,
+			acceptEncoding: "gzip, br, zstd",
+			encodings: []string{
+				compress.EncodingZstd,
+				compress.EncodingGzip,
+			},
+			resultEncoding: compress.EncodingZstd,
+			result:         zstdData,
+		},
+		// br的q值为0表示不接受，从原始数据压缩为gzip
+		{
+			rawBody:        data,
+			brBody:         brData,
+			acceptEncoding: "gzip, br;q=0",
+			resultEncoding: compress.EncodingGzip,
+			result:         gzipData,
+		},
 	}
 	for _, tt := range tests {
 		resp := &HTTPResponse{
 			Header: http.Header{
 				elton.HeaderContentType: []string{"application/json"},
 			},
-			RawBody:           tt.rawBody,
-			GzipBody:          tt.gzipBody,
-			BrBody:            tt.brBody,
+			RawBody: tt.rawBody,
+			EncodedBodies: map[string][]byte{
+				"gzip": tt.gzipBody,
+				"br":   tt.brBody,
+				"zstd": tt.zstdBody,
+			},
 			CompressMinLength: tt.minLength,
 		}
-		encoding, body, err := resp.getBodyByAcceptEncoding(tt.acceptEncoding)
+		encoding, body, err := resp.getBodyByAcceptEncoding(tt.acceptEncoding, tt.encodings...)
 		assert.Nil(err)
 		assert.Equal(tt.resultEncoding, encoding)
 		assert.Equal(tt.result, body)
@@ -350,9 +579,9 @@ func TestFill(t *testing.T) {
 	assert := assert.New(t)
 	data := []byte("Hello world!")
 	compressSrv := compress.Get("")
-	gzipData, err := compressSrv.Gzip(data)
+	gzipData, err := compressSrv.Encode(compress.EncodingGzip, data)
 	assert.Nil(err)
-	brData, err := compressSrv.Brotli(data)
+	brData, err := compressSrv.Encode(compress.EncodingBrotli, data)
 	assert.Nil(err)
 
 	tests := []struct {
@@ -399,6 +628,169 @@ func TestFill(t *testing.T) {
 	}
 }
 
+func TestGetBodyByAcceptEncodingNotAcceptable(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte("Hello world!")
+	gzipData, err := compress.Get("").Encode(compress.EncodingGzip, data)
+	assert.Nil(err)
+
+	tests := []struct {
+		header         http.Header
+		rawBody        []byte
+		gzipBody       []byte
+		acceptEncoding string
+		resultEncoding string
+		result         []byte
+		err            error
+	}{
+		// gzip的q值为0，返回原始数据
+		{
+			gzipBody:       gzipData,
+			acceptEncoding: "gzip;q=0",
+			resultEncoding: "",
+			result:         data,
+		},
+		// 不接受identity，但可使用*匹配的编码
+		{
+			rawBody:        data,
+			acceptEncoding: "*, identity;q=0",
+			resultEncoding: compress.EncodingBrotli,
+		},
+		// 不接受identity且无可接受的编码
+		{
+			gzipBody:       gzipData,
+			acceptEncoding: "gzip;q=0, identity;q=0",
+			err:            ErrNotAcceptable,
+		},
+		{
+			rawBody:        data,
+			acceptEncoding: "deflate, *;q=0",
+			err:            ErrNotAcceptable,
+		},
+		// 数据不需压缩，但不接受identity，则按需压缩
+		{
+			header: http.Header{
+				elton.HeaderContentType: []string{"image/png"},
+			},
+			rawBody:        data,
+			acceptEncoding: "gzip, identity;q=0",
+			resultEncoding: compress.EncodingGzip,
+			result:         gzipData,
+		},
+		// 优先顺序中无可接受的编码，使用其它已注册的编码
+		{
+			rawBody:        data,
+			acceptEncoding: "lz4, identity;q=0",
+			resultEncoding: compress.EncodingLZ4,
+		},
+		// no-transform的响应不可压缩
+		{
+			header: http.Header{
+				elton.HeaderContentType: []string{"application/json"},
+				"Cache-Control":         []string{"no-transform"},
+			},
+			rawBody:        data,
+			acceptEncoding: "gzip, identity;q=0",
+			err:            ErrNotAcceptable,
+		},
+		// 无数据的响应不返回406
+		{
+			acceptEncoding: "identity;q=0",
+			resultEncoding: "",
+		},
+	}
+	for _, tt := range tests {
+		header := tt.header
+		if header == nil {
+			header = http.Header{
+				elton.HeaderContentType: []string{"application/json"},
+			}
+		}
+		resp := &HTTPResponse{
+			Header:  header,
+			RawBody: tt.rawBody,
+			EncodedBodies: map[string][]byte{
+				"gzip": tt.gzipBody,
+			},
+		}
+		encoding, body, err := resp.getBodyByAcceptEncoding(tt.acceptEncoding)
+		assert.Equal(tt.err, err, tt.acceptEncoding)
+		assert.Equal(tt.resultEncoding, encoding, tt.acceptEncoding)
+		if tt.result != nil {
+			assert.Equal(tt.result, body)
+		}
+	}
+}
+
+func TestFillVary(t *testing.T) {
+	assert := assert.New(t)
+	data := []byte("Hello world!")
+
+	tests := []struct {
+		header http.Header
+		vary   []string
+	}{
+		// 可压缩的数据
+		{
+			header: http.Header{
+				elton.HeaderContentType: []string{"application/json"},
+			},
+			vary: []string{
+				"Accept-Encoding",
+			},
+		},
+		// 已有vary
+		{
+			header: http.Header{
+				elton.HeaderContentType: []string{"application/json"},
+				"Vary":                  []string{"accept-encoding"},
+			},
+			vary: []string{
+				"accept-encoding",
+			},
+		},
+		{
+			header: http.Header{
+				elton.HeaderContentType: []string{"application/json"},
+				"Vary":                  []string{"Accept-Language"},
+			},
+			vary: []string{
+				"Accept-Language",
+				"Accept-Encoding",
+			},
+		},
+		// 不可压缩的数据
+		{
+			header: http.Header{
+				elton.HeaderContentType: []string{"image/png"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		resp := &HTTPResponse{
+			Header:     tt.header,
+			RawBody:    data,
+			StatusCode: 200,
+		}
+		c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		err := resp.Fill(c)
+		assert.Nil(err)
+		assert.Equal(tt.vary, c.Header().Values("Vary"))
+	}
+
+	resp := &HTTPResponse{
+		Header: http.Header{
+			elton.HeaderContentType: []string{"application/json"},
+		},
+		RawBody:    data,
+		StatusCode: 200,
+	}
+	c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	c.SetRequestHeader(elton.HeaderAcceptEncoding, "identity;q=0")
+	err := resp.Fill(c)
+	assert.Equal(ErrNotAcceptable, err)
+}
+
 func BenchmarkMarshalHTTPResponse(b *testing.B) {
 	resp := &HTTPResponse{
 		CompressSrv:       "compress",
@@ -411,8 +803,10 @@ func BenchmarkMarshalHTTPResponse(b *testing.B) {
 				`"60-R79m3yeTgBMQWG5Ysx2j_T3gIsM="`,
 			},
 		},
-		GzipBody: make([]byte, 5*1024),
-		BrBody:   make([]byte, 5*1024),
+		EncodedBodies: map[string][]byte{
+			"gzip": make([]byte, 5*1024),
+			"br":   make([]byte, 5*1024),
+		},
 	}
 	for i := 0; i < b.N; i++ {
 		buf, err := json.Marshal(resp)
@@ -435,8 +829,10 @@ func BenchmarkHTTPResponseToBytes(b *testing.B) {
 				`"60-R79m3yeTgBMQWG5Ysx2j_T3gIsM="`,
 			},
 		},
-		GzipBody: make([]byte, 5*1024),
-		BrBody:   make([]byte, 5*1024),
+		EncodedBodies: map[string][]byte{
+			"gzip": make([]byte, 5*1024),
+			"br":   make([]byte, 5*1024),
+		},
 	}
 	for i := 0; i < b.N; i++ {
 		buf, err := resp.Bytes()
@@ -445,3 +841,47 @@ func BenchmarkHTTPResponseToBytes(b *testing.B) {
 		}
 	}
 }
+
+func TestHTTPResponseRevalidation(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		StatusCode: 200,
+		Header: http.Header{
+			"Cache-Control": []string{
+				"max-age=60",
+			},
+		},
+		EncodedBodies: map[string][]byte{
+			"gzip": []byte("gzip"),
+			"br":   []byte("br"),
+		},
+	}
+	assert.False(resp.HasValidator())
+	header := make(http.Header)
+	resp.SetConditionalHeader(header)
+	assert.Empty(header)
+
+	resp.Header.Set(elton.HeaderETag, `"123"`)
+	resp.Header.Set(elton.HeaderLastModified, "Mon, 02 Jan 2006 15:04:05 GMT")
+	assert.True(resp.HasValidator())
+	resp.SetConditionalHeader(header)
+	assert.Equal(`"123"`, header.Get(elton.HeaderIfNoneMatch))
+	assert.Equal("Mon, 02 Jan 2006 15:04:05 GMT", header.Get(elton.HeaderIfModifiedSince))
+
+	newResp := resp.Refresh(http.Header{
+		"Cache-Control": []string{
+			"max-age=120",
+		},
+		"Content-Length": []string{
+			"0",
+		},
+	})
+	assert.Equal("max-age=120", newResp.Header.Get(elton.HeaderCacheControl))
+	assert.Equal(`"123"`, newResp.Header.Get(elton.HeaderETag))
+	assert.Empty(newResp.Header.Get(elton.HeaderContentLength))
+	assert.Equal(resp.EncodedBodies["gzip"], newResp.EncodedBodies["gzip"])
+	assert.Equal(resp.EncodedBodies["br"], newResp.EncodedBodies["br"])
+	assert.Equal(200, newResp.StatusCode)
+	// 原响应头不修改
+	assert.Equal("max-age=60", resp.Header.Get(elton.HeaderCacheControl))
+}
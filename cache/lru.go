@@ -0,0 +1,153 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// LRU缓存，与groupcache的lru类似，增加了获取所有缓存的方法，
+// 用于缓存的查询与按条件清除，非并发安全，由调用方加锁
+
+package cache
+
+import (
+	"container/list"
+	"time"
+)
+
+type (
+	lruEntry struct {
+		key string
+		hc  *httpCache
+		// accessedAt 最近访问的时间(纳秒)，用于多个lru之间比较新旧
+		accessedAt int64
+	}
+	// lruCache lru cache of http cache
+	lruCache struct {
+		// maxEntries 最大缓存数量，0表示不限制
+		maxEntries int
+		// onEvicted 淘汰（包括删除）时的回调
+		onEvicted func(key string, hc *httpCache)
+		ll        *list.List
+		items     map[string]*list.Element
+	}
+)
+
+func newLRUCache(maxEntries int) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// get get http cache from lru, and move it to front
+func (c *lruCache) get(key string) (*httpCache, bool) {
+	ele, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(ele)
+	entry := ele.Value.(*lruEntry)
+	entry.accessedAt = time.Now().UnixNano()
+	return entry.hc, true
+}
+
+// add add http cache to lru, the oldest one is removed if the lru is full
+func (c *lruCache) add(key string, hc *httpCache) {
+	now := time.Now().UnixNano()
+	if ele, ok := c.items[key]; ok {
+		c.ll.MoveToFront(ele)
+		entry := ele.Value.(*lruEntry)
+		entry.hc = hc
+		entry.accessedAt = now
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{
+		key:        key,
+		hc:         hc,
+		accessedAt: now,
+	})
+	if c.maxEntries != 0 && c.ll.Len() > c.maxEntries {
+		c.removeOldest()
+	}
+}
+
+// remove remove http cache from lru
+func (c *lruCache) remove(key string) {
+	if ele, ok := c.items[key]; ok {
+		c.removeElement(ele)
+	}
+}
+
+// removeOldest remove the oldest http cache from lru
+func (c *lruCache) removeOldest() {
+	if ele := c.ll.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+// oldest get the oldest http cache which is evictable, the http caches which should be skipped
+// are not counted, only maxScan other http caches are checked, the entry is returned by value
+func (c *lruCache) oldest(maxScan int, skip, evictable func(hc *httpCache) bool) (lruEntry, bool) {
+	count := 0
+	for ele := c.ll.Back(); ele != nil && count < maxScan; ele = ele.Prev() {
+		entry := ele.Value.(*lruEntry)
+		// 跳过的缓存（如无数据）不计入检查的数量
+		if skip(entry.hc) {
+			continue
+		}
+		count++
+		if evictable(entry.hc) {
+			return *entry, true
+		}
+	}
+	return lruEntry{}, false
+}
+
+// peek get the entry of key without moving it to front, the entry is returned by value
+func (c *lruCache) peek(key string) (lruEntry, bool) {
+	ele, ok := c.items[key]
+	if !ok {
+		return lruEntry{}, false
+	}
+	return *ele.Value.(*lruEntry), true
+}
+
+func (c *lruCache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	entry := ele.Value.(*lruEntry)
+	delete(c.items, entry.key)
+	if c.onEvicted != nil {
+		c.onEvicted(entry.key, entry.hc)
+	}
+}
+
+// len get the count of lru
+func (c *lruCache) len() int {
+	return c.ll.Len()
+}
+
+// values get all http cache of lru, from newest to oldest
+func (c *lruCache) values() []*httpCache {
+	result := make([]*httpCache, 0, c.ll.Len())
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		result = append(result, ele.Value.(*lruEntry).hc)
+	}
+	return result
+}
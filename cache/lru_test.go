@@ -0,0 +1,119 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	assert := assert.New(t)
+
+	evictedKeys := make([]string, 0)
+	c := newLRUCache(2)
+	c.onEvicted = func(key string, _ *httpCache) {
+		evictedKeys = append(evictedKeys, key)
+	}
+	hc1 := NewHTTPCache()
+	hc2 := NewHTTPCache()
+	hc3 := NewHTTPCache()
+
+	c.add("1", hc1)
+	c.add("2", hc2)
+	assert.Equal(2, c.len())
+	assert.Equal([]*httpCache{hc2, hc1}, c.values())
+
+	// get会将缓存移至最前
+	hc, ok := c.get("1")
+	assert.True(ok)
+	assert.Equal(hc1, hc)
+	assert.Equal([]*httpCache{hc1, hc2}, c.values())
+
+	// 超出数量淘汰最旧的缓存
+	c.add("3", hc3)
+	assert.Equal(2, c.len())
+	assert.Equal([]string{"2"}, evictedKeys)
+	_, ok = c.get("2")
+	assert.False(ok)
+
+	c.remove("1")
+	assert.Equal([]string{"2", "1"}, evictedKeys)
+	assert.Equal([]*httpCache{hc3}, c.values())
+
+	c.removeOldest()
+	assert.Equal(0, c.len())
+	// 空的lru不会触发淘汰
+	c.removeOldest()
+	assert.Equal([]string{"2", "1", "3"}, evictedKeys)
+}
+
+func TestLRUCacheOldest(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newLRUCache(0)
+	hc1 := NewHTTPCache()
+	hc2 := NewHTTPCache()
+	hc3 := NewHTTPCache()
+	c.add("1", hc1)
+	c.add("2", hc2)
+	c.add("3", hc3)
+
+	isNot := func(hc *httpCache) func(*httpCache) bool {
+		return func(item *httpCache) bool {
+			return item != hc
+		}
+	}
+	skipNone := func(*httpCache) bool {
+		return false
+	}
+	entry, ok := c.oldest(3, skipNone, isNot(nil))
+	assert.True(ok)
+	assert.Equal("1", entry.key)
+	// 跳过不可淘汰的缓存
+	entry, ok = c.oldest(3, skipNone, isNot(hc1))
+	assert.True(ok)
+	assert.Equal("2", entry.key)
+	// 只检查最旧的maxScan个缓存
+	_, ok = c.oldest(1, skipNone, isNot(hc1))
+	assert.False(ok)
+	// 跳过的缓存不计入检查的数量
+	entry, ok = c.oldest(1, func(item *httpCache) bool {
+		return item == hc1
+	}, isNot(nil))
+	assert.True(ok)
+	assert.Equal("2", entry.key)
+
+	// peek不更新访问时间
+	entry, ok = c.peek("1")
+	assert.True(ok)
+	assert.Equal(hc1, entry.hc)
+	assert.Equal([]*httpCache{hc3, hc2, hc1}, c.values())
+	_, ok = c.get("1")
+	assert.True(ok)
+	latest, _ := c.peek("1")
+	assert.GreaterOrEqual(latest.accessedAt, entry.accessedAt)
+	_, ok = c.peek("4")
+	assert.False(ok)
+}
@@ -0,0 +1,93 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cache
+
+import "sync"
+
+const (
+	// defaultPrefetchConcurrency default max number of prefetching
+	defaultPrefetchConcurrency = 10
+	// defaultPrefetchPercent default percent of ttl to prefetch
+	defaultPrefetchPercent = 10
+)
+
+type (
+	// prefetchLimiter the limiter of prefetching, it's shared by all dispatchers
+	prefetchLimiter struct {
+		mu      *sync.Mutex
+		limit   int
+		running int
+	}
+)
+
+var defaultPrefetchLimiter = newPrefetchLimiter(defaultPrefetchConcurrency)
+
+func newPrefetchLimiter(limit int) *prefetchLimiter {
+	return &prefetchLimiter{
+		mu:    &sync.Mutex{},
+		limit: limit,
+	}
+}
+
+// setLimit set the max number of prefetching
+func (l *prefetchLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit
+}
+
+// acquire acquire a prefetching, it returns false if the limit is reached
+func (l *prefetchLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running >= l.limit {
+		return false
+	}
+	l.running++
+	return true
+}
+
+// release release a prefetching
+func (l *prefetchLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running > 0 {
+		l.running--
+	}
+}
+
+// getRunning get the number of running prefetching
+func (l *prefetchLimiter) getRunning() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running
+}
+
+// SetPrefetchConcurrency set the max number of prefetching of all caches,
+// the default value is used if it's less than or equal to 0
+func SetPrefetchConcurrency(limit int) {
+	if limit <= 0 {
+		limit = defaultPrefetchConcurrency
+	}
+	defaultPrefetchLimiter.setLimit(limit)
+}
@@ -0,0 +1,235 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Range请求的处理，对于缓存的完整响应数据，根据Range请求头从原始数据中截取，
+// 返回206(单个或multipart/byteranges)或者416
+
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vicanso/elton"
+)
+
+const (
+	headerRange        = "Range"
+	headerIfRange      = "If-Range"
+	headerContentRange = "Content-Range"
+	headerAcceptRanges = "Accept-Ranges"
+)
+
+var (
+	// errInvalidRange the range is invalid, it should be ignored
+	errInvalidRange = errors.New("invalid range")
+	// errRangeNotSatisfiable the range is not satisfiable
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+type httpRange struct {
+	start  int64
+	length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses the range header(RFC 7233), it returns errInvalidRange if the header is invalid,
+// and returns errRangeNotSatisfiable if none of the ranges overlap the content
+func parseRange(value string, size int64) ([]httpRange, error) {
+	const b = "bytes="
+	if !strings.HasPrefix(value, b) {
+		return nil, errInvalidRange
+	}
+	ranges := make([]httpRange, 0)
+	noOverlap := false
+	for _, ra := range strings.Split(value[len(b):], ",") {
+		ra = strings.TrimSpace(ra)
+		if ra == "" {
+			continue
+		}
+		i := strings.Index(ra, "-")
+		if i < 0 {
+			return nil, errInvalidRange
+		}
+		start, end := strings.TrimSpace(ra[:i]), strings.TrimSpace(ra[i+1:])
+		var r httpRange
+		if start == "" {
+			// 如bytes=-500，表示最后的500字节
+			if end == "" {
+				return nil, errInvalidRange
+			}
+			i, err := strconv.ParseInt(end, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errInvalidRange
+			}
+			if i == 0 {
+				noOverlap = true
+				continue
+			}
+			if i > size {
+				i = size
+			}
+			r.start = size - i
+			r.length = size - r.start
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errInvalidRange
+			}
+			if i >= size {
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if end == "" {
+				// 如bytes=500-，表示从500到结束
+				r.length = size - r.start
+			} else {
+				i, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || r.start > i {
+					return nil, errInvalidRange
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.length = i - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		return nil, errRangeNotSatisfiable
+	}
+	if len(ranges) == 0 {
+		return nil, errInvalidRange
+	}
+	return ranges, nil
+}
+
+// ifRangeMatched check the If-Range header matches the response,
+// the etag uses strong comparison and the date should be the same as Last-Modified
+func (resp *HTTPResponse) ifRangeMatched(ifRange string) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		etag := resp.Header.Get(elton.HeaderETag)
+		return etag != "" &&
+			!strings.HasPrefix(etag, "W/") &&
+			etag == ifRange
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(resp.Header.Get(elton.HeaderLastModified))
+	if err != nil {
+		return false
+	}
+	return t.Truncate(time.Second).Equal(lastModified.Truncate(time.Second))
+}
+
+// FillRange fill the partial response to context by the Range header of request,
+// the whole response is filled if the range is invalid or If-Range is not matched
+func (resp *HTTPResponse) FillRange(c *elton.Context, encodings ...string) (err error) {
+	rangeValue := c.GetRequestHeader(headerRange)
+	if rangeValue == "" ||
+		resp.StatusCode != http.StatusOK ||
+		!resp.ifRangeMatched(c.GetRequestHeader(headerIfRange)) {
+		return resp.Fill(c, encodings...)
+	}
+	rawBody, err := resp.GetRawBody()
+	if err != nil {
+		return
+	}
+	size := int64(len(rawBody))
+	ranges, err := parseRange(rangeValue, size)
+	if err == errInvalidRange {
+		return resp.Fill(c, encodings...)
+	}
+	if err == errRangeNotSatisfiable {
+		c.SetHeader(headerContentRange, "bytes */"+strconv.FormatInt(size, 10))
+		c.StatusCode = http.StatusRequestedRangeNotSatisfiable
+		c.BodyBuffer = bytes.NewBuffer(nil)
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	// 如果所有range的总长度大于数据长度，则直接返回完整数据，避免过多的multipart
+	total := int64(0)
+	for _, r := range ranges {
+		total += r.length
+	}
+	if total > size {
+		return resp.Fill(c, encodings...)
+	}
+
+	c.MergeHeader(resp.Header)
+	// 截取的是原始数据，因此不压缩
+	c.SetHeader(elton.HeaderContentEncoding, "")
+	c.SetHeader(headerAcceptRanges, "bytes")
+	c.StatusCode = http.StatusPartialContent
+	if len(ranges) == 1 {
+		r := ranges[0]
+		c.SetHeader(headerContentRange, r.contentRange(size))
+		c.BodyBuffer = bytes.NewBuffer(rawBody[r.start : r.start+r.length])
+		return nil
+	}
+
+	// 多个range以multipart/byteranges返回
+	buffer := &bytes.Buffer{}
+	w := multipart.NewWriter(buffer)
+	contentType := resp.Header.Get(elton.HeaderContentType)
+	for _, r := range ranges {
+		h := make(textproto.MIMEHeader)
+		if contentType != "" {
+			h.Set(elton.HeaderContentType, contentType)
+		}
+		h.Set(headerContentRange, r.contentRange(size))
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		_, err = part.Write(rawBody[r.start : r.start+r.length])
+		if err != nil {
+			return err
+		}
+	}
+	err = w.Close()
+	if err != nil {
+		return
+	}
+	c.SetHeader(elton.HeaderContentType, "multipart/byteranges; boundary="+w.Boundary())
+	c.BodyBuffer = buffer
+	return nil
+}
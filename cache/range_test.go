@@ -0,0 +1,250 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cache
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/elton"
+	"github.com/vicanso/pike/compress"
+)
+
+func TestParseRange(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		value  string
+		size   int64
+		ranges []httpRange
+		err    error
+	}{
+		{
+			value: "items=0-1",
+			size:  10,
+			err:   errInvalidRange,
+		},
+		{
+			value: "bytes=a-1",
+			size:  10,
+			err:   errInvalidRange,
+		},
+		{
+			value: "bytes=5-1",
+			size:  10,
+			err:   errInvalidRange,
+		},
+		{
+			value: "bytes=10-",
+			size:  10,
+			err:   errRangeNotSatisfiable,
+		},
+		{
+			value: "bytes=-0",
+			size:  10,
+			err:   errRangeNotSatisfiable,
+		},
+		{
+			value: "bytes=0-4",
+			size:  10,
+			ranges: []httpRange{
+				{
+					start:  0,
+					length: 5,
+				},
+			},
+		},
+		{
+			value: "bytes=5-",
+			size:  10,
+			ranges: []httpRange{
+				{
+					start:  5,
+					length: 5,
+				},
+			},
+		},
+		{
+			value: "bytes=-3",
+			size:  10,
+			ranges: []httpRange{
+				{
+					start:  7,
+					length: 3,
+				},
+			},
+		},
+		// 超出数据长度的截断
+		{
+			value: "bytes=8-100, -20",
+			size:  10,
+			ranges: []httpRange{
+				{
+					start:  8,
+					length: 2,
+				},
+				{
+					start:  0,
+					length: 10,
+				},
+			},
+		},
+		// 不可满足的range忽略
+		{
+			value: "bytes=0-1, 20-30",
+			size:  10,
+			ranges: []httpRange{
+				{
+					start:  0,
+					length: 2,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		ranges, err := parseRange(tt.value, tt.size)
+		assert.Equal(tt.err, err, tt.value)
+		assert.Equal(tt.ranges, ranges, tt.value)
+	}
+}
+
+func TestIfRangeMatched(t *testing.T) {
+	assert := assert.New(t)
+	resp := &HTTPResponse{
+		Header: http.Header{
+			"Etag":          []string{`"123"`},
+			"Last-Modified": []string{"Mon, 02 Jan 2006 15:04:05 GMT"},
+		},
+	}
+	assert.True(resp.ifRangeMatched(""))
+	assert.True(resp.ifRangeMatched(`"123"`))
+	assert.False(resp.ifRangeMatched(`"456"`))
+	assert.False(resp.ifRangeMatched(`W/"123"`))
+	assert.True(resp.ifRangeMatched("Mon, 02 Jan 2006 15:04:05 GMT"))
+	assert.False(resp.ifRangeMatched("Tue, 03 Jan 2006 15:04:05 GMT"))
+
+	resp.Header.Set("Etag", `W/"123"`)
+	assert.False(resp.ifRangeMatched(`W/"123"`))
+}
+
+func TestFillRange(t *testing.T) {
+	assert := assert.New(t)
+
+	compressSrv := compress.Get("")
+	rawBody := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	gzipBody, err := compressSrv.Encode(compress.EncodingGzip, rawBody)
+	assert.Nil(err)
+	resp := &HTTPResponse{
+		StatusCode: 200,
+		Header: http.Header{
+			"Content-Type": []string{"text/plain"},
+			"Etag":         []string{`"123"`},
+		},
+		EncodedBodies: map[string][]byte{
+			"gzip": gzipBody,
+		},
+	}
+	newContext := func(header map[string]string) *elton.Context {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(elton.HeaderAcceptEncoding, "gzip")
+		for key, value := range header {
+			req.Header.Set(key, value)
+		}
+		return elton.NewContext(httptest.NewRecorder(), req)
+	}
+
+	// 单个range，从gzip中解压后截取
+	c := newContext(map[string]string{
+		"Range": "bytes=0-9",
+	})
+	err = resp.FillRange(c)
+	assert.Nil(err)
+	assert.Equal(http.StatusPartialContent, c.StatusCode)
+	assert.Equal("bytes 0-9/36", c.GetHeader(headerContentRange))
+	assert.Empty(c.GetHeader(elton.HeaderContentEncoding))
+	assert.Equal("0123456789", c.BodyBuffer.String())
+
+	// 多个range
+	c = newContext(map[string]string{
+		"Range": "bytes=0-1,-2",
+	})
+	err = resp.FillRange(c)
+	assert.Nil(err)
+	assert.Equal(http.StatusPartialContent, c.StatusCode)
+	mediaType, params, err := mime.ParseMediaType(c.GetHeader(elton.HeaderContentType))
+	assert.Nil(err)
+	assert.Equal("multipart/byteranges", mediaType)
+	reader := multipart.NewReader(c.BodyBuffer, params["boundary"])
+	contentRanges := []string{
+		"bytes 0-1/36",
+		"bytes 34-35/36",
+	}
+	bodies := []string{
+		"01",
+		"yz",
+	}
+	for i := 0; i < 2; i++ {
+		part, err := reader.NextPart()
+		assert.Nil(err)
+		assert.Equal("text/plain", part.Header.Get(elton.HeaderContentType))
+		assert.Equal(contentRanges[i], part.Header.Get(headerContentRange))
+		data, err := ioutil.ReadAll(part)
+		assert.Nil(err)
+		assert.Equal(bodies[i], string(data))
+	}
+
+	// 不可满足的range
+	c = newContext(map[string]string{
+		"Range": "bytes=100-",
+	})
+	err = resp.FillRange(c)
+	assert.Nil(err)
+	assert.Equal(http.StatusRequestedRangeNotSatisfiable, c.StatusCode)
+	assert.Equal("bytes */36", c.GetHeader(headerContentRange))
+
+	// if-range不匹配，返回完整数据
+	c = newContext(map[string]string{
+		"Range":    "bytes=0-9",
+		"If-Range": `"456"`,
+	})
+	err = resp.FillRange(c)
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, c.StatusCode)
+	assert.Equal("gzip", c.GetHeader(elton.HeaderContentEncoding))
+	assert.Equal(gzipBody, c.BodyBuffer.Bytes())
+
+	// if-range匹配
+	c = newContext(map[string]string{
+		"Range":    "bytes=10-",
+		"If-Range": `"123"`,
+	})
+	err = resp.FillRange(c)
+	assert.Nil(err)
+	assert.Equal(http.StatusPartialContent, c.StatusCode)
+	assert.Equal("abcdefghijklmnopqrstuvwxyz", c.BodyBuffer.String())
+}
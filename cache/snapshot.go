@@ -0,0 +1,304 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 缓存快照，将内存中可用的缓存导出（格式为：缓存名称、缓存key以及httpCache.Bytes的数据），
+// 用于重启后加载或导入至其它实例，无需配置store
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/vicanso/pike/log"
+	"go.uber.org/zap"
+)
+
+// maxSnapshotFieldSize the max size of snapshot field, the larger field is skipped
+const maxSnapshotFieldSize = 256 * 1024 * 1024
+
+// snapshotMagic the magic of snapshot
+var snapshotMagic = []byte("PIKESNAP")
+
+// ErrSnapshotInvalid the data of snapshot is invalid
+var ErrSnapshotInvalid = errors.New("the data of snapshot is invalid")
+
+// errSnapshotFieldTooLarge the field of snapshot is too large, it has been discarded
+var errSnapshotFieldTooLarge = errors.New("the field of snapshot is too large")
+
+// snapshotData get the data of snapshot, it returns nil if the http cache should not be snapshot,
+// only the hit http cache and the vary http cache(hit for pass) are snapshot
+func (hc *httpCache) snapshotData(now int64) ([]byte, error) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	if hc.isExpired(now) {
+		return nil, nil
+	}
+	if hc.status != StatusHit &&
+		(hc.status != StatusHitForPass || len(hc.vary) == 0) {
+		return nil, nil
+	}
+	return hc.Bytes()
+}
+
+// restore restores the http cache from the snapshot, it returns false if the http cache is in use,
+// a compress job is returned if the response should be compressed
+func (hc *httpCache) restore(data *httpCache) (bool, *compressJob) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if hc.status != StatusUnknown {
+		return false, nil
+	}
+	hc.status = data.status
+	hc.response = data.response
+	hc.createdAt = data.createdAt
+	hc.expiredAt = data.expiredAt
+	hc.vary = data.vary
+	hc.staleWhileRevalidate = data.staleWhileRevalidate
+	hc.staleIfError = data.staleIfError
+	hc.mustRevalidate = data.mustRevalidate
+	hc.tags = data.tags
+	// 导出时有可能未完成压缩，与cacheable一致由后台压缩
+	if hc.status == StatusHit &&
+		hc.response != nil &&
+		hc.response.needCompress() {
+		return true, &compressJob{
+			hc:   hc,
+			resp: hc.response,
+		}
+	}
+	return true, nil
+}
+
+// writeSnapshotField writes the field of snapshot, 4 bytes for the size of data
+func writeSnapshotField(w io.Writer, data []byte) error {
+	_, err := w.Write(uint32ToBytes(len(data)))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// readSnapshotField reads the field of snapshot, the field larger than maxSnapshotFieldSize is discarded
+// and errSnapshotFieldTooLarge is returned
+func readSnapshotField(r io.Reader) ([]byte, error) {
+	var size uint32
+	err := binary.Read(r, binary.BigEndian, &size)
+	if err != nil {
+		return nil, err
+	}
+	// 长度不可信，避免分配过大的内存
+	if size > maxSnapshotFieldSize {
+		_, err = io.CopyN(ioutil.Discard, r, int64(size))
+		if err != nil {
+			return nil, ErrSnapshotInvalid
+		}
+		return nil, errSnapshotFieldTooLarge
+	}
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Export exports the available http caches of lru to writer, it returns the count of exported caches
+func (d *dispatcher) Export(w io.Writer, name string) (int, error) {
+	count := 0
+	now := nowUnix()
+	for _, lru := range d.list {
+		// 只在复制列表时加锁
+		lru.mu.Lock()
+		values := lru.cache.values()
+		lru.mu.Unlock()
+		for _, hc := range values {
+			data, err := hc.snapshotData(now)
+			if err != nil {
+				return count, err
+			}
+			// 过大的数据导入时会被忽略，因此不导出
+			if data == nil || len(data) > maxSnapshotFieldSize {
+				continue
+			}
+			for _, field := range [][]byte{
+				[]byte(name),
+				hc.key,
+				data,
+			} {
+				err = writeSnapshotField(w, field)
+				if err != nil {
+					return count, err
+				}
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Restore restores the http cache of key from the data of snapshot,
+// it returns false if the data is expired or the http cache is in use
+func (d *dispatcher) Restore(key, data []byte) (bool, error) {
+	item := NewHTTPCache()
+	err := item.FromBytes(data)
+	if err != nil {
+		return false, err
+	}
+	if item.isExpired(nowUnix()) {
+		return false, nil
+	}
+	hc := d.GetHTTPCache(key)
+	restored, job := hc.restore(item)
+	if !restored {
+		return false, nil
+	}
+	hc.updateTags()
+	hc.updateSize()
+	job.dispatch()
+	return true, nil
+}
+
+// Export exports the available http caches of dispatchers, all dispatchers are exported if name is empty
+func (ds *dispatchers) Export(w io.Writer, name string) (int, error) {
+	_, err := w.Write(snapshotMagic)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	ds.m.Range(func(key, value interface{}) bool {
+		dispName, _ := key.(string)
+		d, ok := value.(*dispatcher)
+		if !ok || (name != "" && name != dispName) {
+			return true
+		}
+		var n int
+		n, err = d.Export(w, dispName)
+		count += n
+		return err == nil
+	})
+	return count, err
+}
+
+// Import imports the http caches of snapshot, the caches of dispatchers which are not exists are ignored,
+// it returns the count of imported caches and the count of skipped caches(invalid or too large)
+func (ds *dispatchers) Import(r io.Reader) (count int, skipped int, err error) {
+	magic := make([]byte, len(snapshotMagic))
+	_, err = io.ReadFull(r, magic)
+	if err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return 0, 0, ErrSnapshotInvalid
+	}
+	for {
+		fields := make([][]byte, 3)
+		tooLarge := false
+		for i := range fields {
+			fields[i], err = readSnapshotField(r)
+			// 无更多的数据
+			if i == 0 && err == io.EOF {
+				return count, skipped, nil
+			}
+			if err == errSnapshotFieldTooLarge {
+				tooLarge = true
+				continue
+			}
+			if err != nil {
+				return count, skipped, ErrSnapshotInvalid
+			}
+		}
+		if tooLarge {
+			skipped++
+			continue
+		}
+		name, key, data := fields[0], fields[1], fields[2]
+		d := ds.Get(string(name))
+		if d == nil {
+			continue
+		}
+		restored, e := d.Restore(key, data)
+		// 数据出错的缓存忽略，继续导入其它的缓存
+		if e != nil {
+			skipped++
+			log.Default().Error("restore cache from snapshot fail",
+				zap.String("key", string(key)),
+				zap.Error(e),
+			)
+			continue
+		}
+		if restored {
+			count++
+		}
+	}
+}
+
+// Export exports the available http caches of default dispatchers
+func Export(w io.Writer, name string) (int, error) {
+	return defaultDispatchers.Export(w, name)
+}
+
+// Import imports the http caches of snapshot to default dispatchers
+func Import(r io.Reader) (int, int, error) {
+	return defaultDispatchers.Import(r)
+}
+
+// SaveSnapshot saves the available http caches of default dispatchers to file,
+// the data is written to a temp file and then renamed
+func SaveSnapshot(file string) (int, error) {
+	tmpFile, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpFile.Name())
+	w := bufio.NewWriter(tmpFile)
+	count, err := Export(w, "")
+	if err == nil {
+		err = w.Flush()
+	}
+	if e := tmpFile.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return 0, err
+	}
+	err = os.Rename(tmpFile.Name(), file)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// LoadSnapshot loads the http caches of snapshot file to default dispatchers,
+// it returns the count of loaded caches and the count of skipped caches
+func LoadSnapshot(file string) (int, int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return Import(bufio.NewReader(f))
+}
@@ -0,0 +1,249 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	name := "snapshot"
+	opts := []DispatcherOption{
+		{
+			Name: name,
+			Size: 100,
+		},
+		{
+			Name: "other",
+			Size: 100,
+		},
+	}
+	ds := NewDispatchers(opts)
+	d := ds.Get(name)
+	resp := &HTTPResponse{
+		StatusCode: 200,
+		RawBody:    []byte("Hello world!"),
+	}
+	d.GetHTTPCache([]byte("GET test.com /hit")).CacheableWithOption(resp, CacheableOption{
+		TTL:  60,
+		Tags: []string{"tag1"},
+	})
+	// 已过期与hit for pass的缓存不导出
+	d.GetHTTPCache([]byte("GET test.com /expired")).Cacheable(resp, -1)
+	d.GetHTTPCache([]byte("GET test.com /hit-for-pass")).HitForPass(60)
+	// vary的缓存需要导出
+	varyCache := d.GetHTTPCache([]byte("GET test.com /vary"))
+	varyCache.Vary([]string{"Accept-Language"}, 60)
+	header := http.Header{}
+	header.Set("Accept-Language", "zh")
+	varyKey := varyCache.GetVaryKey(header)
+	d.GetHTTPCache(varyKey).Cacheable(resp, 60)
+
+	buf := &bytes.Buffer{}
+	count, err := ds.Export(buf, "")
+	assert.Nil(err)
+	assert.Equal(3, count)
+
+	// 导入至新的dispatchers
+	newDS := NewDispatchers(opts)
+	count, skipped, err := newDS.Import(bytes.NewReader(buf.Bytes()))
+	assert.Nil(err)
+	assert.Equal(3, count)
+	assert.Equal(0, skipped)
+	newDisp := newDS.Get(name)
+	status, data := newDisp.GetHTTPCache([]byte("GET test.com /hit")).Get()
+	assert.Equal(StatusHit, status)
+	assert.Equal(resp.RawBody, data.RawBody)
+	assert.Equal([]string{"tag1"}, newDisp.GetHTTPCache([]byte("GET test.com /hit")).tags)
+	assert.Equal(varyKey, newDisp.GetHTTPCache([]byte("GET test.com /vary")).GetVaryKey(header))
+	status, _ = newDisp.GetHTTPCache(varyKey).Get()
+	assert.Equal(StatusHit, status)
+	status, _ = newDisp.GetHTTPCache([]byte("GET test.com /expired")).Get()
+	assert.Equal(StatusFetching, status)
+
+	// 已存在的缓存不覆盖
+	count, _, err = newDS.Import(bytes.NewReader(buf.Bytes()))
+	assert.Nil(err)
+	assert.Equal(0, count)
+
+	// 指定缓存导出
+	buf.Reset()
+	count, err = ds.Export(buf, "other")
+	assert.Nil(err)
+	assert.Equal(0, count)
+	assert.Equal(snapshotMagic, buf.Bytes())
+
+	_, _, err = newDS.Import(bytes.NewReader([]byte("abc")))
+	assert.Equal(ErrSnapshotInvalid, err)
+	_, _, err = newDS.Import(bytes.NewReader(append(snapshotMagic, 0, 0)))
+	assert.Equal(ErrSnapshotInvalid, err)
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestSnapshotImportSkipped(t *testing.T) {
+	assert := assert.New(t)
+	name := "snapshot-skipped"
+	ds := NewDispatchers([]DispatcherOption{
+		{
+			Name: name,
+			Size: 100,
+		},
+	})
+	hc := NewHTTPCache()
+	hc.Cacheable(&HTTPResponse{
+		StatusCode: 200,
+		RawBody:    []byte("Hello world!"),
+	}, 60)
+	data, err := hc.Bytes()
+	assert.Nil(err)
+	corrupted := append([]byte{}, data...)
+	corrupted[len(corrupted)-1] ^= 0xff
+
+	buf := bytes.NewBuffer(append([]byte{}, snapshotMagic...))
+	writeFields := func(fields ...[]byte) {
+		for _, field := range fields {
+			assert.Nil(writeSnapshotField(buf, field))
+		}
+	}
+	// 数据出错的缓存
+	writeFields([]byte(name), []byte("GET test.com /corrupted"), corrupted)
+	// 数据过大的缓存（长度不可信，不分配内存）
+	writeFields([]byte(name), []byte("GET test.com /too-large"))
+	buf.Write(uint32ToBytes(maxSnapshotFieldSize + 1))
+	tail := &bytes.Buffer{}
+	for _, field := range [][]byte{
+		[]byte(name),
+		[]byte("GET test.com /ok"),
+		data,
+	} {
+		assert.Nil(writeSnapshotField(tail, field))
+	}
+
+	count, skipped, err := ds.Import(io.MultiReader(
+		bytes.NewReader(buf.Bytes()),
+		io.LimitReader(zeroReader{}, maxSnapshotFieldSize+1),
+		tail,
+	))
+	assert.Nil(err)
+	assert.Equal(1, count)
+	assert.Equal(2, skipped)
+	status, _ := ds.Get(name).GetHTTPCache([]byte("GET test.com /ok")).Get()
+	assert.Equal(StatusHit, status)
+
+	// 数据被截断
+	buf = bytes.NewBuffer(append([]byte{}, snapshotMagic...))
+	writeFields([]byte(name), []byte("GET test.com /truncated"))
+	buf.Write(uint32ToBytes(maxSnapshotFieldSize + 1))
+	_, _, err = ds.Import(bytes.NewReader(buf.Bytes()))
+	assert.Equal(ErrSnapshotInvalid, err)
+}
+
+func TestSnapshotRestoreCompress(t *testing.T) {
+	assert := assert.New(t)
+	d := NewDispatcher(DispatcherOption{
+		Size: 100,
+	})
+	resp := newTestCompressResponse()
+	item := NewHTTPCache()
+	item.mu.Lock()
+	// 未压缩的缓存导出
+	job := item.cacheable(resp, CacheableOption{
+		TTL: 60,
+	})
+	item.mu.Unlock()
+	assert.NotNil(job)
+	data, err := item.Bytes()
+	assert.Nil(err)
+
+	key := []byte("GET test.com /restore-compress")
+	restored, err := d.Restore(key, data)
+	assert.Nil(err)
+	assert.True(restored)
+	hc := d.GetHTTPCache(key)
+	// 由后台压缩后替换
+	for i := 0; i < 100; i++ {
+		_, data := hc.Get()
+		if len(data.EncodedBodies["br"]) != 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, result := hc.Get()
+	assert.NotEmpty(result.EncodedBodies["br"])
+	rawBody, err := result.GetRawBody()
+	assert.Nil(err)
+	assert.Equal(resp.RawBody, rawBody)
+}
+
+func TestSnapshotFile(t *testing.T) {
+	assert := assert.New(t)
+	name := "snapshot-file"
+	ResetDispatchers([]config.CacheConfig{
+		{
+			Name:       name,
+			Size:       100,
+			HitForPass: "1m",
+		},
+	})
+	key := []byte("GET test.com /snapshot")
+	GetDispatcher(name).GetHTTPCache(key).Cacheable(&HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}, 60)
+
+	dir, err := ioutil.TempDir("", "")
+	assert.Nil(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "pike.snapshot")
+	count, err := SaveSnapshot(file)
+	assert.Nil(err)
+	assert.Equal(1, count)
+
+	GetDispatcher(name).RemoveHTTPCache(key)
+	count, _, err = LoadSnapshot(file)
+	assert.Nil(err)
+	assert.Equal(1, count)
+	status, _ := GetDispatcher(name).GetHTTPCache(key).Get()
+	assert.Equal(StatusHit, status)
+
+	_, _, err = LoadSnapshot(filepath.Join(dir, "not-found"))
+	assert.NotNil(err)
+}
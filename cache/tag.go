@@ -0,0 +1,212 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 缓存标签，根据upstream响应头（如Surrogate-Key）中的标签建立索引，
+// 用于按标签批量删除缓存，标签的响应头在返回客户端前删除
+
+package cache
+
+import (
+	"strings"
+
+	"github.com/vicanso/pike/log"
+	"go.uber.org/zap"
+)
+
+// splitTags split the tags of header value, the tags are separated by space or comma
+func splitTags(values []string) []string {
+	result := make([]string, 0)
+	for _, value := range values {
+		for _, tag := range strings.FieldsFunc(value, func(r rune) bool {
+			return r == ' ' || r == ','
+		}) {
+			exists := false
+			for _, item := range result {
+				if item == tag {
+					exists = true
+					break
+				}
+			}
+			if !exists {
+				result = append(result, tag)
+			}
+		}
+	}
+	return result
+}
+
+// PopTags get the tags of response and remove the tag header
+func (d *dispatcher) PopTags(resp *HTTPResponse) []string {
+	tagHeader := d.getTagHeader()
+	if tagHeader == "" || resp == nil || resp.Header == nil {
+		return nil
+	}
+	values := resp.Header.Values(tagHeader)
+	if len(values) == 0 {
+		return nil
+	}
+	resp.Header.Del(tagHeader)
+	return splitTags(values)
+}
+
+// setTags set the tags of key, the old tags are replaced
+func (d *dispatcher) setTags(key string, tags []string) {
+	d.tagMu.Lock()
+	defer d.tagMu.Unlock()
+	d.setTagsWithoutLock(key, tags)
+}
+
+func (d *dispatcher) setTagsWithoutLock(key string, tags []string) {
+	d.removeTagsWithoutLock(key)
+	if len(tags) == 0 {
+		return
+	}
+	d.keyTags[key] = tags
+	for _, tag := range tags {
+		keys, ok := d.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			d.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// removeTags remove the tags of key
+func (d *dispatcher) removeTags(key string) {
+	d.tagMu.Lock()
+	defer d.tagMu.Unlock()
+	d.removeTagsWithoutLock(key)
+}
+
+func (d *dispatcher) removeTagsWithoutLock(key string) {
+	tags, ok := d.keyTags[key]
+	if !ok {
+		return
+	}
+	delete(d.keyTags, key)
+	for _, tag := range tags {
+		keys := d.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(d.tags, tag)
+		}
+	}
+}
+
+// getTagKeys get the keys of tag
+func (d *dispatcher) getTagKeys(tag string) []string {
+	d.tagMu.Lock()
+	defer d.tagMu.Unlock()
+	keys := d.tags[tag]
+	result := make([]string, 0, len(keys))
+	for key := range keys {
+		result = append(result, key)
+	}
+	return result
+}
+
+// setTagsIfAbsent set the tags of key if the key has no tags
+func (d *dispatcher) setTagsIfAbsent(key string, tags []string) {
+	d.tagMu.Lock()
+	defer d.tagMu.Unlock()
+	if _, ok := d.keyTags[key]; ok {
+		return
+	}
+	d.setTagsWithoutLock(key, tags)
+}
+
+// loadStoreTags load the tags of http caches which are only in store(such as after restarting),
+// the store is scanned only once, after that the tag index is updated with lru and store
+func (d *dispatcher) loadStoreTags() error {
+	d.storeTagsMu.Lock()
+	defer d.storeTagsMu.Unlock()
+	if d.storeTagsLoaded {
+		return nil
+	}
+	keys := make([][]byte, 0)
+	err := d.store.Scan(nil, func(key []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		hc := NewHTTPStoreCache(key, d.store)
+		// 有可能数据已过期删除，忽略出错的数据
+		if err := hc.initFromStore(); err != nil || len(hc.tags) == 0 {
+			continue
+		}
+		// lru中的缓存已建立索引，以lru中的为准
+		d.setTagsIfAbsent(string(key), hc.tags)
+	}
+	d.storeTagsLoaded = true
+	return nil
+}
+
+// PurgeTag remove the http caches which have the tag, including the data of store,
+// it returns the count of removed caches
+func (d *dispatcher) PurgeTag(tag string) int {
+	checkStore := d.store != nil
+	if checkStore {
+		// 首次按标签删除时加载store中缓存的标签
+		err := d.loadStoreTags()
+		if err != nil {
+			log.Default().Error("load tags of store fail",
+				zap.String("tag", tag),
+				zap.Error(err),
+			)
+		}
+	}
+	// 复制key列表之后再删除，避免与lru的锁冲突
+	keys := d.getTagKeys(tag)
+	count := 0
+	for _, key := range keys {
+		if d.removeHTTPCache([]byte(key), checkStore) {
+			count++
+		}
+	}
+	return count
+}
+
+// updateTags update the tags of http cache to dispatcher
+func (hc *httpCache) updateTags() {
+	if hc.disp == nil || hc.disp.getTagHeader() == "" {
+		return
+	}
+	hc.mu.RLock()
+	tags := hc.tags
+	hc.mu.RUnlock()
+	hc.disp.setCacheTags(hc, tags)
+}
+
+// setCacheTags set the tags of http cache, the evicted http cache is ignored if there is no store
+func (d *dispatcher) setCacheTags(hc *httpCache, tags []string) {
+	// 与淘汰使用相同的锁，避免淘汰后重新建立索引
+	d.sizeMu.Lock()
+	defer d.sizeMu.Unlock()
+	if hc.evicted && d.store == nil {
+		return
+	}
+	d.setTags(string(hc.key), tags)
+}
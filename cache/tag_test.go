@@ -0,0 +1,200 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTags(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{}, splitTags(nil))
+	assert.Equal([]string{
+		"a",
+		"b",
+		"c",
+	}, splitTags([]string{
+		"a b",
+		"c, a",
+	}))
+}
+
+func TestPopTags(t *testing.T) {
+	assert := assert.New(t)
+
+	d := NewDispatcher(DispatcherOption{})
+	resp := &HTTPResponse{
+		Header: http.Header{
+			"Cache-Tag": []string{
+				"a,b",
+			},
+		},
+	}
+	// 未配置标签的响应头
+	assert.Nil(d.PopTags(resp))
+	assert.Equal("a,b", resp.Header.Get("Cache-Tag"))
+
+	d = NewDispatcher(DispatcherOption{
+		TagHeader: "cache-tag",
+	})
+	assert.Nil(d.PopTags(nil))
+	assert.Equal([]string{
+		"a",
+		"b",
+	}, d.PopTags(resp))
+	assert.Empty(resp.Header.Get("Cache-Tag"))
+}
+
+func TestPurgeTag(t *testing.T) {
+	assert := assert.New(t)
+
+	d := NewDispatcher(DispatcherOption{
+		Size:      100,
+		TagHeader: "Surrogate-Key",
+	})
+	hc1 := d.GetHTTPCache([]byte("GET test.com /products/1"))
+	hc1.CacheableWithOption(&HTTPResponse{}, CacheableOption{
+		TTL: 60,
+		Tags: []string{
+			"product-1",
+			"products",
+		},
+	})
+	hc2 := d.GetHTTPCache([]byte("GET test.com /products/2"))
+	hc2.CacheableWithOption(&HTTPResponse{}, CacheableOption{
+		TTL: 60,
+		Tags: []string{
+			"product-2",
+			"products",
+		},
+	})
+	assert.Equal([]string{"GET test.com /products/1"}, d.getTagKeys("product-1"))
+	assert.Equal(2, len(d.getTagKeys("products")))
+
+	// 更新为hit for pass则清除标签
+	hc2.HitForPass(60)
+	assert.Empty(d.getTagKeys("product-2"))
+	assert.Equal(1, len(d.getTagKeys("products")))
+
+	assert.Equal(1, d.PurgeTag("products"))
+	assert.Empty(d.tags)
+	assert.Empty(d.keyTags)
+	assert.NotEqual(hc1, d.GetHTTPCache([]byte("GET test.com /products/1")))
+}
+
+func TestPurgeTagOfStore(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &testCompressStore{
+		data: make(map[string][]byte),
+	}
+	d := NewDispatcher(DispatcherOption{
+		Size:      100,
+		TagHeader: "Surrogate-Key",
+	})
+	d.store = s
+
+	// 仅在store中的缓存（如重启后未加载）
+	for i, tags := range [][]string{
+		{"product-1", "products"},
+		{"product-2", "products"},
+		{"product-3"},
+	} {
+		key := []byte(fmt.Sprintf("GET test.com /products/%d", i+1))
+		hc := NewHTTPStoreCache(key, s)
+		hc.CacheableWithOption(&HTTPResponse{}, CacheableOption{
+			TTL:  60,
+			Tags: tags,
+		})
+		assert.Nil(hc.saveToStore())
+	}
+	// 从store加载至lru时建立索引
+	hc := d.GetHTTPCache([]byte("GET test.com /products/1"))
+	status, _ := hc.Get()
+	assert.Equal(StatusHit, status)
+	assert.Equal([]string{"GET test.com /products/1"}, d.getTagKeys("products"))
+
+	// 有store时淘汰的缓存保留标签索引
+	lru := d.getLRU(hc.key)
+	lru.mu.Lock()
+	lru.removeCache(hc.key)
+	lru.mu.Unlock()
+	assert.Equal([]string{"GET test.com /products/1"}, d.getTagKeys("products"))
+
+	// 首次按标签删除时加载store中缓存的标签
+	assert.Equal(2, d.PurgeTag("products"))
+	assert.True(d.storeTagsLoaded)
+	assert.Equal(1, len(s.data))
+	_, err := s.Get([]byte("GET test.com /products/3"))
+	assert.Nil(err)
+	assert.Equal([]string{"GET test.com /products/3"}, d.getTagKeys("product-3"))
+
+	// 只返回实际删除的缓存数量
+	assert.Nil(s.Delete([]byte("GET test.com /products/3")))
+	assert.Equal(0, d.PurgeTag("product-3"))
+	assert.Empty(d.keyTags)
+}
+
+func TestPurgeTagOfEvicted(t *testing.T) {
+	assert := assert.New(t)
+
+	d := NewDispatcher(DispatcherOption{
+		Size:      100,
+		MaxBytes:  10,
+		TagHeader: "Surrogate-Key",
+	})
+	hc1 := d.GetHTTPCache([]byte("GET test.com /products/1"))
+	hc1.CacheableWithOption(&HTTPResponse{
+		RawBody: make([]byte, 8),
+	}, CacheableOption{
+		TTL:  60,
+		Tags: []string{"products"},
+	})
+	// 超出大小限制时淘汰，淘汰后不再建立标签索引
+	hc2 := d.GetHTTPCache([]byte("GET test.com /products/2"))
+	hc2.CacheableWithOption(&HTTPResponse{
+		RawBody: make([]byte, 8),
+	}, CacheableOption{
+		TTL:  60,
+		Tags: []string{"products"},
+	})
+	assert.True(hc1.evicted)
+	assert.Equal([]string{"GET test.com /products/2"}, d.getTagKeys("products"))
+
+	// 超出大小限制的缓存更新后即被淘汰
+	hc3 := d.GetHTTPCache([]byte("GET test.com /products/3"))
+	hc3.CacheableWithOption(&HTTPResponse{
+		RawBody: make([]byte, 20),
+	}, CacheableOption{
+		TTL:  60,
+		Tags: []string{"products"},
+	})
+	assert.True(hc2.evicted)
+	assert.True(hc3.evicted)
+	assert.Empty(d.getTagKeys("products"))
+	assert.Equal(0, d.PurgeTag("products"))
+}
@@ -0,0 +1,377 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Cache-Control的解析处理（RFC 9111），包括请求与响应的指令，
+// 以及根据max-age、Expires与Last-Modified计算缓存有效期
+
+package cachecontrol
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerDate         = "Date"
+	headerExpires      = "Expires"
+	headerLastModified = "Last-Modified"
+)
+
+const (
+	directiveMaxAge               = "max-age"
+	directiveSMaxAge              = "s-maxage"
+	directiveNoCache              = "no-cache"
+	directiveNoStore              = "no-store"
+	directivePrivate              = "private"
+	directivePublic               = "public"
+	directiveMustRevalidate       = "must-revalidate"
+	directiveProxyRevalidate      = "proxy-revalidate"
+	directiveNoTransform          = "no-transform"
+	directiveStaleWhileRevalidate = "stale-while-revalidate"
+	directiveStaleIfError         = "stale-if-error"
+	directiveMaxStale             = "max-stale"
+	directiveMinFresh             = "min-fresh"
+	directiveOnlyIfCached         = "only-if-cached"
+)
+
+// maxDeltaSeconds 最大的时长(2^31)，超过则使用该值
+const maxDeltaSeconds = math.MaxInt32
+
+// maxHeuristicSeconds 启发式缓存有效期的最大值(1天)
+const maxHeuristicSeconds = 24 * 3600
+
+// heuristicStatusCodes 可以使用启发式缓存有效期的状态码
+var heuristicStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusPartialContent:       true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+type (
+	// Directives directives of Cache-Control, the name is lower case
+	// and the value is unquoted
+	Directives map[string]string
+
+	// Response the directives of response Cache-Control
+	Response struct {
+		NoStore bool
+		// NoCache 无限定字段的no-cache
+		NoCache bool
+		// NoCacheFields no-cache="Set-Cookie" 限定的字段
+		NoCacheFields []string
+		// Private 无限定字段的private
+		Private bool
+		// PrivateFields private="Set-Cookie" 限定的字段
+		PrivateFields   []string
+		Public          bool
+		MustRevalidate  bool
+		ProxyRevalidate bool
+		NoTransform     bool
+		// MaxAge max-age的值，-1表示未设置
+		MaxAge int
+		// SMaxAge s-maxage的值，-1表示未设置
+		SMaxAge int
+		// StaleWhileRevalidate stale-while-revalidate的值，-1表示未设置
+		StaleWhileRevalidate int
+		// StaleIfError stale-if-error的值，-1表示未设置
+		StaleIfError int
+	}
+
+	// Request the directives of request Cache-Control
+	Request struct {
+		NoCache      bool
+		NoStore      bool
+		OnlyIfCached bool
+		// MaxAge max-age的值，-1表示未设置
+		MaxAge int
+		// MaxStale max-stale的值，-1表示未设置，无值时为最大值
+		MaxStale int
+		// MinFresh min-fresh的值，-1表示未设置
+		MinFresh int
+	}
+)
+
+// splitDirectives split the value by comma, the comma in quoted string is ignored
+func splitDirectives(value string) []string {
+	result := make([]string, 0)
+	quoted := false
+	escaped := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if escaped {
+			escaped = false
+			continue
+		}
+		switch ch {
+		case '\\':
+			escaped = quoted
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				result = append(result, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(result, value[start:])
+}
+
+// unquote unquote the quoted string
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	if !strings.Contains(value, "\\") {
+		return value
+	}
+	var b strings.Builder
+	escaped := false
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if ch == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
+
+// Parse parse the values of Cache-Control, the first one is used if the directive is duplicated
+func Parse(values ...string) Directives {
+	directives := make(Directives)
+	for _, value := range values {
+		for _, item := range splitDirectives(value) {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			name := item
+			directiveValue := ""
+			if index := strings.IndexByte(item, '='); index != -1 {
+				name = strings.TrimSpace(item[:index])
+				directiveValue = unquote(strings.TrimSpace(item[index+1:]))
+			}
+			name = strings.ToLower(name)
+			if _, exists := directives[name]; exists {
+				continue
+			}
+			directives[name] = directiveValue
+		}
+	}
+	return directives
+}
+
+// Has check the directive exists
+func (d Directives) Has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// Seconds get the delta seconds of directive, it returns -1 if the directive is not exists,
+// the invalid value is treated as 0
+func (d Directives) Seconds(name string) int {
+	value, ok := d[name]
+	if !ok {
+		return -1
+	}
+	return parseDeltaSeconds(value)
+}
+
+// Fields get the field names of directive, such as no-cache="Set-Cookie"
+func (d Directives) Fields(name string) []string {
+	value := d[name]
+	if value == "" {
+		return nil
+	}
+	fields := make([]string, 0)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field != "" {
+			fields = append(fields, http.CanonicalHeaderKey(field))
+		}
+	}
+	return fields
+}
+
+// parseDeltaSeconds parse the delta seconds, the invalid value is treated as 0
+// and the value is limited to 2^31
+func parseDeltaSeconds(value string) int {
+	if value == "" {
+		return 0
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		// 超过int64的数字
+		if ne, ok := err.(*strconv.NumError); ok && ne.Err == strconv.ErrRange && value[0] != '-' {
+			return maxDeltaSeconds
+		}
+		return 0
+	}
+	if v < 0 {
+		return 0
+	}
+	if v > maxDeltaSeconds {
+		return maxDeltaSeconds
+	}
+	return int(v)
+}
+
+// ParseResponse parse the directives of response Cache-Control
+func ParseResponse(values ...string) *Response {
+	d := Parse(values...)
+	resp := &Response{
+		NoStore:              d.Has(directiveNoStore),
+		Public:               d.Has(directivePublic),
+		MustRevalidate:       d.Has(directiveMustRevalidate),
+		ProxyRevalidate:      d.Has(directiveProxyRevalidate),
+		NoTransform:          d.Has(directiveNoTransform),
+		MaxAge:               d.Seconds(directiveMaxAge),
+		SMaxAge:              d.Seconds(directiveSMaxAge),
+		StaleWhileRevalidate: d.Seconds(directiveStaleWhileRevalidate),
+		StaleIfError:         d.Seconds(directiveStaleIfError),
+	}
+	if d.Has(directiveNoCache) {
+		resp.NoCacheFields = d.Fields(directiveNoCache)
+		resp.NoCache = len(resp.NoCacheFields) == 0
+	}
+	if d.Has(directivePrivate) {
+		resp.PrivateFields = d.Fields(directivePrivate)
+		resp.Private = len(resp.PrivateFields) == 0
+	}
+	return resp
+}
+
+// IsStorable check the response can be stored by shared cache
+func (r *Response) IsStorable() bool {
+	return !r.NoStore && !r.NoCache && !r.Private
+}
+
+// CanServeStale check the stale response can be served,
+// must-revalidate and proxy-revalidate disallow it
+func (r *Response) CanServeStale() bool {
+	return !r.MustRevalidate && !r.ProxyRevalidate
+}
+
+// UncachedFields get the fields which should not be served from cache,
+// such as no-cache="Set-Cookie" and private="Set-Cookie"
+func (r *Response) UncachedFields() []string {
+	fields := make([]string, 0, len(r.NoCacheFields)+len(r.PrivateFields))
+	fields = append(fields, r.NoCacheFields...)
+	return append(fields, r.PrivateFields...)
+}
+
+// Freshness get the freshness lifetime of response for shared cache,
+// s-maxage, max-age and Expires(compared with Date) are used in order,
+// it returns false if the response has no explicit expiration time
+func (r *Response) Freshness(header http.Header) (int, bool) {
+	if r.SMaxAge >= 0 {
+		return r.SMaxAge, true
+	}
+	if r.MaxAge >= 0 {
+		return r.MaxAge, true
+	}
+	expires := header.Get(headerExpires)
+	if expires == "" {
+		return 0, false
+	}
+	expiresAt, err := http.ParseTime(expires)
+	// 无效的Expires（如 0）表示已过期
+	if err != nil {
+		return 0, true
+	}
+	date := parseDate(header)
+	lifetime := int(expiresAt.Sub(date).Seconds())
+	if lifetime < 0 {
+		lifetime = 0
+	}
+	return lifetime, true
+}
+
+// parseDate get the Date of response, it returns now if the Date is invalid
+func parseDate(header http.Header) time.Time {
+	if value := header.Get(headerDate); value != "" {
+		if date, err := http.ParseTime(value); err == nil {
+			return date
+		}
+	}
+	return time.Now()
+}
+
+// HeuristicFreshness get the heuristic freshness lifetime of response,
+// it is 10% of the interval since the Last-Modified and no more than one day,
+// only the heuristically cacheable status code is supported
+func HeuristicFreshness(statusCode int, header http.Header) int {
+	if !heuristicStatusCodes[statusCode] {
+		return 0
+	}
+	value := header.Get(headerLastModified)
+	if value == "" {
+		return 0
+	}
+	lastModified, err := http.ParseTime(value)
+	if err != nil {
+		return 0
+	}
+	lifetime := int(parseDate(header).Sub(lastModified).Seconds() / 10)
+	if lifetime < 0 {
+		return 0
+	}
+	if lifetime > maxHeuristicSeconds {
+		return maxHeuristicSeconds
+	}
+	return lifetime
+}
+
+// ParseRequest parse the directives of request Cache-Control
+func ParseRequest(values ...string) *Request {
+	d := Parse(values...)
+	req := &Request{
+		NoCache:      d.Has(directiveNoCache),
+		NoStore:      d.Has(directiveNoStore),
+		OnlyIfCached: d.Has(directiveOnlyIfCached),
+		MaxAge:       d.Seconds(directiveMaxAge),
+		MaxStale:     d.Seconds(directiveMaxStale),
+		MinFresh:     d.Seconds(directiveMinFresh),
+	}
+	// max-stale未指定值，表示可接受任意过期时长
+	if value, ok := d[directiveMaxStale]; ok && value == "" {
+		req.MaxStale = maxDeltaSeconds
+	}
+	return req
+}
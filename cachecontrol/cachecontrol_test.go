@@ -0,0 +1,249 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package cachecontrol
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		values     []string
+		directives Directives
+	}{
+		{
+			values:     nil,
+			directives: Directives{},
+		},
+		{
+			values: []string{
+				"Max-Age=60, public",
+				"s-maxage=3600",
+			},
+			directives: Directives{
+				"max-age":  "60",
+				"public":   "",
+				"s-maxage": "3600",
+			},
+		},
+		// 引号中的逗号
+		{
+			values: []string{
+				`no-cache="Set-Cookie, X-Token", max-age=10`,
+			},
+			directives: Directives{
+				"no-cache": "Set-Cookie, X-Token",
+				"max-age":  "10",
+			},
+		},
+		// 重复的指令使用首个
+		{
+			values: []string{
+				"max-age=10, max-age=20,,",
+			},
+			directives: Directives{
+				"max-age": "10",
+			},
+		},
+		{
+			values: []string{
+				`private="a\"b"`,
+			},
+			directives: Directives{
+				"private": `a"b`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.directives, Parse(tt.values...))
+	}
+}
+
+func TestDirectivesSeconds(t *testing.T) {
+	assert := assert.New(t)
+
+	d := Parse(`max-age=60, s-maxage="30", max-stale=abc, min-fresh=-1, stale-if-error=99999999999999999999`)
+	assert.Equal(60, d.Seconds("max-age"))
+	assert.Equal(30, d.Seconds("s-maxage"))
+	assert.Equal(0, d.Seconds("max-stale"))
+	assert.Equal(0, d.Seconds("min-fresh"))
+	assert.Equal(maxDeltaSeconds, d.Seconds("stale-if-error"))
+	assert.Equal(-1, d.Seconds("stale-while-revalidate"))
+}
+
+func TestParseResponse(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := ParseResponse(`no-cache="set-cookie", private="X-Token", must-revalidate, no-transform, max-age=60, stale-while-revalidate=10`)
+	assert.False(resp.NoCache)
+	assert.False(resp.Private)
+	assert.True(resp.IsStorable())
+	assert.Equal([]string{
+		"Set-Cookie",
+		"X-Token",
+	}, resp.UncachedFields())
+	assert.True(resp.MustRevalidate)
+	assert.False(resp.CanServeStale())
+	assert.True(resp.NoTransform)
+	assert.Equal(60, resp.MaxAge)
+	assert.Equal(-1, resp.SMaxAge)
+	assert.Equal(10, resp.StaleWhileRevalidate)
+	assert.Equal(-1, resp.StaleIfError)
+
+	resp = ParseResponse("no-cache")
+	assert.True(resp.NoCache)
+	assert.False(resp.IsStorable())
+	assert.Empty(resp.UncachedFields())
+
+	resp = ParseResponse("private, proxy-revalidate")
+	assert.True(resp.Private)
+	assert.False(resp.IsStorable())
+	assert.False(resp.CanServeStale())
+
+	assert.False(ParseResponse("no-store").IsStorable())
+}
+
+func TestResponseFreshness(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now().UTC()
+	date := now.Format(http.TimeFormat)
+	tests := []struct {
+		cacheControl string
+		header       http.Header
+		lifetime     int
+		explicit     bool
+	}{
+		{
+			cacheControl: "max-age=60, s-maxage=10",
+			lifetime:     10,
+			explicit:     true,
+		},
+		{
+			cacheControl: "max-age=60",
+			header: http.Header{
+				"Expires": []string{
+					now.Add(time.Hour).Format(http.TimeFormat),
+				},
+			},
+			lifetime: 60,
+			explicit: true,
+		},
+		// 根据Expires与Date
+		{
+			header: http.Header{
+				"Date": []string{
+					date,
+				},
+				"Expires": []string{
+					now.Add(time.Hour).Format(http.TimeFormat),
+				},
+			},
+			lifetime: 3600,
+			explicit: true,
+		},
+		// 无效的Expires
+		{
+			header: http.Header{
+				"Expires": []string{
+					"0",
+				},
+			},
+			lifetime: 0,
+			explicit: true,
+		},
+		// 已过期
+		{
+			header: http.Header{
+				"Date": []string{
+					date,
+				},
+				"Expires": []string{
+					now.Add(-time.Hour).Format(http.TimeFormat),
+				},
+			},
+			lifetime: 0,
+			explicit: true,
+		},
+		{
+			cacheControl: "public",
+			lifetime:     0,
+			explicit:     false,
+		},
+	}
+	for _, tt := range tests {
+		header := tt.header
+		if header == nil {
+			header = http.Header{}
+		}
+		lifetime, explicit := ParseResponse(tt.cacheControl).Freshness(header)
+		assert.Equal(tt.lifetime, lifetime)
+		assert.Equal(tt.explicit, explicit)
+	}
+}
+
+func TestHeuristicFreshness(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now().UTC()
+	header := http.Header{
+		"Date": []string{
+			now.Format(http.TimeFormat),
+		},
+		"Last-Modified": []string{
+			now.Add(-10 * time.Hour).Format(http.TimeFormat),
+		},
+	}
+	assert.Equal(3600, HeuristicFreshness(http.StatusOK, header))
+	// 非启发式可缓存的状态码
+	assert.Equal(0, HeuristicFreshness(http.StatusForbidden, header))
+	// 最大为1天
+	header.Set("Last-Modified", now.Add(-100*24*time.Hour).Format(http.TimeFormat))
+	assert.Equal(maxHeuristicSeconds, HeuristicFreshness(http.StatusOK, header))
+	// 无Last-Modified
+	assert.Equal(0, HeuristicFreshness(http.StatusOK, http.Header{}))
+}
+
+func TestParseRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	req := ParseRequest("max-stale=10, min-fresh=5, only-if-cached")
+	assert.Equal(10, req.MaxStale)
+	assert.Equal(5, req.MinFresh)
+	assert.Equal(-1, req.MaxAge)
+	assert.True(req.OnlyIfCached)
+	assert.False(req.NoCache)
+
+	req = ParseRequest("max-stale, no-cache, no-store, max-age=0")
+	assert.Equal(maxDeltaSeconds, req.MaxStale)
+	assert.Equal(-1, req.MinFresh)
+	assert.Equal(0, req.MaxAge)
+	assert.True(req.NoCache)
+	assert.True(req.NoStore)
+}
@@ -0,0 +1,121 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package compress
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EncodingIdentity no encoding
+	EncodingIdentity = "identity"
+	// EncodingAny any encoding that is not listed in Accept-Encoding
+	EncodingAny = "*"
+)
+
+// DefaultEncodings the default preference order of encodings,
+// the cacheable response is compressed to these encodings
+var DefaultEncodings = []string{
+	EncodingBrotli,
+	EncodingZstd,
+	EncodingGzip,
+}
+
+// IsDefaultEncoding check the encoding is one of the default encodings
+func IsDefaultEncoding(encoding string) bool {
+	for _, item := range DefaultEncodings {
+		if item == encoding {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAcceptEncoding parse the Accept-Encoding header to the quality of each encoding,
+// the quality is 1 if it is not specified
+func ParseAcceptEncoding(value string) map[string]float64 {
+	result := make(map[string]float64)
+	for _, item := range strings.Split(value, ",") {
+		arr := strings.Split(item, ";")
+		name := strings.ToLower(strings.TrimSpace(arr[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range arr[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) < 2 || (param[0] != 'q' && param[0] != 'Q') || param[1] != '=' {
+				continue
+			}
+			v, err := strconv.ParseFloat(strings.TrimSpace(param[2:]), 64)
+			// 非法的q值则忽略该编码
+			if err != nil || v < 0 || v > 1 {
+				q = 0
+				continue
+			}
+			q = v
+		}
+		result[name] = q
+	}
+	return result
+}
+
+// quality get the quality of encoding, it uses the quality of "*"
+// if the encoding is not listed, and identity is acceptable by default
+func quality(qualities map[string]float64, encoding string) float64 {
+	if q, ok := qualities[encoding]; ok {
+		return q
+	}
+	if q, ok := qualities[EncodingAny]; ok {
+		return q
+	}
+	if encoding == EncodingIdentity {
+		return 1
+	}
+	return 0
+}
+
+// Negotiate negotiate the encodings by Accept-Encoding(RFC 9110), it returns the encodings
+// which are accepted by client(sorted by the quality of client and the preference order of server),
+// and whether the identity(no encoding) is acceptable
+func Negotiate(acceptEncoding string, preferences []string) (encodings []string, identity bool) {
+	if len(preferences) == 0 {
+		preferences = DefaultEncodings
+	}
+	qualities := ParseAcceptEncoding(acceptEncoding)
+	encodings = make([]string, 0, len(preferences))
+	for _, encoding := range preferences {
+		// q为0表示不可接受
+		if quality(qualities, encoding) > 0 {
+			encodings = append(encodings, encoding)
+		}
+	}
+	// q值相同时保持服务端的优先顺序
+	sort.SliceStable(encodings, func(i, j int) bool {
+		return quality(qualities, encodings[i]) > quality(qualities, encodings[j])
+	})
+	identity = quality(qualities, EncodingIdentity) > 0
+	return
+}
@@ -0,0 +1,173 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package compress
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAcceptEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		value  string
+		result map[string]float64
+	}{
+		{
+			value:  "",
+			result: map[string]float64{},
+		},
+		{
+			value: "gzip, deflate, br",
+			result: map[string]float64{
+				"gzip":    1,
+				"deflate": 1,
+				"br":      1,
+			},
+		},
+		{
+			value: "GZIP;q=0.8, zstd;Q=0.9 , br;q=0",
+			result: map[string]float64{
+				"gzip": 0.8,
+				"zstd": 0.9,
+				"br":   0,
+			},
+		},
+		{
+			value: "gzip;q=a, br;q=2, zstd;level=1",
+			result: map[string]float64{
+				"gzip": 0,
+				"br":   0,
+				"zstd": 1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.result, ParseAcceptEncoding(tt.value))
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		acceptEncoding string
+		preferences    []string
+		result         []string
+		identity       bool
+	}{
+		{
+			acceptEncoding: "",
+			result:         []string{},
+			identity:       true,
+		},
+		{
+			acceptEncoding: "gzip, deflate, br, zstd",
+			result: []string{
+				"br",
+				"zstd",
+				"gzip",
+			},
+			identity: true,
+		},
+		{
+			acceptEncoding: "gzip, deflate, br, zstd",
+			preferences: []string{
+				"zstd",
+				"gzip",
+			},
+			result: []string{
+				"zstd",
+				"gzip",
+			},
+			identity: true,
+		},
+		{
+			acceptEncoding: "gzip;q=1, br;q=0.5, zstd;q=0.8",
+			result: []string{
+				"gzip",
+				"zstd",
+				"br",
+			},
+			identity: true,
+		},
+		{
+			acceptEncoding: "gzip, br;q=0",
+			result: []string{
+				"gzip",
+			},
+			identity: true,
+		},
+		{
+			acceptEncoding: "gzip;q=0",
+			result:         []string{},
+			identity:       true,
+		},
+		// 未列出的编码使用*的q值
+		{
+			acceptEncoding: "*",
+			result: []string{
+				"br",
+				"zstd",
+				"gzip",
+			},
+			identity: true,
+		},
+		{
+			acceptEncoding: "gzip;q=0.5, *;q=0.8",
+			result: []string{
+				"br",
+				"zstd",
+				"gzip",
+			},
+			identity: true,
+		},
+		// *;q=0 则未列出的编码(包括identity)均不可接受
+		{
+			acceptEncoding: "gzip, *;q=0",
+			result: []string{
+				"gzip",
+			},
+			identity: false,
+		},
+		{
+			acceptEncoding: "br, identity;q=0",
+			result: []string{
+				"br",
+			},
+			identity: false,
+		},
+		{
+			acceptEncoding: "*;q=0, identity",
+			result:         []string{},
+			identity:       true,
+		},
+	}
+	for _, tt := range tests {
+		result, identity := Negotiate(tt.acceptEncoding, tt.preferences)
+		assert.Equal(tt.result, result, tt.acceptEncoding)
+		assert.Equal(tt.identity, identity, tt.acceptEncoding)
+	}
+}
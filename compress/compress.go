@@ -27,7 +27,6 @@ import (
 	"errors"
 	"sync"
 
-	"github.com/andybalholm/brotli"
 	"github.com/vicanso/pike/config"
 	"go.uber.org/atomic"
 )
@@ -38,11 +37,14 @@ const (
 	EncodingLZ4    = "lz4"
 	EncodingSnappy = "snz"
 	EncodingZSTD   = "zst"
+	// EncodingZstd zstd的http content-coding
+	EncodingZstd = "zstd"
 )
 
 type (
 	compressSrv struct {
-		levels map[string]*atomic.Int32
+		// 各编码的压缩级别，未设置的则使用encoder的默认级别
+		levels *sync.Map
 	}
 	CompressOption struct {
 		Name   string
@@ -59,9 +61,10 @@ var defaultCompressSrvList = NewServices([]CompressOption{
 	{
 		Name: BestCompression,
 		Levels: map[string]int{
-			// -1则会选择默认的压缩级别
+			// -1则会选择默认的压缩级别，br与zstd的高级别压缩耗时过长
 			"br":   -1,
 			"gzip": gzip.BestCompression,
+			"zstd": -1,
 		},
 	},
 })
@@ -83,13 +86,8 @@ func NewServices(opts []CompressOption) *compressSrvs {
 
 // NewService new compress service
 func NewService() *compressSrv {
-	// 配置压缩级别，只设置了gzip与br
-	levels := map[string]*atomic.Int32{
-		EncodingGzip:   atomic.NewInt32(gzip.DefaultCompression),
-		EncodingBrotli: atomic.NewInt32(brotli.DefaultCompression),
-	}
 	return &compressSrv{
-		levels: levels,
+		levels: &sync.Map{},
 	}
 }
 
@@ -142,77 +140,51 @@ func Get(name string) *compressSrv {
 	return defaultCompressSrvList.Get(name)
 }
 
-// GetLevel get compress level
+// GetLevel get compress level, the default level of encoder is returned if it is not set
 func (srv *compressSrv) GetLevel(encoding string) int {
-	levelValue, ok := srv.levels[encoding]
-	if !ok {
+	value, ok := srv.levels.Load(encoding)
+	if ok {
+		if levelValue, ok := value.(*atomic.Int32); ok {
+			return int(levelValue.Load())
+		}
+	}
+	enc := GetEncoder(encoding)
+	if enc == nil {
 		return 0
 	}
-	return int(levelValue.Load())
+	return enc.DefaultLevel()
 }
 
-// SetLevels set compres levels
+// SetLevels set compres levels, the level of encoder which is not registered is ignored
 func (srv *compressSrv) SetLevels(levels map[string]int) {
 	for name, value := range levels {
-		levelValue, ok := srv.levels[name]
-		if ok {
+		if GetEncoder(name) == nil {
+			continue
+		}
+		v, _ := srv.levels.LoadOrStore(name, atomic.NewInt32(int32(value)))
+		if levelValue, ok := v.(*atomic.Int32); ok {
 			levelValue.Store(int32(value))
 		}
 	}
 }
 
-// Decompress decompress data
-func (srv *compressSrv) Decompress(encoding string, data []byte) ([]byte, error) {
-	switch encoding {
-	case EncodingGzip:
-		return srv.Gunzip(data)
-	case EncodingBrotli:
-		return srv.BrotliDecode(data)
-	case EncodingLZ4:
-		return srv.LZ4Decode(data)
-	case EncodingSnappy:
-		return srv.SnappyDecode(data)
-	case EncodingZSTD:
-		return srv.ZSTDDecode(data)
-	case "":
-		return data, nil
+// Encode compress data by the encoder of encoding
+func (srv *compressSrv) Encode(encoding string, data []byte) ([]byte, error) {
+	enc := GetEncoder(encoding)
+	if enc == nil {
+		return nil, notSupportedEncoding
 	}
-	return nil, notSupportedEncoding
-}
-
-// Gzip compress data by gzip
-func (srv *compressSrv) Gzip(data []byte) ([]byte, error) {
-	level := srv.GetLevel(EncodingGzip)
-	return doGzip(data, level)
+	return enc.Encode(data, srv.GetLevel(encoding))
 }
 
-// Gunzip decompress data by gzip
-func (srv *compressSrv) Gunzip(data []byte) ([]byte, error) {
-	return doGunzip(data)
-}
-
-// Brotli compress data by br
-func (srv *compressSrv) Brotli(data []byte) ([]byte, error) {
-	level := srv.GetLevel(EncodingBrotli)
-	return doBrotli(data, level)
-}
-
-// BrotliDecode decompress data by brotli
-func (srv *compressSrv) BrotliDecode(data []byte) ([]byte, error) {
-	return doBrotliDecode(data)
-}
-
-// LZ4Decode decompress data by lz4
-func (srv *compressSrv) LZ4Decode(data []byte) ([]byte, error) {
-	return doLZ4Decode(data)
-}
-
-// SnappyDecode decompress data by snappy
-func (srv *compressSrv) SnappyDecode(data []byte) ([]byte, error) {
-	return doSnappyDecode(data)
-}
-
-// ZSTDDecode decompress data by zstd
-func (srv *compressSrv) ZSTDDecode(data []byte) ([]byte, error) {
-	return doZSTDDecode(data)
+// Decompress decompress data by the encoder of encoding
+func (srv *compressSrv) Decompress(encoding string, data []byte) ([]byte, error) {
+	if encoding == "" {
+		return data, nil
+	}
+	enc := GetEncoder(encoding)
+	if enc == nil {
+		return nil, notSupportedEncoding
+	}
+	return enc.Decode(data)
 }
@@ -39,13 +39,18 @@ func TestCompressLevel(t *testing.T) {
 	srv := NewService()
 	assert.Equal(gzip.DefaultCompression, srv.GetLevel(EncodingGzip))
 	assert.Equal(brotli.DefaultCompression, srv.GetLevel(EncodingBrotli))
+	assert.Equal(zstdDefaultCompression, srv.GetLevel(EncodingZstd))
 
 	srv.SetLevels(map[string]int{
 		EncodingGzip:   1,
 		EncodingBrotli: 2,
+		EncodingZstd:   10,
 	})
 	assert.Equal(1, srv.GetLevel(EncodingGzip))
 	assert.Equal(2, srv.GetLevel(EncodingBrotli))
+	assert.Equal(10, srv.GetLevel(EncodingZstd))
+
+	assert.Equal(-1, Get(BestCompression).GetLevel(EncodingZstd))
 }
 
 func TestCompressList(t *testing.T) {
@@ -104,16 +109,28 @@ func TestDecompress(t *testing.T) {
 	}{
 		{
 			fn: func() ([]byte, error) {
-				return Get("").Gzip(data)
+				return Get("").Encode(EncodingGzip, data)
 			},
 			encoding: EncodingGzip,
 		},
 		{
 			fn: func() ([]byte, error) {
-				return Get("").Brotli(data)
+				return Get("").Encode(EncodingBrotli, data)
 			},
 			encoding: EncodingBrotli,
 		},
+		{
+			fn: func() ([]byte, error) {
+				return Get("").Encode(EncodingZstd, data)
+			},
+			encoding: EncodingZstd,
+		},
+		{
+			fn: func() ([]byte, error) {
+				return Get("").Encode(EncodingZstd, data)
+			},
+			encoding: EncodingZSTD,
+		},
 		{
 			fn: func() ([]byte, error) {
 				return doLZ4Encode(data, 0)
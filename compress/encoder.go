@@ -0,0 +1,195 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package compress
+
+import (
+	"compress/gzip"
+	"sort"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/vicanso/pike/config"
+)
+
+type (
+	// Encoder the encoder of content encoding
+	Encoder interface {
+		// Name the name of encoding, it is the same as Content-Encoding
+		Name() string
+		// Encode encode the data with level
+		Encode(data []byte, level int) ([]byte, error)
+		// Decode decode the data
+		Decode(data []byte) ([]byte, error)
+		// LevelRange the min and max of level
+		LevelRange() (min, max int)
+		// DefaultLevel the default level of encoder
+		DefaultLevel() int
+	}
+	// EncoderOption the option of encoder
+	EncoderOption struct {
+		Name         string
+		MinLevel     int
+		MaxLevel     int
+		DefaultLevel int
+		Encode       func(data []byte, level int) ([]byte, error)
+		Decode       func(data []byte) ([]byte, error)
+	}
+	encoder struct {
+		opt EncoderOption
+	}
+)
+
+// encoders 需要在压缩服务初始化之前注册，因此不在init中注册
+var encoders = newBuiltinEncoders()
+
+func newBuiltinEncoders() *sync.Map {
+	m := &sync.Map{}
+	builtinEncoders := []EncoderOption{
+		{
+			Name:         EncodingGzip,
+			MinLevel:     gzip.BestSpeed,
+			MaxLevel:     gzip.BestCompression,
+			DefaultLevel: gzip.DefaultCompression,
+			Encode:       doGzip,
+			Decode:       doGunzip,
+		},
+		{
+			Name:         EncodingBrotli,
+			MinLevel:     brotli.BestSpeed,
+			MaxLevel:     brotli.BestCompression,
+			DefaultLevel: brotli.DefaultCompression,
+			Encode:       doBrotli,
+			Decode:       doBrotliDecode,
+		},
+		{
+			Name:         EncodingZstd,
+			MinLevel:     zstdMinCompression,
+			MaxLevel:     zstdMaxCompression,
+			DefaultLevel: zstdDefaultCompression,
+			Encode:       doZstd,
+			Decode:       doZSTDDecode,
+		},
+		// 以下编码只用于解压upstream的响应数据
+		{
+			Name:         EncodingZSTD,
+			MinLevel:     zstdMinCompression,
+			MaxLevel:     zstdMaxCompression,
+			DefaultLevel: zstdDefaultCompression,
+			Encode:       doZstd,
+			Decode:       doZSTDDecode,
+		},
+		{
+			Name:   EncodingLZ4,
+			Encode: doLZ4Encode,
+			Decode: doLZ4Decode,
+		},
+		{
+			Name: EncodingSnappy,
+			Encode: func(data []byte, _ int) ([]byte, error) {
+				return doSnappyEncode(data), nil
+			},
+			Decode: doSnappyDecode,
+		},
+	}
+	for _, opt := range builtinEncoders {
+		m.Store(opt.Name, NewEncoder(opt))
+	}
+	return m
+}
+
+func init() {
+	// 配置的压缩级别以及编码根据已注册的encoder校验
+	config.SetEncoderLevelRange(func(name string) (min, max int, ok bool) {
+		enc := GetEncoder(name)
+		if enc == nil {
+			return
+		}
+		min, max = enc.LevelRange()
+		ok = true
+		return
+	})
+}
+
+// NewEncoder new an encoder
+func NewEncoder(opt EncoderOption) Encoder {
+	return &encoder{
+		opt: opt,
+	}
+}
+
+// Name get the name of encoder
+func (enc *encoder) Name() string {
+	return enc.opt.Name
+}
+
+// Encode encode the data with level
+func (enc *encoder) Encode(data []byte, level int) ([]byte, error) {
+	return enc.opt.Encode(data, level)
+}
+
+// Decode decode the data
+func (enc *encoder) Decode(data []byte) ([]byte, error) {
+	return enc.opt.Decode(data)
+}
+
+// LevelRange get the min and max of level
+func (enc *encoder) LevelRange() (min, max int) {
+	return enc.opt.MinLevel, enc.opt.MaxLevel
+}
+
+// DefaultLevel get the default level
+func (enc *encoder) DefaultLevel() int {
+	return enc.opt.DefaultLevel
+}
+
+// Register register the encoder, the encoder of the same name will be replaced
+func Register(enc Encoder) {
+	encoders.Store(enc.Name(), enc)
+}
+
+// GetEncoder get the encoder by name, nil will be returned if it is not registered
+func GetEncoder(name string) Encoder {
+	value, ok := encoders.Load(name)
+	if !ok {
+		return nil
+	}
+	enc, ok := value.(Encoder)
+	if !ok {
+		return nil
+	}
+	return enc
+}
+
+// Encoders get the name list of registered encoders
+func Encoders() []string {
+	names := make([]string, 0)
+	encoders.Range(func(key, _ interface{}) bool {
+		name, ok := key.(string)
+		if ok {
+			names = append(names, name)
+		}
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,164 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package compress
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestBuiltinEncoders(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{
+		EncodingBrotli,
+		EncodingGzip,
+		EncodingLZ4,
+		EncodingSnappy,
+		EncodingZSTD,
+		EncodingZstd,
+	}, Encoders())
+
+	data := compressTestData
+	for _, name := range Encoders() {
+		enc := GetEncoder(name)
+		assert.Equal(name, enc.Name())
+		min, max := enc.LevelRange()
+		assert.True(min <= max)
+
+		buf, err := enc.Encode(data, max)
+		assert.Nil(err)
+		assert.NotEqual(data, buf)
+		buf, err = enc.Decode(buf)
+		assert.Nil(err)
+		assert.Equal(data, buf)
+	}
+	assert.Nil(GetEncoder("deflate"))
+}
+
+func TestRegisterEncoder(t *testing.T) {
+	assert := assert.New(t)
+	name := "reverse"
+	reverse := func(data []byte, _ int) ([]byte, error) {
+		result := make([]byte, len(data))
+		for index, b := range data {
+			result[len(data)-index-1] = b
+		}
+		return result, nil
+	}
+	Register(NewEncoder(EncoderOption{
+		Name:         name,
+		MinLevel:     1,
+		MaxLevel:     3,
+		DefaultLevel: 2,
+		Encode:       reverse,
+		Decode: func(data []byte) ([]byte, error) {
+			return reverse(data, 0)
+		},
+	}))
+	defer encoders.Delete(name)
+
+	enc := GetEncoder(name)
+	assert.NotNil(enc)
+	min, max := enc.LevelRange()
+	assert.Equal(1, min)
+	assert.Equal(3, max)
+	assert.Contains(Encoders(), name)
+
+	srv := NewService()
+	assert.Equal(2, srv.GetLevel(name))
+	srv.SetLevels(map[string]int{
+		name: 3,
+	})
+	assert.Equal(3, srv.GetLevel(name))
+
+	buf, err := srv.Encode(name, []byte("abc"))
+	assert.Nil(err)
+	assert.Equal([]byte("cba"), buf)
+	buf, err = srv.Decompress(name, buf)
+	assert.Nil(err)
+	assert.Equal([]byte("abc"), buf)
+
+	// 未注册的encoder
+	_, err = srv.Encode("deflate", []byte("abc"))
+	assert.Equal(notSupportedEncoding, err)
+	srv.SetLevels(map[string]int{
+		"deflate": 1,
+	})
+	assert.Equal(0, srv.GetLevel("deflate"))
+}
+
+func TestValidateCompressConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		levels map[string]uint
+		valid  bool
+	}{
+		{
+			levels: map[string]uint{
+				"gzip": 9,
+				"br":   11,
+				"zstd": 19,
+			},
+			valid: true,
+		},
+		{
+			levels: map[string]uint{
+				"gzip": 0,
+			},
+			valid: true,
+		},
+		{
+			levels: map[string]uint{
+				"gzip": 10,
+			},
+			valid: false,
+		},
+		{
+			levels: map[string]uint{
+				"zstd": 23,
+			},
+			valid: false,
+		},
+		{
+			levels: map[string]uint{
+				"deflate": 1,
+			},
+			valid: false,
+		},
+	}
+	for _, tt := range tests {
+		c := &config.PikeConfig{
+			Compresses: []config.CompressConfig{
+				{
+					Name:   "test",
+					Levels: tt.levels,
+				},
+			},
+		}
+		err := c.Validate()
+		assert.Equal(tt.valid, err == nil)
+	}
+}
@@ -26,6 +26,22 @@ import (
 	"github.com/klauspost/compress/zstd"
 )
 
+const (
+	// zstd的压缩级别使用zstd官方的1-22级别
+	zstdMinCompression     = 1
+	zstdMaxCompression     = 22
+	zstdDefaultCompression = 3
+)
+
+// doZstd compress data by zstd with the level of zstd(1-22)
+func doZstd(data []byte, level int) ([]byte, error) {
+	// 0或非法的级别则使用默认级别
+	if level <= 0 {
+		level = zstdDefaultCompression
+	}
+	return doZSTDEncode(data, int(zstd.EncoderLevelFromZstd(level)))
+}
+
 func doZSTDEncode(data []byte, level int) ([]byte, error) {
 	l := zstd.EncoderLevel(level)
 	if l < zstd.SpeedFastest || l > zstd.SpeedBestCompression {
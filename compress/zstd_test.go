@@ -18,3 +18,17 @@ func TestDoZSTDDecode(t *testing.T) {
 	assert.Nil(err)
 	assert.Equal(data, buf)
 }
+
+func TestDoZstd(t *testing.T) {
+	assert := assert.New(t)
+	data := compressTestData
+	for _, level := range []int{0, 1, 3, 19, 22} {
+		dst, err := doZstd(data, level)
+		assert.Nil(err)
+		assert.NotEqual(data, dst)
+
+		buf, err := doZSTDDecode(dst)
+		assert.Nil(err)
+		assert.Equal(data, buf)
+	}
+}
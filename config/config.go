@@ -67,8 +67,9 @@ type (
 	}
 	// CompressConfig compress config
 	CompressConfig struct {
-		Name   string          `json:"name,omitempty" yaml:"name,omitempty" validate:"required,xName"`
-		Levels map[string]uint `json:"levels,omitempty" yaml:"levels,omitempty"`
+		Name string `json:"name,omitempty" yaml:"name,omitempty" validate:"required,xName"`
+		// 各编码的压缩级别，编码需为已注册的encoder，0表示使用默认级别
+		Levels map[string]uint `json:"levels,omitempty" yaml:"levels,omitempty" validate:"omitempty,xEncoderLevels"`
 		Remark string          `json:"remark,omitempty" yaml:"remark,omitempty"`
 	}
 	// CacheConfig cache config
@@ -77,7 +78,34 @@ type (
 		Size       int    `json:"size,omitempty" yaml:"size,omitempty" validate:"required,gt=0" `
 		HitForPass string `json:"hitForPass,omitempty" yaml:"hitForPass,omitempty" validate:"required,xDuration"`
 		Store      string `json:"store,omitempty" yaml:"store,omitempty" validate:"omitempty,url"`
-		Remark     string `json:"remark,omitempty" yaml:"remark,omitempty"`
+		// 默认的stale-while-revalidate时长
+		StaleWhileRevalidate string `json:"staleWhileRevalidate,omitempty" yaml:"staleWhileRevalidate,omitempty" validate:"omitempty,xDuration"`
+		// 默认的stale-if-error时长
+		StaleIfError string `json:"staleIfError,omitempty" yaml:"staleIfError,omitempty" validate:"omitempty,xDuration"`
+		// 缓存数据的最大字节数，如 512mb
+		MaxBytes string `json:"maxBytes,omitempty" yaml:"maxBytes,omitempty" validate:"omitempty,xSize"`
+		// 单个缓存数据的最大字节数，超过则不缓存，如 10mb
+		MaxObjectSize string `json:"maxObjectSize,omitempty" yaml:"maxObjectSize,omitempty" validate:"omitempty,xSize"`
+		// 缓存标签的响应头，如 Surrogate-Key 或 Cache-Tag
+		TagHeader string `json:"tagHeader,omitempty" yaml:"tagHeader,omitempty" validate:"omitempty,ascii"`
+		// 等待相同请求fetching完成的最大时长，如 3s
+		WaitTimeout string `json:"waitTimeout,omitempty" yaml:"waitTimeout,omitempty" validate:"omitempty,xDuration"`
+		// 等待超时后是否转发至upstream，否则返回504
+		PassOnWaitTimeout bool `json:"passOnWaitTimeout,omitempty" yaml:"passOnWaitTimeout,omitempty"`
+		// 出错的响应不设置为hit for pass
+		SkipHitForPassOnError bool `json:"skipHitForPassOnError,omitempty" yaml:"skipHitForPassOnError,omitempty"`
+		// 可缓存的响应状态码及其默认缓存有效期（响应未设置max-age时使用），如 404: 30s，
+		// 未配置时除5xx之外的状态码均可缓存，5xx的响应不可缓存
+		StatusTTL map[string]string `json:"statusTTL,omitempty" yaml:"statusTTL,omitempty" validate:"omitempty,dive,keys,xCacheableStatus,endkeys,xDuration"`
+		// 响应未设置缓存有效期时，根据Last-Modified计算启发式的缓存有效期
+		HeuristicFreshness bool `json:"heuristicFreshness,omitempty" yaml:"heuristicFreshness,omitempty"`
+		// 命中次数达到该值的缓存，在有效期的最后prefetchPercent%内预先更新，0表示不启用
+		PrefetchHits int `json:"prefetchHits,omitempty" yaml:"prefetchHits,omitempty" validate:"omitempty,gt=0"`
+		// 预先更新的有效期百分比，默认为10
+		PrefetchPercent int `json:"prefetchPercent,omitempty" yaml:"prefetchPercent,omitempty" validate:"omitempty,gt=0,lt=100"`
+		// 非安全请求（POST、PUT、PATCH与DELETE）成功后，删除其对应url（以及Location与Content-Location）的缓存
+		InvalidateOnUnsafe bool   `json:"invalidateOnUnsafe,omitempty" yaml:"invalidateOnUnsafe,omitempty"`
+		Remark             string `json:"remark,omitempty" yaml:"remark,omitempty"`
 	}
 	// UpstreamServerConfig upstream server config
 	UpstreamServerConfig struct {
@@ -107,7 +135,53 @@ type (
 		ReqHeaders   []string `json:"reqHeaders,omitempty" yaml:"reqHeaders,omitempty" validate:"omitempty,dive,xDivide"`
 		Hosts        []string `json:"hosts,omitempty" yaml:"hosts,omitempty" validate:"omitempty,dive,hostname"`
 		ProxyTimeout string   `json:"proxyTimeout,omitempty" yaml:"proxyTimeout,omitempty" validate:"omitempty,xDuration"`
-		Remark       string   `json:"remark,omitempty" yaml:"remark,omitempty"`
+		// 缓存key的生成配置
+		CacheKey *CacheKeyConfig `json:"cacheKey,omitempty" yaml:"cacheKey,omitempty" validate:"omitempty"`
+		// 缓存有效期的规则，按顺序匹配，使用首个匹配的规则
+		CacheRules []CacheRuleConfig `json:"cacheRules,omitempty" yaml:"cacheRules,omitempty" validate:"omitempty,dive"`
+		// 返回给客户端的缓存响应头配置
+		ClientCache *ClientCacheConfig `json:"clientCache,omitempty" yaml:"clientCache,omitempty" validate:"omitempty"`
+		Remark      string             `json:"remark,omitempty" yaml:"remark,omitempty"`
+	}
+	// ClientCacheConfig client cache config of location
+	ClientCacheConfig struct {
+		// 返回给客户端的Cache-Control，如 max-age=60 或 no-cache
+		CacheControl string `json:"cacheControl,omitempty" yaml:"cacheControl,omitempty" validate:"required,ascii"`
+		// 保留Age响应头，默认删除
+		KeepAge bool `json:"keepAge,omitempty" yaml:"keepAge,omitempty"`
+	}
+	// CacheRuleConfig cache rule config of location
+	CacheRuleConfig struct {
+		// 匹配的url前缀，如 /static/
+		Prefixes []string `json:"prefixes,omitempty" yaml:"prefixes,omitempty" validate:"omitempty,dive,xURLPath"`
+		// 匹配的文件扩展名，如 .js
+		Extensions []string `json:"extensions,omitempty" yaml:"extensions,omitempty" validate:"omitempty,dive,min=1"`
+		// 匹配的响应数据类型（前缀匹配），如 image/
+		ContentTypes []string `json:"contentTypes,omitempty" yaml:"contentTypes,omitempty" validate:"omitempty,dive,min=1"`
+		// 强制设置的缓存有效期，忽略响应的Cache-Control，如 1m
+		TTL string `json:"ttl,omitempty" yaml:"ttl,omitempty" validate:"omitempty,xDuration"`
+		// 缓存有效期的最大值，如 1h
+		MaxTTL string `json:"maxTTL,omitempty" yaml:"maxTTL,omitempty" validate:"omitempty,xDuration"`
+		// 判断是否可缓存时忽略Set-Cookie，缓存的响应会删除Set-Cookie
+		IgnoreSetCookie bool `json:"ignoreSetCookie,omitempty" yaml:"ignoreSetCookie,omitempty"`
+		// 不可缓存
+		NoCache bool   `json:"noCache,omitempty" yaml:"noCache,omitempty"`
+		Remark  string `json:"remark,omitempty" yaml:"remark,omitempty"`
+	}
+	// CacheKeyConfig cache key config of location
+	CacheKeyConfig struct {
+		// 忽略query string
+		IgnoreQuery bool `json:"ignoreQuery,omitempty" yaml:"ignoreQuery,omitempty"`
+		// 对query string排序
+		SortQuery bool `json:"sortQuery,omitempty" yaml:"sortQuery,omitempty"`
+		// 仅使用的query，支持以*结尾的前缀匹配，如 utm_*
+		IncludeQueries []string `json:"includeQueries,omitempty" yaml:"includeQueries,omitempty" validate:"omitempty,dive,min=1"`
+		// 忽略的query，支持以*结尾的前缀匹配，如 utm_*
+		ExcludeQueries []string `json:"excludeQueries,omitempty" yaml:"excludeQueries,omitempty" validate:"omitempty,dive,min=1"`
+		// 添加至缓存key的请求头
+		Headers []string `json:"headers,omitempty" yaml:"headers,omitempty" validate:"omitempty,dive,min=1"`
+		// 添加至缓存key的cookie
+		Cookies []string `json:"cookies,omitempty" yaml:"cookies,omitempty" validate:"omitempty,dive,min=1"`
 	}
 	// ServerConfig server config
 	ServerConfig struct {
@@ -120,7 +194,13 @@ type (
 		CompressMinLength string `json:"compressMinLength,omitempty" yaml:"compressMinLength,omitempty" validate:"omitempty,xSize"`
 		// 压缩数据类型
 		CompressContentTypeFilter string `json:"compressContentTypeFilter,omitempty" yaml:"compressContentTypeFilter,omitempty" validate:"omitempty,xFilter"`
-		Remark                    string `json:"remark,omitempty" yaml:"remark,omitempty"`
+		// 压缩编码的优先顺序，为空则使用默认顺序(br, zstd, gzip)
+		CompressEncodings []string `json:"compressEncodings,omitempty" yaml:"compressEncodings,omitempty" validate:"omitempty,dive,xEncoder"`
+		// 允许客户端通过no-cache强制刷新缓存
+		ForceRefresh bool `json:"forceRefresh,omitempty" yaml:"forceRefresh,omitempty"`
+		// 允许强制刷新缓存的客户端IP，支持IP与CIDR，为空则不限制
+		ForceRefreshIPs []string `json:"forceRefreshIPs,omitempty" yaml:"forceRefreshIPs,omitempty" validate:"omitempty,dive,cidr|ip"`
+		Remark          string   `json:"remark,omitempty" yaml:"remark,omitempty"`
 	}
 )
 
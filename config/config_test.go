@@ -187,11 +187,107 @@ func TestValidate(t *testing.T) {
 				Compress:                  "compress-test",
 				CompressMinLength:         "1kb",
 				CompressContentTypeFilter: "text|json",
+				CompressEncodings: []string{
+					"zstd",
+					"gzip",
+				},
 			},
 		},
 	}
 	err = c.Validate()
 	assert.Nil(err)
+
+	SetEncoderLevelRange(func(name string) (min, max int, ok bool) {
+		if name == "gzip" || name == "zstd" {
+			return 1, 9, true
+		}
+		return
+	})
+	defer SetEncoderLevelRange(nil)
+	err = c.Validate()
+	assert.Nil(err)
+
+	// 未注册的压缩编码
+	c.Servers[0].CompressEncodings = []string{
+		"deflate",
+	}
+	err = c.Validate()
+	assert.NotNil(err)
+	c.Servers[0].CompressEncodings = nil
+
+	// 压缩级别，0表示默认级别
+	c.Compresses[0].Levels = map[string]uint{
+		"gzip": 9,
+		"zstd": 0,
+	}
+	err = c.Validate()
+	assert.Nil(err)
+
+	// 压缩级别超出范围
+	c.Compresses[0].Levels = map[string]uint{
+		"gzip": 10,
+	}
+	err = c.Validate()
+	assert.NotNil(err)
+
+	// 未注册的压缩编码
+	c.Compresses[0].Levels = map[string]uint{
+		"deflate": 1,
+	}
+	err = c.Validate()
+	assert.NotNil(err)
+}
+
+func TestValidateCacheStatusTTL(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		statusTTL map[string]string
+		valid     bool
+	}{
+		{
+			statusTTL: map[string]string{
+				"200": "0s",
+				"301": "1h",
+				"404": "30s",
+			},
+			valid: true,
+		},
+		// 5xx不可缓存
+		{
+			statusTTL: map[string]string{
+				"502": "30s",
+			},
+		},
+		{
+			statusTTL: map[string]string{
+				"abc": "30s",
+			},
+		},
+		{
+			statusTTL: map[string]string{
+				"404": "abc",
+			},
+		},
+	}
+	for _, tt := range tests {
+		c := &PikeConfig{
+			Caches: []CacheConfig{
+				{
+					Name:       "cache-test",
+					Size:       100,
+					HitForPass: "1m",
+					StatusTTL:  tt.statusTTL,
+				},
+			},
+		}
+		err := c.Validate()
+		if tt.valid {
+			assert.Nil(err)
+		} else {
+			assert.NotNil(err)
+		}
+	}
 }
 
 func TestInitDefaultClient(t *testing.T) {
@@ -23,9 +23,11 @@
 package config
 
 import (
+	"net/http"
 	"net/url"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +38,17 @@ import (
 
 var defaultValidator = validator.New()
 
+// EncoderLevelRange get the level range of encoder, ok is false if the encoder is not registered
+type EncoderLevelRange func(name string) (min, max int, ok bool)
+
+// encoderLevelRange 由compress模块设置，避免循环引用
+var encoderLevelRange EncoderLevelRange
+
+// SetEncoderLevelRange set the function for validating the encoder and its level
+func SetEncoderLevelRange(fn EncoderLevelRange) {
+	encoderLevelRange = fn
+}
+
 func init() {
 
 	addAlias("xName", "max=20")
@@ -92,6 +105,52 @@ func init() {
 		_, err := regexp.Compile(value)
 		return err == nil
 	})
+	addValidate("xCacheableStatus", func(fl validator.FieldLevel) bool {
+		value, ok := toString(fl)
+		if !ok {
+			return false
+		}
+		// 5xx的响应不可缓存
+		code, err := strconv.Atoi(value)
+		return err == nil && code >= http.StatusOK && code < http.StatusInternalServerError
+	})
+	addValidate("xEncoder", func(fl validator.FieldLevel) bool {
+		value, ok := toString(fl)
+		if !ok {
+			return false
+		}
+		// 未设置则不校验
+		if encoderLevelRange == nil {
+			return true
+		}
+		_, _, ok = encoderLevelRange(value)
+		return ok
+	})
+	addValidate("xEncoderLevels", func(fl validator.FieldLevel) bool {
+		value := fl.Field()
+		if value.Kind() != reflect.Map {
+			return false
+		}
+		if encoderLevelRange == nil {
+			return true
+		}
+		iter := value.MapRange()
+		for iter.Next() {
+			if iter.Key().Kind() != reflect.String {
+				return false
+			}
+			min, max, ok := encoderLevelRange(iter.Key().String())
+			if !ok {
+				return false
+			}
+			// 0表示使用默认的压缩级别
+			level := int(iter.Value().Uint())
+			if level != 0 && (level < min || level > max) {
+				return false
+			}
+		}
+		return true
+	})
 	addValidate("xPolicy", func(fl validator.FieldLevel) bool {
 		value, ok := toString(fl)
 		if !ok {
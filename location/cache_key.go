@@ -0,0 +1,146 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 缓存key的生成配置，用于忽略无关的query（如utm_source）、对query排序，
+// 以及将指定的请求头与cookie添加至缓存key中
+
+package location
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/vicanso/pike/config"
+)
+
+// CacheKey cache key option of location
+type CacheKey struct {
+	IgnoreQuery    bool
+	SortQuery      bool
+	IncludeQueries []string
+	ExcludeQueries []string
+	Headers        []string
+	Cookies        []string
+}
+
+func newCacheKey(conf *config.CacheKeyConfig) *CacheKey {
+	if conf == nil {
+		return nil
+	}
+	return &CacheKey{
+		IgnoreQuery:    conf.IgnoreQuery,
+		SortQuery:      conf.SortQuery,
+		IncludeQueries: conf.IncludeQueries,
+		ExcludeQueries: conf.ExcludeQueries,
+		Headers:        conf.Headers,
+		Cookies:        conf.Cookies,
+	}
+}
+
+// matchQueryName check the name matches the list, the item ends with * matches prefix
+func matchQueryName(list []string, name string) bool {
+	for _, item := range list {
+		if strings.HasSuffix(item, "*") {
+			if strings.HasPrefix(name, item[:len(item)-1]) {
+				return true
+			}
+			continue
+		}
+		if item == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getQuery get the query of cache key
+func (ck *CacheKey) getQuery(rawQuery string) string {
+	if ck.IgnoreQuery || rawQuery == "" {
+		return ""
+	}
+	if len(ck.IncludeQueries) == 0 &&
+		len(ck.ExcludeQueries) == 0 &&
+		!ck.SortQuery {
+		return rawQuery
+	}
+	type queryItem struct {
+		name  string
+		value string
+	}
+	items := make([]queryItem, 0)
+	for _, value := range strings.Split(rawQuery, "&") {
+		if value == "" {
+			continue
+		}
+		name := value
+		if index := strings.Index(value, "="); index != -1 {
+			name = value[:index]
+		}
+		name, _ = url.QueryUnescape(name)
+		if len(ck.IncludeQueries) != 0 && !matchQueryName(ck.IncludeQueries, name) {
+			continue
+		}
+		if matchQueryName(ck.ExcludeQueries, name) {
+			continue
+		}
+		items = append(items, queryItem{
+			name:  name,
+			value: value,
+		})
+	}
+	// 只根据名称排序，相同名称的query保持原有顺序
+	if ck.SortQuery {
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].name < items[j].name
+		})
+	}
+	arr := make([]string, len(items))
+	for index, item := range items {
+		arr[index] = item.value
+	}
+	return strings.Join(arr, "&")
+}
+
+// GetURI get the uri of cache key from request, the query, headers and cookies are handled by cache key option
+func (ck *CacheKey) GetURI(req *http.Request) string {
+	uri := req.URL.EscapedPath()
+	if query := ck.getQuery(req.URL.RawQuery); query != "" {
+		uri += "?" + query
+	}
+	extras := make([]string, 0, len(ck.Headers)+len(ck.Cookies))
+	for _, name := range ck.Headers {
+		extras = append(extras, name+"="+url.QueryEscape(req.Header.Get(name)))
+	}
+	for _, name := range ck.Cookies {
+		value := ""
+		if cookie, _ := req.Cookie(name); cookie != nil {
+			value = cookie.Value
+		}
+		extras = append(extras, "cookie:"+name+"="+url.QueryEscape(value))
+	}
+	if len(extras) != 0 {
+		uri += " " + strings.Join(extras, "&")
+	}
+	return uri
+}
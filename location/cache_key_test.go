@@ -0,0 +1,134 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package location
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestNewCacheKey(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(newCacheKey(nil))
+
+	ck := newCacheKey(&config.CacheKeyConfig{
+		SortQuery: true,
+		Headers: []string{
+			"X-Device",
+		},
+	})
+	assert.True(ck.SortQuery)
+	assert.Equal([]string{"X-Device"}, ck.Headers)
+}
+
+func TestCacheKeyGetURI(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		ck     *CacheKey
+		url    string
+		header map[string]string
+		result string
+	}{
+		{
+			ck:     &CacheKey{},
+			url:    "/users/me?b=1&a=2",
+			result: "/users/me?b=1&a=2",
+		},
+		{
+			ck: &CacheKey{
+				IgnoreQuery: true,
+			},
+			url:    "/users/me?b=1&a=2",
+			result: "/users/me",
+		},
+		// 按名称排序，相同名称保持原有顺序
+		{
+			ck: &CacheKey{
+				SortQuery: true,
+			},
+			url:    "/users/me?b=1&a=2&b=0",
+			result: "/users/me?a=2&b=1&b=0",
+		},
+		{
+			ck: &CacheKey{
+				IncludeQueries: []string{
+					"id",
+					"page*",
+				},
+			},
+			url:    "/users?type=1&id=2&pageSize=10&page=1",
+			result: "/users?id=2&pageSize=10&page=1",
+		},
+		{
+			ck: &CacheKey{
+				SortQuery: true,
+				ExcludeQueries: []string{
+					"utm_*",
+					"_",
+				},
+			},
+			url:    "/users?utm_source=a&type=1&utm_medium=b&_=123&id=2",
+			result: "/users?id=2&type=1",
+		},
+		{
+			ck: &CacheKey{
+				ExcludeQueries: []string{
+					"utm_*",
+				},
+			},
+			url:    "/users?utm_source=a",
+			result: "/users",
+		},
+		{
+			ck: &CacheKey{
+				IgnoreQuery: true,
+				Headers: []string{
+					"X-Device",
+					"X-Lang",
+				},
+				Cookies: []string{
+					"ab",
+					"region",
+				},
+			},
+			url: "/users?id=1",
+			header: map[string]string{
+				"X-Device": "mobile",
+				"Cookie":   "ab=test 1; jt=abc",
+			},
+			result: "/users X-Device=mobile&X-Lang=&cookie:ab=test+1&cookie:region=",
+		},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url, nil)
+		for key, value := range tt.header {
+			req.Header.Set(key, value)
+		}
+		assert.Equal(tt.result, tt.ck.GetURI(req))
+	}
+}
@@ -0,0 +1,134 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 缓存有效期的规则，用于强制设置缓存有效期、限制缓存有效期的最大值、
+// 忽略Set-Cookie或者设置为不可缓存，可按url前缀、扩展名以及响应数据类型匹配
+
+package location
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/vicanso/pike/config"
+)
+
+// CacheRule cache rule of location
+type CacheRule struct {
+	Prefixes     []string
+	Extensions   []string
+	ContentTypes []string
+	// TTL 强制设置的缓存有效期(秒)
+	TTL int
+	// MaxTTL 缓存有效期的最大值(秒)
+	MaxTTL          int
+	IgnoreSetCookie bool
+	NoCache         bool
+}
+
+func newCacheRules(configs []config.CacheRuleConfig) []*CacheRule {
+	if len(configs) == 0 {
+		return nil
+	}
+	rules := make([]*CacheRule, 0, len(configs))
+	for _, item := range configs {
+		ttl, _ := time.ParseDuration(item.TTL)
+		maxTTL, _ := time.ParseDuration(item.MaxTTL)
+		extensions := make([]string, len(item.Extensions))
+		for index, ext := range item.Extensions {
+			// 统一以.开头
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			extensions[index] = strings.ToLower(ext)
+		}
+		contentTypes := make([]string, len(item.ContentTypes))
+		for index, contentType := range item.ContentTypes {
+			contentTypes[index] = strings.ToLower(contentType)
+		}
+		rules = append(rules, &CacheRule{
+			Prefixes:        item.Prefixes,
+			Extensions:      extensions,
+			ContentTypes:    contentTypes,
+			TTL:             int(ttl.Seconds()),
+			MaxTTL:          int(maxTTL.Seconds()),
+			IgnoreSetCookie: item.IgnoreSetCookie,
+			NoCache:         item.NoCache,
+		})
+	}
+	return rules
+}
+
+// Match check the url path and content type match the rule,
+// all the conditions of rule should be matched
+func (r *CacheRule) Match(urlPath, contentType string) bool {
+	if len(r.Prefixes) != 0 {
+		found := false
+		for _, item := range r.Prefixes {
+			if strings.HasPrefix(urlPath, item) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Extensions) != 0 {
+		ext := strings.ToLower(path.Ext(urlPath))
+		found := false
+		for _, item := range r.Extensions {
+			if item == ext {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ContentTypes) != 0 {
+		contentType = strings.ToLower(contentType)
+		found := false
+		for _, item := range r.ContentTypes {
+			if strings.HasPrefix(contentType, item) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// GetCacheRule get the first matched cache rule of location
+func (l *Location) GetCacheRule(urlPath, contentType string) *CacheRule {
+	for _, rule := range l.CacheRules {
+		if rule.Match(urlPath, contentType) {
+			return rule
+		}
+	}
+	return nil
+}
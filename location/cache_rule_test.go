@@ -0,0 +1,166 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package location
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestNewCacheRules(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(newCacheRules(nil))
+
+	rules := newCacheRules([]config.CacheRuleConfig{
+		{
+			Extensions: []string{
+				"JS",
+				".css",
+			},
+			ContentTypes: []string{
+				"Image/",
+			},
+			TTL:             "1m",
+			MaxTTL:          "1h",
+			IgnoreSetCookie: true,
+		},
+	})
+	assert.Equal([]*CacheRule{
+		{
+			Extensions: []string{
+				".js",
+				".css",
+			},
+			ContentTypes: []string{
+				"image/",
+			},
+			TTL:             60,
+			MaxTTL:          3600,
+			IgnoreSetCookie: true,
+		},
+	}, rules)
+}
+
+func TestCacheRuleMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		rule        *CacheRule
+		urlPath     string
+		contentType string
+		matched     bool
+	}{
+		// 无匹配条件
+		{
+			rule:    &CacheRule{},
+			urlPath: "/",
+			matched: true,
+		},
+		{
+			rule: &CacheRule{
+				Prefixes: []string{
+					"/static/",
+				},
+			},
+			urlPath: "/static/app.js",
+			matched: true,
+		},
+		{
+			rule: &CacheRule{
+				Prefixes: []string{
+					"/static/",
+				},
+			},
+			urlPath: "/api/users",
+			matched: false,
+		},
+		{
+			rule: &CacheRule{
+				Extensions: []string{
+					".js",
+				},
+			},
+			urlPath: "/static/APP.JS",
+			matched: true,
+		},
+		{
+			rule: &CacheRule{
+				Extensions: []string{
+					".js",
+				},
+			},
+			urlPath: "/static/app.css",
+			matched: false,
+		},
+		{
+			rule: &CacheRule{
+				ContentTypes: []string{
+					"image/",
+				},
+			},
+			urlPath:     "/logo",
+			contentType: "image/png",
+			matched:     true,
+		},
+		// 需要所有条件均匹配
+		{
+			rule: &CacheRule{
+				Prefixes: []string{
+					"/static/",
+				},
+				ContentTypes: []string{
+					"image/",
+				},
+			},
+			urlPath:     "/static/app.js",
+			contentType: "application/javascript",
+			matched:     false,
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.matched, tt.rule.Match(tt.urlPath, tt.contentType))
+	}
+}
+
+func TestGetCacheRule(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &Location{
+		CacheRules: []*CacheRule{
+			{
+				Prefixes: []string{
+					"/api/",
+				},
+				NoCache: true,
+			},
+			{
+				TTL: 60,
+			},
+		},
+	}
+	assert.Equal(l.CacheRules[0], l.GetCacheRule("/api/users", ""))
+	assert.Equal(l.CacheRules[1], l.GetCacheRule("/index.html", "text/html"))
+	assert.Nil((&Location{}).GetCacheRule("/", ""))
+}
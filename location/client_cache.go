@@ -0,0 +1,79 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 返回给客户端的缓存响应头，与缓存数据的有效期相互独立，
+// 如缓存使用s-maxage=3600，而客户端则使用max-age=60
+
+package location
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vicanso/elton"
+	"github.com/vicanso/pike/cachecontrol"
+	"github.com/vicanso/pike/config"
+)
+
+const (
+	headerAge     = "Age"
+	headerExpires = "Expires"
+)
+
+// ClientCache client cache option of location
+type ClientCache struct {
+	CacheControl string
+	KeepAge      bool
+	// maxAge 客户端缓存有效期，用于生成Expires，-1表示不可缓存
+	maxAge int
+}
+
+func newClientCache(conf *config.ClientCacheConfig) *ClientCache {
+	if conf == nil || conf.CacheControl == "" {
+		return nil
+	}
+	maxAge := -1
+	cc := cachecontrol.ParseResponse(conf.CacheControl)
+	if !cc.NoStore && !cc.NoCache {
+		maxAge = cc.MaxAge
+	}
+	return &ClientCache{
+		CacheControl: conf.CacheControl,
+		KeepAge:      conf.KeepAge,
+		maxAge:       maxAge,
+	}
+}
+
+// Rewrite rewrite the Cache-Control, Expires and Age of client response
+func (cc *ClientCache) Rewrite(header http.Header) {
+	header.Set(elton.HeaderCacheControl, cc.CacheControl)
+	if cc.maxAge >= 0 {
+		expires := time.Now().Add(time.Duration(cc.maxAge) * time.Second)
+		header.Set(headerExpires, expires.UTC().Format(http.TimeFormat))
+	} else {
+		header.Del(headerExpires)
+	}
+	// 缓存的age与客户端的缓存有效期无关，默认删除
+	if !cc.KeepAge {
+		header.Del(headerAge)
+	}
+}
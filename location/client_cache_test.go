@@ -0,0 +1,60 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package location
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+)
+
+func TestClientCache(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(newClientCache(nil))
+
+	cc := newClientCache(&config.ClientCacheConfig{
+		CacheControl: "public, max-age=60",
+	})
+	header := http.Header{}
+	header.Set("Cache-Control", "s-maxage=3600")
+	header.Set("Age", "10")
+	cc.Rewrite(header)
+	assert.Equal("public, max-age=60", header.Get("Cache-Control"))
+	assert.NotEmpty(header.Get("Expires"))
+	assert.Empty(header.Get("Age"))
+
+	cc = newClientCache(&config.ClientCacheConfig{
+		CacheControl: "no-cache",
+		KeepAge:      true,
+	})
+	header = http.Header{}
+	header.Set("Cache-Control", "s-maxage=3600")
+	header.Set("Expires", "Thu, 01 Jan 2099 00:00:00 GMT")
+	header.Set("Age", "10")
+	cc.Rewrite(header)
+	assert.Equal("no-cache", header.Get("Cache-Control"))
+	assert.Empty(header.Get("Expires"))
+	assert.Equal("10", header.Get("Age"))
+}
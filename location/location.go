@@ -55,6 +55,9 @@ type (
 		RequestHeader  http.Header
 		Query          url.Values
 		URLRewriter    Rewriter
+		CacheKey       *CacheKey
+		CacheRules     []*CacheRule
+		ClientCache    *ClientCache
 		priority       atomic.Int32
 	}
 	rewriteRegexp struct {
@@ -292,6 +295,9 @@ func convertConfigs(configs []config.LocationConfig) []Location {
 			Rewrites:     item.Rewrites,
 			Hosts:        item.Hosts,
 			ProxyTimeout: d,
+			CacheKey:     newCacheKey(item.CacheKey),
+			CacheRules:   newCacheRules(item.CacheRules),
+			ClientCache:  newClientCache(item.ClientCache),
 		}
 		l.ResponseHeader = fn(item.RespHeaders)
 		l.RequestHeader = fn(item.ReqHeaders)
@@ -191,6 +191,9 @@ func TestConvertConfig(t *testing.T) {
 			ReqHeaders:   reqHeaders,
 			RespHeaders:  respHeaders,
 			ProxyTimeout: "1m",
+			CacheKey: &config.CacheKeyConfig{
+				IgnoreQuery: true,
+			},
 		},
 	}
 	opts := convertConfigs(configs)
@@ -203,6 +206,7 @@ func TestConvertConfig(t *testing.T) {
 	assert.Equal(query, opts[0].Query)
 	assert.Equal(hosts, opts[0].Hosts)
 	assert.Equal(timeout, opts[0].ProxyTimeout)
+	assert.True(opts[0].CacheKey.IgnoreQuery)
 	assert.Equal(http.Header{
 		"X-Req-Id": []string{
 			reqID,
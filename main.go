@@ -2,11 +2,16 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/cookiejar"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 
 	"github.com/spf13/cobra"
@@ -20,6 +25,7 @@ import (
 	"github.com/vicanso/pike/server"
 	"github.com/vicanso/pike/store"
 	"github.com/vicanso/pike/upstream"
+	"github.com/vicanso/pike/warm"
 	"go.uber.org/automaxprocs/maxprocs"
 	"go.uber.org/zap"
 )
@@ -35,6 +41,10 @@ var (
 var alarmURL string
 var alarmTemplate string
 
+// cacheSnapshot 缓存快照文件，退出时保存，启动时加载
+var cacheSnapshot string
+var loadSnapshotOnce sync.Once
+
 func init() {
 
 	err := runCMD()
@@ -109,9 +119,53 @@ func update() (err error) {
 	location.Reset(pikeConfig.Locations)
 
 	server.Reset(pikeConfig.Servers)
+	// 首次启动时，在server监听前加载缓存快照
+	loadSnapshotOnce.Do(loadCacheSnapshot)
 	return server.Start()
 }
 
+// loadCacheSnapshot 加载缓存快照，加载后删除快照文件，避免再次加载已被删除的缓存
+func loadCacheSnapshot() {
+	if cacheSnapshot == "" {
+		return
+	}
+	count, skipped, err := cache.LoadSnapshot(cacheSnapshot)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Default().Error("load cache snapshot fail",
+				zap.String("file", cacheSnapshot),
+				zap.Error(err),
+			)
+		}
+		return
+	}
+	_ = os.Remove(cacheSnapshot)
+	log.Default().Info("load cache snapshot success",
+		zap.String("file", cacheSnapshot),
+		zap.Int("count", count),
+		zap.Int("skipped", skipped),
+	)
+}
+
+// saveCacheSnapshot 保存缓存快照
+func saveCacheSnapshot() {
+	if cacheSnapshot == "" {
+		return
+	}
+	count, err := cache.SaveSnapshot(cacheSnapshot)
+	if err != nil {
+		log.Default().Error("save cache snapshot fail",
+			zap.String("file", cacheSnapshot),
+			zap.Error(err),
+		)
+		return
+	}
+	log.Default().Info("save cache snapshot success",
+		zap.String("file", cacheSnapshot),
+		zap.Int("count", count),
+	)
+}
+
 func startAdminServer(addr string) error {
 	pikeConfig, err := config.Read()
 	if err != nil {
@@ -124,11 +178,157 @@ func startAdminServer(addr string) error {
 	})
 }
 
+// newWarmCmd 缓存预热命令，请求完成后退出
+func newWarmCmd() *cobra.Command {
+	configURL := ""
+	params := warm.Option{}
+	urlsFile := ""
+	sitemap := ""
+	upstreamName := ""
+	cmd := &cobra.Command{
+		Use:   "warm",
+		Short: "Warm the cache of server by requesting the url list",
+		Run: func(cmd *cobra.Command, args []string) {
+			// sitemap通过upstream获取，需要初始化upstream
+			if sitemap != "" {
+				err := config.InitDefaultClient(configURL)
+				if err != nil {
+					panic(err)
+				}
+				pikeConfig, err := config.Read()
+				if err != nil {
+					panic(err)
+				}
+				upstream.Reset(pikeConfig.Upstreams)
+			}
+			urls, err := warm.GetURLs(append(params.URLs, args...), urlsFile, upstreamName, sitemap)
+			if err != nil {
+				panic(err)
+			}
+			params.URLs = urls
+			task, err := warm.NewTask(params)
+			if err != nil {
+				panic(err)
+			}
+			task.Run(func(result warm.Result) {
+				cacheStatus := result.CacheStatus
+				if cacheStatus == "" {
+					cacheStatus = "-"
+				}
+				message := result.Message
+				if message == "" {
+					message = "-"
+				}
+				fmt.Printf("%d %s %dms %s %s\n", result.Status, cacheStatus, result.Consuming, result.URL, message)
+			})
+			progress := task.GetProgress(false)
+			fmt.Printf("total: %d, failed: %d\n", progress.Total, progress.Failed)
+			if progress.Failed != 0 {
+				os.Exit(1)
+			}
+			os.Exit(0)
+		},
+	}
+	cmd.Flags().StringVar(&configURL, "config", "pike.yml", "The config of pike, it's used to get the upstream of sitemap")
+	cmd.Flags().StringVar(&params.Addr, "addr", "127.0.0.1:3015", "The address of server, e.g.: 127.0.0.1:3015")
+	cmd.Flags().StringVar(&params.Host, "host", "", "The host of request if the url is not absolute, e.g.: test.com")
+	cmd.Flags().StringSliceVar(&params.URLs, "url", nil, "The url to warm, e.g.: /api/users/me")
+	cmd.Flags().StringVar(&urlsFile, "file", "", "The file of url list, one url per line, e.g.: /tmp/urls.txt")
+	cmd.Flags().StringVar(&sitemap, "sitemap", "", "The url of sitemap, it's fetched through the upstream, e.g.: http://test.com/sitemap.xml")
+	cmd.Flags().StringVar(&upstreamName, "upstream", "", "The upstream of sitemap")
+	cmd.Flags().IntVar(&params.Concurrency, "concurrency", 5, "The max number of requests at the same time")
+	cmd.Flags().IntVar(&params.Rate, "rate", 0, "The max number of requests per second(at most 10000), 0 means no limit")
+	return cmd
+}
+
+// newCacheCmd 缓存相关命令
+func newCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of pike through the admin server",
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+			os.Exit(0)
+		},
+	}
+	adminURL := ""
+	account := ""
+	password := ""
+	importCmd := &cobra.Command{
+		Use:   "import [snapshot file]",
+		Short: "Import the cache snapshot to pike",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			count, skipped, err := importCacheSnapshot(adminURL, account, password, args[0])
+			if err != nil {
+				fmt.Println("import cache snapshot fail, " + err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("import %d caches success, %d skipped\n", count, skipped)
+			os.Exit(0)
+		},
+	}
+	importCmd.Flags().StringVar(&adminURL, "admin", "http://127.0.0.1:9013", "The url of admin server")
+	importCmd.Flags().StringVar(&account, "account", "", "The account of admin")
+	importCmd.Flags().StringVar(&password, "password", "", "The password of admin")
+	cmd.AddCommand(importCmd)
+	return cmd
+}
+
+// importCacheSnapshot 通过admin接口导入缓存快照，如果有账号则先登录
+func importCacheSnapshot(adminURL, account, password, file string) (int, int, error) {
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+	}
+	doRequest := func(url, contentType string, body io.Reader) ([]byte, error) {
+		resp, err := client.Post(url, contentType, body)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, errors.New(string(data))
+		}
+		return data, nil
+	}
+	if account != "" {
+		data, _ := json.Marshal(map[string]string{
+			"account":  account,
+			"password": password,
+		})
+		_, err := doRequest(adminURL+"/login", "application/json", bytes.NewReader(data))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	data, err := doRequest(adminURL+"/cache/import", "application/octet-stream", f)
+	if err != nil {
+		return 0, 0, err
+	}
+	result := make(map[string]int)
+	err = json.Unmarshal(data, &result)
+	if err != nil {
+		return 0, 0, err
+	}
+	return result["count"], result["skipped"], nil
+}
+
 // runCMD 解析各命令参数
 func runCMD() error {
 	configURL := ""
 	adminAddr := ""
 	logOutputPath := ""
+	prefetchConcurrency := 0
 
 	var rootCmd = &cobra.Command{
 		Use:   "pike",
@@ -137,6 +337,8 @@ func runCMD() error {
 			if logOutputPath != "" {
 				log.SetOutputPath(logOutputPath)
 			}
+			// 设置缓存预先更新的最大并发数
+			cache.SetPrefetchConcurrency(prefetchConcurrency)
 			// 初始化配置
 			err := config.InitDefaultClient(configURL)
 			if err != nil {
@@ -169,6 +371,15 @@ func runCMD() error {
 	// 日志文件
 	rootCmd.Flags().StringVar(&logOutputPath, "log", "", "The log path, e.g.: /var/pike.log or lumberjack:///tmp/pike.log?maxSize=100&maxAge=1&compress=true")
 
+	// 缓存预先更新的最大并发数
+	rootCmd.Flags().IntVar(&prefetchConcurrency, "prefetch-concurrency", 10, "The max number of prefetching cache of all caches, e.g.: 10")
+
+	// 缓存快照文件
+	rootCmd.Flags().StringVar(&cacheSnapshot, "cache-snapshot", "", "The snapshot file of cache, the cache is saved to it on graceful shutdown and loaded on startup, e.g.: /opt/pike.snapshot")
+
+	rootCmd.AddCommand(newWarmCmd())
+	rootCmd.AddCommand(newCacheCmd())
+
 	return rootCmd.Execute()
 }
 
@@ -222,6 +433,8 @@ func main() {
 		if !isDev() {
 			server.Close()
 		}
+		// server关闭后保存缓存快照
+		saveCacheSnapshot()
 		os.Exit(0)
 	}
 }
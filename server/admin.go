@@ -23,9 +23,12 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"regexp"
+	"strconv"
 	"time"
 
 	"github.com/vicanso/elton"
@@ -38,6 +41,7 @@ import (
 	"github.com/vicanso/pike/log"
 	"github.com/vicanso/pike/upstream"
 	"github.com/vicanso/pike/util"
+	"github.com/vicanso/pike/warm"
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
 )
@@ -57,6 +61,22 @@ type (
 		Account string `json:"account,omitempty"`
 	}
 
+	// warmParams the params of warming task
+	warmParams struct {
+		// Server the addr of server config, e.g. :3015
+		Server string `json:"server,omitempty"`
+		// Host the host of request if the url is not absolute
+		Host string   `json:"host,omitempty"`
+		URLs []string `json:"urls,omitempty"`
+		// File the local file of url list
+		File string `json:"file,omitempty"`
+		// Sitemap the url of sitemap, it's fetched through the upstream
+		Sitemap     string `json:"sitemap,omitempty"`
+		Upstream    string `json:"upstream,omitempty"`
+		Concurrency int    `json:"concurrency,omitempty"`
+		Rate        int    `json:"rate,omitempty"`
+	}
+
 	// applicationInfo application info
 	applicationInfo struct {
 		*app.Info
@@ -70,6 +90,16 @@ var accountOrPasswordIsWrong = util.NewError("Account or password is wrong", htt
 
 var cacheKeyIsNil = util.NewError("The key of cache can't be null", http.StatusBadRequest)
 
+var cacheNotFound = util.NewError("The cache is not found", http.StatusNotFound)
+
+var serverNotFound = util.NewError("The server is not found or not listening", http.StatusBadRequest)
+
+var warmTaskNotFound = util.NewError("The warm task is not found", http.StatusNotFound)
+
+var warmParamsIsInvalid = util.NewError("The concurrency should be 0-100 and the rate should be 0-"+strconv.Itoa(warm.MaxRate), http.StatusBadRequest)
+
+var purgeFilterIsNil = util.NewError("The host, prefix or regexp of purge can't be null", http.StatusBadRequest)
+
 const jwtCookie = "pike"
 
 var webAsset = middleware.NewEmbedStaticFS(asset.GetFS(), "web")
@@ -249,6 +279,181 @@ func removeCache(c *elton.Context) (err error) {
 	return
 }
 
+// purgeCache 按host、url前缀或正则删除缓存
+func purgeCache(c *elton.Context) (err error) {
+	filter, err := newEntryFilter(c)
+	if err != nil {
+		return
+	}
+	// 避免误删除所有缓存，至少需要指定一个条件
+	if filter.Host == "" && filter.Prefix == "" && filter.Regexp == nil {
+		err = purgeFilterIsNil
+		return
+	}
+	count, err := cache.Purge(c.QueryParam("cache"), filter)
+	if err != nil {
+		return
+	}
+	c.Body = map[string]int{
+		"count": count,
+	}
+	return
+}
+
+// purgeCacheTag 删除标签对应的缓存
+func purgeCacheTag(c *elton.Context) (err error) {
+	count := cache.PurgeTag(c.QueryParam("cache"), c.Param("tag"))
+	c.Body = map[string]int{
+		"count": count,
+	}
+	return
+}
+
+// newEntryFilter new entry filter from query
+func newEntryFilter(c *elton.Context) (filter cache.EntryFilter, err error) {
+	filter = cache.EntryFilter{
+		Host:   c.QueryParam("host"),
+		Prefix: c.QueryParam("prefix"),
+	}
+	if value := c.QueryParam("regexp"); value != "" {
+		filter.Regexp, err = regexp.Compile(value)
+		if err != nil {
+			err = util.NewError(err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := c.QueryParam("status"); value != "" {
+		filter.Status = cache.ParseStatus(value)
+		if filter.Status == cache.StatusUnknown {
+			err = util.NewError("The status of cache is invalid", http.StatusBadRequest)
+			return
+		}
+	}
+	filter.Offset, _ = strconv.Atoi(c.QueryParam("offset"))
+	filter.Limit, _ = strconv.Atoi(c.QueryParam("limit"))
+	return
+}
+
+// listCacheEntries 查询缓存
+func listCacheEntries(c *elton.Context) (err error) {
+	disp := cache.GetDispatcher(c.Param("name"))
+	if disp == nil {
+		err = cacheNotFound
+		return
+	}
+	filter, err := newEntryFilter(c)
+	if err != nil {
+		return
+	}
+	// 指定从store中查询
+	if c.QueryParam("store") == "true" {
+		entries, err := disp.ScanEntries(filter)
+		if err != nil {
+			if err == cache.ErrStoreIsNil {
+				return util.NewError(err.Error(), http.StatusBadRequest)
+			}
+			return err
+		}
+		c.Body = entries
+		return nil
+	}
+	c.Body = disp.GetEntries(filter)
+	return
+}
+
+// exportCache 导出缓存快照，直接写入响应，避免整个快照保存在内存中
+func exportCache(c *elton.Context) (err error) {
+	c.SetHeader(elton.HeaderContentType, "application/octet-stream")
+	c.SetHeader("Content-Disposition", `attachment; filename="pike.snapshot"`)
+	c.StatusCode = http.StatusOK
+	// 设置为已commit，由当前函数写入响应数据
+	c.Committed = true
+	c.Response.WriteHeader(c.StatusCode)
+	w := bufio.NewWriter(c.Response)
+	_, err = cache.Export(w, c.QueryParam("cache"))
+	if err == nil {
+		err = w.Flush()
+	}
+	// 响应已开始写入，出错时只记录日志
+	if err != nil {
+		log.Default().Error("export cache fail",
+			zap.Error(err),
+		)
+	}
+	return nil
+}
+
+// importCache 导入缓存快照，已存在的缓存不覆盖
+func importCache(c *elton.Context) (err error) {
+	count, skipped, err := cache.Import(c.Request.Body)
+	if err != nil {
+		if err == cache.ErrSnapshotInvalid {
+			err = util.NewError(err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	c.Body = map[string]int{
+		"count":   count,
+		"skipped": skipped,
+	}
+	return
+}
+
+// createWarmTask 创建缓存预热任务
+func createWarmTask(c *elton.Context) (err error) {
+	params := warmParams{}
+	err = json.Unmarshal(c.RequestBody, &params)
+	if err != nil {
+		return
+	}
+	if params.Concurrency < 0 || params.Concurrency > 100 || params.Rate < 0 || params.Rate > warm.MaxRate {
+		err = warmParamsIsInvalid
+		return
+	}
+	s := Get(params.Server)
+	if s == nil || s.GetListenAddr() == "" {
+		err = serverNotFound
+		return
+	}
+	urls, err := warm.GetURLs(params.URLs, params.File, params.Upstream, params.Sitemap)
+	if err != nil {
+		err = util.NewError(err.Error(), http.StatusBadRequest)
+		return
+	}
+	task, err := warm.Start(warm.Option{
+		Addr:        s.GetListenAddr(),
+		Host:        params.Host,
+		URLs:        urls,
+		Concurrency: params.Concurrency,
+		Rate:        params.Rate,
+	})
+	if err != nil {
+		if err == warm.ErrTooManyTasks {
+			err = util.NewError(err.Error(), http.StatusTooManyRequests)
+		}
+		return
+	}
+	c.Created(task.GetProgress(false))
+	return
+}
+
+// listWarmTasks 查询缓存预热任务
+func listWarmTasks(c *elton.Context) (err error) {
+	c.Body = warm.List()
+	return
+}
+
+// getWarmTask 获取缓存预热任务的进度及各url的结果
+func getWarmTask(c *elton.Context) (err error) {
+	task := warm.Get(c.Param("id"))
+	if task == nil {
+		err = warmTaskNotFound
+		return
+	}
+	c.Body = task.GetProgress(true)
+	return
+}
+
 // StartAdminServer start admin server
 func StartAdminServer(config AdminServerConfig) (err error) {
 	logger := log.Default()
@@ -327,6 +532,16 @@ func StartAdminServer(config AdminServerConfig) (err error) {
 
 	// 缓存
 	e.DELETE("/cache", removeCache)
+	e.DELETE("/cache/tags/:tag", isLogin, purgeCacheTag)
+	e.DELETE("/cache/purge", isLogin, purgeCache)
+	e.GET("/caches/:name/entries", isLogin, listCacheEntries)
+	e.GET("/cache/export", isLogin, exportCache)
+	e.POST("/cache/import", isLogin, importCache)
+
+	// 缓存预热
+	e.POST("/warm-tasks", isLogin, createWarmTask)
+	e.GET("/warm-tasks", isLogin, listWarmTasks)
+	e.GET("/warm-tasks/:id", isLogin, getWarmTask)
 
 	e.GET("/ping", func(c *elton.Context) error {
 		c.BodyBuffer = bytes.NewBufferString("pong")
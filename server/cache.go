@@ -23,10 +23,15 @@
 package server
 
 import (
+	"context"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/vicanso/elton"
 	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/cachecontrol"
+	"github.com/vicanso/pike/location"
 )
 
 const (
@@ -71,13 +76,189 @@ func getKey(req *http.Request) []byte {
 	return buffer
 }
 
+// isUnsafeMethod check the method of request is unsafe, which may change the resource
+func isUnsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost,
+		http.MethodPut,
+		http.MethodPatch,
+		http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// getInvalidationKeys get the cache keys(GET and HEAD) which should be removed after the unsafe request is successful,
+// including the target uri and the Location, Content-Location uris of the same host
+func getInvalidationKeys(req *http.Request, httpResp *cache.HTTPResponse, locations ...string) [][]byte {
+	// 仅成功(2xx与3xx)的非安全请求
+	if !isUnsafeMethod(req.Method) ||
+		httpResp == nil ||
+		httpResp.StatusCode < http.StatusOK ||
+		httpResp.StatusCode >= http.StatusBadRequest {
+		return nil
+	}
+	uri := req.RequestURI
+	if len(uri) == 0 {
+		uri = req.URL.String()
+	}
+	urls := []*url.URL{
+		req.URL,
+	}
+	uris := []string{
+		uri,
+	}
+	for _, name := range []string{
+		elton.HeaderLocation,
+		headerContentLocation,
+	} {
+		value := httpResp.Header.Get(name)
+		if value == "" {
+			continue
+		}
+		u, err := req.URL.Parse(value)
+		// 不同host的url不删除
+		if err != nil || (u.Host != "" && u.Host != req.Host) {
+			continue
+		}
+		u.Scheme = ""
+		u.Host = ""
+		urls = append(urls, u)
+		uris = append(uris, u.RequestURI())
+	}
+
+	keys := make([][]byte, 0, 2*len(uris))
+	exists := make(map[string]bool)
+	for index, uri := range uris {
+		if exists[uri] {
+			continue
+		}
+		exists[uri] = true
+		l := location.Get(req.Host, uri, locations...)
+		for _, method := range []string{
+			http.MethodGet,
+			http.MethodHead,
+		} {
+			r := new(http.Request)
+			*r = *req
+			r.Method = method
+			r.URL = urls[index]
+			r.RequestURI = uri
+			keys = append(keys, getCacheKey(r, l))
+		}
+	}
+	return keys
+}
+
+// getCacheKey get cache key of request, the cache key option of location is used if it's set
+func getCacheKey(req *http.Request, l *location.Location) []byte {
+	if l == nil || l.CacheKey == nil {
+		return getKey(req)
+	}
+	return []byte(req.Method + " " + req.Host + " " + l.CacheKey.GetURI(req))
+}
+
+// getCacheGetOption get the option of getting http cache from the request Cache-Control,
+// the no-cache(or Pragma: no-cache) request refreshes the cache if it's refreshable
+func getCacheGetOption(req *http.Request, refreshable bool) cache.GetOption {
+	values := req.Header.Values(elton.HeaderCacheControl)
+	if len(values) == 0 {
+		if refreshable && strings.Contains(req.Header.Get(headerPragma), "no-cache") {
+			return cache.GetOption{
+				Refresh: true,
+			}
+		}
+		return cache.GetOption{}
+	}
+	cc := cachecontrol.ParseRequest(values...)
+	opt := cache.GetOption{
+		OnlyIfCached: cc.OnlyIfCached,
+		Refresh:      refreshable && cc.NoCache,
+	}
+	if cc.MaxStale > 0 {
+		opt.MaxStale = cc.MaxStale
+	}
+	if cc.MinFresh > 0 {
+		opt.MinFresh = cc.MinFresh
+	}
+	if cc.MaxAge >= 0 {
+		opt.MaxAge = cc.MaxAge
+		opt.HasMaxAge = true
+	}
+	return opt
+}
+
+// isFetchFailed check fetching from upstream is failed
+func isFetchFailed(c *elton.Context, err error) bool {
+	if err != nil {
+		return true
+	}
+	httpResp := getHTTPResp(c)
+	return httpResp != nil && httpResp.StatusCode >= http.StatusInternalServerError
+}
+
+// isErrorResponse check fetching from upstream is failed or the status of response is error
+func isErrorResponse(c *elton.Context, err error) bool {
+	if err != nil {
+		return true
+	}
+	httpResp := getHTTPResp(c)
+	return httpResp != nil && httpResp.StatusCode >= http.StatusBadRequest
+}
+
+// isPromotable check the response of hit for pass request can be cached,
+// the partial and not modified response are ignored because the Range and conditional headers are forwarded
+func isPromotable(httpResp *cache.HTTPResponse) bool {
+	return httpResp.StatusCode != http.StatusPartialContent &&
+		httpResp.StatusCode != http.StatusNotModified
+}
+
+// newCacheableOption new cacheable option, the stale values of response are preferred
+func newCacheableOption(c *elton.Context, disp fetchDispatcher, maxAge int) cache.CacheableOption {
+	whileRevalidate, ifError := getHTTPCacheStale(c)
+	defaultWhileRevalidate, defaultIfError := disp.GetStale()
+	mustRevalidate := whileRevalidate < 0
+	// 小于0表示不可使用过期数据(must-revalidate)，等于0则使用默认值
+	if whileRevalidate == 0 {
+		whileRevalidate = defaultWhileRevalidate
+	}
+	if ifError == 0 {
+		ifError = defaultIfError
+	}
+	if whileRevalidate < 0 {
+		whileRevalidate = 0
+	}
+	if ifError < 0 {
+		ifError = 0
+	}
+	return cache.CacheableOption{
+		TTL:                  maxAge,
+		StaleWhileRevalidate: whileRevalidate,
+		StaleIfError:         ifError,
+		MustRevalidate:       mustRevalidate,
+	}
+}
+
 // NewCache new a cache middleware
 func NewCache(s *server) elton.Handler {
 	return func(c *elton.Context) (err error) {
 		// 不可缓存请求，直接pass至upstream
 		if requestIsPass(c.Request) {
 			setCacheStatus(c, cache.StatusPassed)
-			return c.Next()
+			err = c.Next()
+			disp := cache.GetDispatcher(s.GetCache())
+			if disp == nil {
+				return
+			}
+			// 删除响应中的缓存标签
+			disp.PopTags(getHTTPResp(c))
+			// 非安全请求成功后删除对应的缓存
+			if err == nil && disp.ShouldInvalidateOnUnsafe() {
+				for _, key := range getInvalidationKeys(c.Request, getHTTPResp(c), s.GetLocations()...) {
+					disp.RemoveHTTPCache(key)
+				}
+			}
+			return
 		}
 		disp := cache.GetDispatcher(s.GetCache())
 		if disp == nil {
@@ -85,24 +266,72 @@ func NewCache(s *server) elton.Handler {
 			return
 		}
 
-		key := getKey(c.Request)
+		l := location.Get(c.Request.Host, c.Request.RequestURI, s.GetLocations()...)
+		key := getCacheKey(c.Request, l)
 		httpCache := disp.GetHTTPCache(key)
-		cacheStatus, httpResp := httpCache.Get()
+		// 根据请求的Cache-Control(max-stale、min-fresh、only-if-cached以及no-cache)获取缓存
+		getOpt := getCacheGetOption(c.Request, s.AllowForceRefresh(c.Request))
+		cacheStatus, httpResp, err := httpCache.GetWithOption(c.Context(), getOpt)
+		// 如果缓存为vary，则根据请求头获取对应的缓存
+		varied := false
+		if err == nil && cacheStatus == cache.StatusHitForPass {
+			if varyKey := httpCache.GetVaryKey(c.Request.Header); len(varyKey) != 0 {
+				varied = true
+				httpCache = disp.GetHTTPCache(varyKey)
+				cacheStatus, httpResp, err = httpCache.GetWithOption(c.Context(), getOpt)
+			}
+		}
+		if err == cache.ErrNotCached ||
+			(err == nil && getOpt.OnlyIfCached && cacheStatus != cache.StatusHit && cacheStatus != cache.StatusStale) {
+			return ErrOnlyIfCached
+		}
+		if err != nil {
+			if err != cache.ErrWaitTimeout {
+				return err
+			}
+			// 等待超时，根据配置转发至upstream或返回出错
+			if !disp.ShouldPassOnWaitTimeout() {
+				return ErrWaitTimeout
+			}
+			setCacheStatus(c, cache.StatusPassed)
+			err = c.Next()
+			disp.PopTags(getHTTPResp(c))
+			return
+		}
 
 		cacheable := false
 		// 对于fetching类的请求，如果最终是不可缓存的，则设置hit for pass
 		// 保证只要不是panic，fetching的请求非可缓存的都为hit for pass
 		if cacheStatus == cache.StatusFetching {
+			fetchingCache := httpCache
 			defer func() {
-				if !cacheable {
-					httpCache.HitForPass(disp.GetHitForPass())
+				if cacheable {
+					return
+				}
+				// 出错的响应根据配置不设置为hit for pass，后续请求重新获取
+				if disp.ShouldSkipHitForPassOnError() && isErrorResponse(c, err) {
+					fetchingCache.ResetFetching()
+					return
 				}
+				fetchingCache.HitForPass(disp.GetHitForPass())
 			}()
+			// 过期的缓存数据有ETag或Last-Modified，则由proxy向upstream校验
+			if resp := httpCache.GetRevalidationResponse(); resp != nil {
+				setRevalidationResp(c, resp)
+			}
 		}
 
 		setCacheStatus(c, cacheStatus)
 		// 缓存中读取的可缓存数据，不需要next
-		if cacheStatus == cache.StatusHit {
+		if cacheStatus == cache.StatusHit || cacheStatus == cache.StatusStale {
+			// 过期数据在stale-while-revalidate时长内，由后台更新缓存
+			if cacheStatus == cache.StatusStale && httpCache.Revalidate() {
+				go revalidate(s, disp, httpCache, c.Request.Clone(context.Background()))
+			}
+			// 热点缓存在即将过期时，由后台预先更新
+			if cacheStatus == cache.StatusHit && httpCache.Prefetch() {
+				go revalidate(s, disp, httpCache, c.Request.Clone(context.Background()))
+			}
 			// 设置缓存数据
 			setHTTPResp(c, httpResp)
 			// 设置缓存数据的age
@@ -111,20 +340,60 @@ func NewCache(s *server) elton.Handler {
 		}
 
 		err = c.Next()
+		// 如果获取数据失败或者响应为5xx，在stale-if-error时长内则使用过期数据
+		if cacheStatus == cache.StatusFetching && isFetchFailed(c, err) {
+			if staleResp := httpCache.StaleIfError(); staleResp != nil {
+				cacheable = true
+				setCacheStatus(c, cache.StatusStale)
+				setHTTPResp(c, staleResp)
+				setHTTPRespAge(c, httpCache.Age())
+				return nil
+			}
+		}
 		if err != nil {
 			return err
 		}
+		// 获取缓存标签并从响应中删除
+		tags := disp.PopTags(getHTTPResp(c))
 
-		// TODO 如果是hit for pass，但此次返回的缓存有效期不为0，
-		// 有可能因为上一次接口出错，导致了hit for pass，此次成功则可缓存，
-		// 后续再确认是否需要在此情况下将缓存更新
+		// 如果是hit for pass，但此次返回的缓存有效期不为0，
+		// 有可能因为上一次接口出错，导致了hit for pass，此次成功则更新为可缓存
+		if cacheStatus == cache.StatusHitForPass {
+			maxAge := getHTTPCacheMaxAge(c)
+			httpResp = getHTTPResp(c)
+			if maxAge > 0 && httpResp != nil && isPromotable(httpResp) && !disp.IsOversize(httpResp) {
+				// 有vary的响应则只记录vary，后续请求再获取对应的缓存
+				if vary := httpResp.GetVary(); !varied && len(vary) != 0 {
+					httpCache.Vary(vary, maxAge)
+					return nil
+				}
+				opt := newCacheableOption(c, disp, maxAge)
+				opt.Tags = tags
+				if httpCache.PromoteHitForPass(httpResp, opt) {
+					setCached(c)
+				}
+			}
+			return nil
+		}
 		if cacheStatus == cache.StatusFetching {
 			// 获取缓存有效期
 			if maxAge := getHTTPCacheMaxAge(c); maxAge > 0 {
-				// 只有有响应数据可缓存时才设置为cacheable
-				if httpResp = getHTTPResp(c); httpResp != nil {
+				// 只有有响应数据且未超过缓存数据限制时才设置为cacheable
+				if httpResp = getHTTPResp(c); httpResp != nil && !disp.IsOversize(httpResp) {
 					cacheable = true
-					httpCache.Cacheable(httpResp, maxAge)
+					// 首次获取到有vary的响应，则记录vary，
+					// 响应数据保存至vary对应的缓存中
+					if vary := httpResp.GetVary(); !varied && len(vary) != 0 {
+						httpCache.Vary(vary, maxAge)
+						httpCache = disp.GetHTTPCache(httpCache.GetVaryKey(c.Request.Header))
+					}
+					opt := newCacheableOption(c, disp, maxAge)
+					opt.Tags = tags
+					httpCache.CacheableWithOption(httpResp, opt)
+					// 状态码不可缓存的响应则为hit for pass
+					if disp.IsCacheableStatus(httpResp.StatusCode) {
+						setCached(c)
+					}
 				}
 			}
 		}
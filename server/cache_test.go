@@ -23,6 +23,9 @@
 package server
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
@@ -30,6 +33,7 @@ import (
 	"github.com/vicanso/elton"
 	"github.com/vicanso/pike/cache"
 	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/location"
 )
 
 func TestRequestIsPass(t *testing.T) {
@@ -41,6 +45,50 @@ func TestRequestIsPass(t *testing.T) {
 	assert.False(requestIsPass(httptest.NewRequest("HEAD", "/", nil)))
 }
 
+func TestGetInvalidationKeys(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("GET", "/users/me", nil)
+	req.Host = "test.com"
+	resp := &cache.HTTPResponse{
+		StatusCode: 200,
+	}
+	assert.Nil(getInvalidationKeys(req, resp))
+
+	req = httptest.NewRequest("POST", "/users/me", nil)
+	req.Host = "test.com"
+	assert.Nil(getInvalidationKeys(req, nil))
+	assert.Nil(getInvalidationKeys(req, &cache.HTTPResponse{
+		StatusCode: 400,
+	}))
+
+	keys := getInvalidationKeys(req, resp)
+	assert.Equal([][]byte{
+		[]byte("GET test.com /users/me"),
+		[]byte("HEAD test.com /users/me"),
+	}, keys)
+
+	// Location与Content-Location，不同host的不删除
+	resp = &cache.HTTPResponse{
+		StatusCode: 201,
+		Header: http.Header{
+			"Location":         []string{"/users/1?type=2"},
+			"Content-Location": []string{"http://other.com/users/2"},
+		},
+	}
+	keys = getInvalidationKeys(req, resp)
+	assert.Equal([][]byte{
+		[]byte("GET test.com /users/me"),
+		[]byte("HEAD test.com /users/me"),
+		[]byte("GET test.com /users/1?type=2"),
+		[]byte("HEAD test.com /users/1?type=2"),
+	}, keys)
+
+	resp.Header.Set("Content-Location", "http://test.com/users/me")
+	keys = getInvalidationKeys(req, resp)
+	assert.Equal(4, len(keys))
+}
+
 func TestGetKey(t *testing.T) {
 	assert := assert.New(t)
 
@@ -48,6 +96,24 @@ func TestGetKey(t *testing.T) {
 	assert.Equal("GET test.com http://test.com/users/me?type=1", string(getKey(req)))
 }
 
+func TestGetCacheKey(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("GET", "http://test.com/users/me?utm_source=a&type=1&id=2", nil)
+	assert.Equal("GET test.com http://test.com/users/me?utm_source=a&type=1&id=2", string(getCacheKey(req, nil)))
+	assert.Equal("GET test.com http://test.com/users/me?utm_source=a&type=1&id=2", string(getCacheKey(req, &location.Location{})))
+
+	l := &location.Location{
+		CacheKey: &location.CacheKey{
+			SortQuery: true,
+			ExcludeQueries: []string{
+				"utm_*",
+			},
+		},
+	}
+	assert.Equal("GET test.com /users/me?id=2&type=1", string(getCacheKey(req, l)))
+}
+
 func TestCacheMiddleware(t *testing.T) {
 	assert := assert.New(t)
 
@@ -122,5 +188,496 @@ func TestCacheMiddleware(t *testing.T) {
 		assert.Nil(err)
 		assert.Equal(tt.status, getCacheStatus(tt.c))
 	}
+}
+
+func TestCacheMiddlewareVary(t *testing.T) {
+	assert := assert.New(t)
+
+	cacheName := "test-vary"
+	cache.ResetDispatchers([]config.CacheConfig{
+		{
+			Name: cacheName,
+			Size: 100,
+		},
+	})
+	s := NewServer(ServerOption{
+		Cache: cacheName,
+	})
+	fn := NewCache(s)
+
+	newContext := func(lang string) *elton.Context {
+		req := httptest.NewRequest("GET", "/vary", nil)
+		req.Header.Set("Accept-Language", lang)
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		c.Next = func() error {
+			header := http.Header{}
+			header.Set("Vary", "Accept-Language")
+			setHTTPCacheMaxAge(c, 10)
+			setHTTPResp(c, &cache.HTTPResponse{
+				Header:  header,
+				RawBody: []byte(lang),
+			})
+			return nil
+		}
+		return c
+	}
+
+	tests := []struct {
+		lang   string
+		status cache.Status
+	}{
+		// 首次fetching，记录vary
+		{
+			lang:   "zh",
+			status: cache.StatusFetching,
+		},
+		// 根据vary从对应的缓存中获取
+		{
+			lang:   "zh",
+			status: cache.StatusHit,
+		},
+		// 不同的vary值，需要重新获取
+		{
+			lang:   "en",
+			status: cache.StatusFetching,
+		},
+		{
+			lang:   "en",
+			status: cache.StatusHit,
+		},
+	}
+	for _, tt := range tests {
+		c := newContext(tt.lang)
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(tt.status, getCacheStatus(c))
+		assert.Equal(tt.lang, string(getHTTPResp(c).RawBody))
+	}
+}
+
+func TestCacheMiddlewareTags(t *testing.T) {
+	assert := assert.New(t)
+
+	cacheName := "test-tags"
+	cache.ResetDispatchers([]config.CacheConfig{
+		{
+			Name:      cacheName,
+			Size:      100,
+			TagHeader: "Surrogate-Key",
+		},
+	})
+	s := NewServer(ServerOption{
+		Cache: cacheName,
+	})
+	fn := NewCache(s)
+	newNext := func(c *elton.Context, maxAge int) func() error {
+		return func() error {
+			setHTTPCacheMaxAge(c, maxAge)
+			setHTTPResp(c, &cache.HTTPResponse{
+				Header: http.Header{
+					"Surrogate-Key": []string{
+						"product-1 list",
+					},
+				},
+				RawBody: []byte("abc"),
+			})
+			return nil
+		}
+	}
+
+	for _, url := range []string{"/products/1", "/products"} {
+		c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+		c.Next = newNext(c, 60)
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(cache.StatusFetching, getCacheStatus(c))
+		// 标签的响应头需要删除
+		assert.Empty(getHTTPResp(c).Header.Get("Surrogate-Key"))
+	}
+
+	// pass的请求也需要删除标签的响应头
+	c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("POST", "/products/1", nil))
+	c.Next = newNext(c, 0)
+	err := fn(c)
+	assert.Nil(err)
+	assert.Empty(getHTTPResp(c).Header.Get("Surrogate-Key"))
+
+	assert.Equal(2, cache.PurgeTag(cacheName, "list"))
+	assert.Equal(0, cache.PurgeTag(cacheName, "product-1"))
+
+	c = elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/products/1", nil))
+	c.Next = newNext(c, 60)
+	err = fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusFetching, getCacheStatus(c))
+}
+
+func TestCacheMiddlewareWaitTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, pass := range []bool{false, true} {
+		cacheName := fmt.Sprintf("test-wait-timeout-%v", pass)
+		cache.ResetDispatchers([]config.CacheConfig{
+			{
+				Name:              cacheName,
+				Size:              100,
+				WaitTimeout:       "10ms",
+				PassOnWaitTimeout: pass,
+			},
+		})
+		s := NewServer(ServerOption{
+			Cache: cacheName,
+		})
+		fn := NewCache(s)
+		req := httptest.NewRequest("GET", "/wait-timeout", nil)
+		// 设置为fetching状态
+		cache.GetDispatcher(cacheName).GetHTTPCache(getKey(req)).Get()
+
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		c.Next = func() error {
+			setHTTPResp(c, &cache.HTTPResponse{})
+			return nil
+		}
+		err := fn(c)
+		if pass {
+			assert.Nil(err)
+			assert.Equal(cache.StatusPassed, getCacheStatus(c))
+			assert.NotNil(getHTTPResp(c))
+		} else {
+			assert.Equal(ErrWaitTimeout, err)
+		}
+	}
+}
+
+func TestCacheMiddlewareHitForPass(t *testing.T) {
+	assert := assert.New(t)
+
+	cacheName := "test-hit-for-pass"
+	cache.ResetDispatchers([]config.CacheConfig{
+		{
+			Name:                  cacheName,
+			Size:                  100,
+			HitForPass:            "1m",
+			SkipHitForPassOnError: true,
+		},
+	})
+	s := NewServer(ServerOption{
+		Cache: cacheName,
+	})
+	fn := NewCache(s)
+	disp := cache.GetDispatcher(cacheName)
+
+	// 出错的响应不设置hit for pass
+	req := httptest.NewRequest("GET", "/hit-for-pass", nil)
+	c := elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		setHTTPResp(c, &cache.HTTPResponse{
+			StatusCode: 500,
+		})
+		return nil
+	}
+	err := fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusFetching, getCacheStatus(c))
+	assert.Equal(cache.StatusUnknown, disp.GetHTTPCache(getKey(req)).GetStatus())
+
+	// 不可缓存的响应设置hit for pass
+	c = elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		setHTTPResp(c, &cache.HTTPResponse{
+			StatusCode: 200,
+		})
+		return nil
+	}
+	err = fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusFetching, getCacheStatus(c))
+	assert.Equal(cache.StatusHitForPass, disp.GetHTTPCache(getKey(req)).GetStatus())
+	assert.False(isCached(c))
+
+	// hit for pass的206响应不更新为可缓存
+	c = elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		setHTTPCacheMaxAge(c, 60)
+		setHTTPResp(c, &cache.HTTPResponse{
+			StatusCode: 206,
+			RawBody:    []byte("Hello"),
+		})
+		return nil
+	}
+	err = fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusHitForPass, getCacheStatus(c))
+	assert.False(isCached(c))
+
+	// hit for pass的响应可缓存时，更新为可缓存
+	resp := &cache.HTTPResponse{
+		StatusCode: 200,
+		RawBody:    []byte("Hello world!"),
+	}
+	c = elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		setHTTPCacheMaxAge(c, 60)
+		setHTTPResp(c, resp)
+		return nil
+	}
+	err = fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusHitForPass, getCacheStatus(c))
+	assert.True(isCached(c))
+	status, data := disp.GetHTTPCache(getKey(req)).Get()
+	assert.Equal(cache.StatusHit, status)
+	assert.Equal(resp, data)
+}
+
+func TestCacheMiddlewareStale(t *testing.T) {
+	assert := assert.New(t)
+
+	cacheName := "test-stale"
+	cache.ResetDispatchers([]config.CacheConfig{
+		{
+			Name:                 cacheName,
+			Size:                 100,
+			StaleWhileRevalidate: "1m",
+		},
+	})
+	s := NewServer(ServerOption{
+		Cache: cacheName,
+	})
+	fn := NewCache(s)
+	disp := cache.GetDispatcher(cacheName)
+	staleResp := &cache.HTTPResponse{
+		RawBody: []byte("stale"),
+	}
+
+	// stale-while-revalidate，直接返回过期数据
+	req := httptest.NewRequest("GET", "/stale-while-revalidate", nil)
+	disp.GetHTTPCache(getKey(req)).CacheableWithOption(staleResp, cache.CacheableOption{
+		TTL:                  -1,
+		StaleWhileRevalidate: 60,
+	})
+	c := elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		return errors.New("next should not be called")
+	}
+	err := fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusStale, getCacheStatus(c))
+	assert.Equal(staleResp, getHTTPResp(c))
+
+	// stale-if-error，获取失败时返回过期数据
+	req = httptest.NewRequest("GET", "/stale-if-error", nil)
+	disp.GetHTTPCache(getKey(req)).CacheableWithOption(staleResp, cache.CacheableOption{
+		TTL:          -1,
+		StaleIfError: 60,
+	})
+	c = elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		setHTTPResp(c, &cache.HTTPResponse{
+			StatusCode: 502,
+		})
+		return nil
+	}
+	err = fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusStale, getCacheStatus(c))
+	assert.Equal(staleResp, getHTTPResp(c))
+
+	// 无过期数据可用，返回出错
+	req = httptest.NewRequest("GET", "/stale-not-found", nil)
+	c = elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		return errors.New("upstream error")
+	}
+	err = fn(c)
+	assert.Equal("upstream error", err.Error())
+	assert.Equal(cache.StatusFetching, getCacheStatus(c))
+}
+
+func TestNewCacheableOption(t *testing.T) {
+	assert := assert.New(t)
+	disp := cache.NewDispatcher(cache.DispatcherOption{
+		StaleWhileRevalidate: 10,
+		StaleIfError:         20,
+	})
+	c := elton.NewContext(nil, nil)
+	opt := newCacheableOption(c, disp, 60)
+	assert.Equal(60, opt.TTL)
+	assert.Equal(10, opt.StaleWhileRevalidate)
+	assert.Equal(20, opt.StaleIfError)
+
+	setHTTPCacheStale(c, 30, 0)
+	opt = newCacheableOption(c, disp, 60)
+	assert.Equal(30, opt.StaleWhileRevalidate)
+	assert.Equal(20, opt.StaleIfError)
+	assert.False(opt.MustRevalidate)
+
+	// 不可使用过期数据
+	setHTTPCacheStale(c, -1, -1)
+	opt = newCacheableOption(c, disp, 60)
+	assert.Equal(0, opt.StaleWhileRevalidate)
+	assert.Equal(0, opt.StaleIfError)
+	assert.True(opt.MustRevalidate)
+}
+
+func TestGetCacheGetOption(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	assert.Equal(cache.GetOption{}, getCacheGetOption(req, true))
+
+	req.Header.Set("Cache-Control", "max-stale=10, min-fresh=5, only-if-cached")
+	assert.Equal(cache.GetOption{
+		MaxStale:     10,
+		MinFresh:     5,
+		OnlyIfCached: true,
+	}, getCacheGetOption(req, true))
+
+	req.Header.Set("Cache-Control", "max-age=0")
+	assert.Equal(cache.GetOption{
+		MaxAge:    0,
+		HasMaxAge: true,
+	}, getCacheGetOption(req, true))
+
+	// no-cache强制刷新
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Cache-Control", "no-cache")
+	assert.True(getCacheGetOption(req, true).Refresh)
+	assert.False(getCacheGetOption(req, false).Refresh)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Pragma", "no-cache")
+	assert.True(getCacheGetOption(req, true).Refresh)
+	assert.False(getCacheGetOption(req, false).Refresh)
+}
 
+func TestCacheMiddlewareForceRefresh(t *testing.T) {
+	assert := assert.New(t)
+
+	cacheName := "test-force-refresh"
+	cache.ResetDispatchers([]config.CacheConfig{
+		{
+			Name:       cacheName,
+			Size:       100,
+			HitForPass: "1m",
+		},
+	})
+	s := NewServer(ServerOption{
+		Cache:        cacheName,
+		ForceRefresh: true,
+	})
+	fn := NewCache(s)
+
+	req := httptest.NewRequest("GET", "/force-refresh", nil)
+	hc := cache.GetDispatcher(cacheName).GetHTTPCache(getKey(req))
+	hc.Cacheable(&cache.HTTPResponse{
+		RawBody: []byte("old"),
+	}, 60)
+
+	req.Header.Set("Cache-Control", "no-cache")
+	c := elton.NewContext(httptest.NewRecorder(), req)
+	newResp := &cache.HTTPResponse{
+		RawBody: []byte("new"),
+	}
+	c.Next = func() error {
+		setHTTPCacheMaxAge(c, 60)
+		setHTTPResp(c, newResp)
+		return nil
+	}
+	err := fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusFetching, getCacheStatus(c))
+	status, data := hc.Get()
+	assert.Equal(cache.StatusHit, status)
+	assert.Equal(newResp, data)
+}
+
+func TestCacheMiddlewareOnlyIfCached(t *testing.T) {
+	assert := assert.New(t)
+
+	cacheName := "test-only-if-cached"
+	cache.ResetDispatchers([]config.CacheConfig{
+		{
+			Name:       cacheName,
+			Size:       100,
+			HitForPass: "1m",
+		},
+	})
+	s := NewServer(ServerOption{
+		Cache: cacheName,
+	})
+	fn := NewCache(s)
+
+	req := httptest.NewRequest("GET", "/only-if-cached", nil)
+	req.Header.Set("Cache-Control", "only-if-cached")
+	c := elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		return errors.New("next should not be called")
+	}
+	err := fn(c)
+	assert.Equal(ErrOnlyIfCached, err)
+
+	resp := &cache.HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}
+	cache.GetDispatcher(cacheName).GetHTTPCache(getKey(req)).Cacheable(resp, 60)
+	c = elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		return errors.New("next should not be called")
+	}
+	err = fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusHit, getCacheStatus(c))
+	assert.Equal(resp, getHTTPResp(c))
+}
+
+func TestCacheMiddlewareInvalidateOnUnsafe(t *testing.T) {
+	assert := assert.New(t)
+
+	cacheName := "test-invalidate-on-unsafe"
+	cache.ResetDispatchers([]config.CacheConfig{
+		{
+			Name:               cacheName,
+			Size:               100,
+			HitForPass:         "1m",
+			InvalidateOnUnsafe: true,
+		},
+	})
+	s := NewServer(ServerOption{
+		Cache: cacheName,
+	})
+	fn := NewCache(s)
+	disp := cache.GetDispatcher(cacheName)
+
+	req := httptest.NewRequest("GET", "/invalidate", nil)
+	disp.GetHTTPCache(getKey(req)).Cacheable(&cache.HTTPResponse{
+		RawBody: []byte("Hello world!"),
+	}, 60)
+
+	// 失败的请求不删除缓存
+	req = httptest.NewRequest("PUT", "/invalidate", nil)
+	c := elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		setHTTPResp(c, &cache.HTTPResponse{
+			StatusCode: 500,
+		})
+		return nil
+	}
+	err := fn(c)
+	assert.Nil(err)
+	status, _ := disp.GetHTTPCache(getKey(httptest.NewRequest("GET", "/invalidate", nil))).Get()
+	assert.Equal(cache.StatusHit, status)
+
+	c = elton.NewContext(httptest.NewRecorder(), req)
+	c.Next = func() error {
+		setHTTPResp(c, &cache.HTTPResponse{
+			StatusCode: 204,
+		})
+		return nil
+	}
+	err = fn(c)
+	assert.Nil(err)
+	assert.Equal(cache.StatusPassed, getCacheStatus(c))
+	status, _ = disp.GetHTTPCache(getKey(httptest.NewRequest("GET", "/invalidate", nil))).Get()
+	assert.Equal(cache.StatusFetching, status)
 }
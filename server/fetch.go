@@ -0,0 +1,121 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/vicanso/elton"
+	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/log"
+	"go.uber.org/zap"
+)
+
+// defaultBackgroundFetchTimeout the default timeout of background fetching if the proxy timeout of location is not set,
+// it avoids that the prefetch limiter is held by the hung upstream forever
+const defaultBackgroundFetchTimeout = time.Minute
+
+type (
+	// backgroundResponseWriter the response writer of background fetching,
+	// the response is read from context, so only header is used
+	backgroundResponseWriter struct {
+		header http.Header
+	}
+	// fetchDispatcher the dispatcher used by background fetching
+	fetchDispatcher interface {
+		GetHitForPass() int
+		GetStale() (whileRevalidate, ifError int)
+		IsOversize(resp *cache.HTTPResponse) bool
+		PopTags(resp *cache.HTTPResponse) []string
+	}
+	// fetchHTTPCache the http cache used by background fetching
+	fetchHTTPCache interface {
+		HitForPass(ttl int)
+		CacheableWithOption(resp *cache.HTTPResponse, opt cache.CacheableOption)
+		CancelRevalidate()
+		GetRevalidationResponse() *cache.HTTPResponse
+	}
+)
+
+func (w *backgroundResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *backgroundResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *backgroundResponseWriter) WriteHeader(statusCode int) {}
+
+// fetch fetches the response of request from upstream through the proxy middleware,
+// the revalidation response is used to revalidate with upstream if it's not nil
+func fetch(s *server, req *http.Request, revalidationResp *cache.HTTPResponse) (c *elton.Context, err error) {
+	c = elton.NewContext(&backgroundResponseWriter{
+		header: make(http.Header),
+	}, req)
+	// 设置为fetching，proxy中间件则会获取缓存有效期
+	setCacheStatus(c, cache.StatusFetching)
+	setDefaultProxyTimeout(c, defaultBackgroundFetchTimeout)
+	if revalidationResp != nil {
+		setRevalidationResp(c, revalidationResp)
+	}
+	c.Next = func() error {
+		return nil
+	}
+	err = NewProxy(s)(c)
+	if err != nil {
+		return
+	}
+	if getHTTPResp(c) == nil {
+		err = ErrInvalidResponse
+		return
+	}
+	return
+}
+
+// revalidate fetches the response in background and updates the stale http cache
+func revalidate(s *server, disp fetchDispatcher, hc fetchHTTPCache, req *http.Request) {
+	c, err := fetch(s, req, hc.GetRevalidationResponse())
+	if err == nil && getHTTPResp(c).StatusCode >= http.StatusInternalServerError {
+		err = ErrInvalidResponse
+	}
+	// 如果获取失败，则继续使用过期数据
+	if err != nil {
+		log.Default().Error("revalidate http cache fail",
+			zap.String("uri", req.RequestURI),
+			zap.Error(err),
+		)
+		hc.CancelRevalidate()
+		return
+	}
+	tags := disp.PopTags(getHTTPResp(c))
+	maxAge := getHTTPCacheMaxAge(c)
+	if maxAge <= 0 || disp.IsOversize(getHTTPResp(c)) {
+		hc.HitForPass(disp.GetHitForPass())
+		return
+	}
+	opt := newCacheableOption(c, disp, maxAge)
+	opt.Tags = tags
+	hc.CacheableWithOption(getHTTPResp(c), opt)
+}
@@ -24,52 +24,90 @@ package server
 
 import (
 	"net/http"
-	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/vicanso/elton"
 	"github.com/vicanso/hes"
 	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/cachecontrol"
 	"github.com/vicanso/pike/location"
 	"github.com/vicanso/pike/upstream"
 	"github.com/vicanso/pike/util"
 	"golang.org/x/net/context"
 )
 
-var (
-	noCacheReg = regexp.MustCompile(`no-cache|no-store|private`)
-	sMaxAgeReg = regexp.MustCompile(`s-maxage=(\d+)`)
-	maxAgeReg  = regexp.MustCompile(`max-age=(\d+)`)
-)
+// statusRule the cacheable rule of response status
+type statusRule interface {
+	IsCacheableStatus(statusCode int) bool
+	GetStatusTTL(statusCode int) int
+	ShouldUseHeuristicFreshness() bool
+}
 
-// 根据Cache-Control的信息，获取s-maxage 或者max-age的值
-func getCacheMaxAge(header http.Header) int {
+// getEdgeCacheControl get the cache control of pike, the Surrogate-Control is preferred
+func getEdgeCacheControl(header http.Header) *cachecontrol.Response {
+	values := header.Values(headerSurrogateControl)
+	if len(values) == 0 {
+		values = header.Values(elton.HeaderCacheControl)
+	}
+	return cachecontrol.ParseResponse(values...)
+}
+
+// isUncacheableHeader check the response is uncacheable by Set-Cookie and Vary
+func isUncacheableHeader(header http.Header) bool {
 	// 如果有设置cookie，则为不可缓存
 	if header.Get(elton.HeaderSetCookie) != "" {
-		return 0
+		return true
 	}
-	// 如果没有设置cache-control，则不可缓存
-	cc := strings.Join(header.Values(elton.HeaderCacheControl), ",")
-	if cc == "" {
-		return 0
+	// 如果vary中包含*，则不可缓存
+	for _, value := range header.Values(headerVary) {
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) == "*" {
+				return true
+			}
+		}
 	}
+	return false
+}
+
+// removeHeaderFields clone the header and remove the fields
+func removeHeaderFields(header http.Header, fields []string) http.Header {
+	if len(fields) == 0 {
+		return header
+	}
+	header = header.Clone()
+	for _, field := range fields {
+		header.Del(field)
+	}
+	return header
+}
 
+// getUncachedFields get the fields should be removed from the cached response,
+// such as no-cache="Set-Cookie" and the Set-Cookie ignored by cache rule
+func getUncachedFields(header http.Header, cacheRule *location.CacheRule) []string {
+	fields := getEdgeCacheControl(header).UncachedFields()
+	if cacheRule != nil && cacheRule.IgnoreSetCookie {
+		fields = append(fields, elton.HeaderSetCookie)
+	}
+	return fields
+}
+
+// 根据Cache-Control(或Surrogate-Control)与Expires，获取缓存有效期，
+// 如果响应未设置有效期，则返回false
+func getCacheMaxAge(header http.Header) (int, bool) {
+	cc := getEdgeCacheControl(header)
+	// no-cache="Set-Cookie"等限定的字段不缓存，因此不影响是否可缓存
+	if isUncacheableHeader(removeHeaderFields(header, cc.UncachedFields())) {
+		return 0, true
+	}
 	// 如果设置不可缓存，返回0
-	if noCacheReg.MatchString(cc) {
-		return 0
+	if !cc.IsStorable() {
+		return 0, true
 	}
-	// 优先从s-maxage中获取
-	var maxAge = 0
-	result := sMaxAgeReg.FindStringSubmatch(cc)
-	if len(result) == 2 {
-		maxAge, _ = strconv.Atoi(result[1])
-	} else {
-		// 从max-age中获取缓存时间
-		result = maxAgeReg.FindStringSubmatch(cc)
-		if len(result) == 2 {
-			maxAge, _ = strconv.Atoi(result[1])
-		}
+	// 根据s-maxage，max-age以及Expires获取缓存时间
+	maxAge, ok := cc.Freshness(header)
+	if !ok {
+		return 0, false
 	}
 
 	// 如果有设置了 age 字段，则最大缓存时长减少
@@ -78,9 +116,60 @@ func getCacheMaxAge(header http.Header) int {
 		maxAge -= v
 	}
 
+	return maxAge, true
+}
+
+// getStatusCacheMaxAge get the max age of response by the status rule of cache and the cache rule of location,
+// the default ttl of status(or the heuristic freshness) is used if the response has no explicit expiration time
+func getStatusCacheMaxAge(statusCode int, header http.Header, rule statusRule, cacheRule *location.CacheRule) int {
+	if cacheRule != nil && cacheRule.NoCache {
+		return 0
+	}
+	if rule != nil && !rule.IsCacheableStatus(statusCode) {
+		return 0
+	}
+	if cacheRule != nil && cacheRule.IgnoreSetCookie {
+		header = removeHeaderFields(header, []string{
+			elton.HeaderSetCookie,
+		})
+	}
+	// 强制设置缓存有效期，忽略Cache-Control
+	if cacheRule != nil && cacheRule.TTL > 0 {
+		if isUncacheableHeader(header) {
+			return 0
+		}
+		return cacheRule.TTL
+	}
+	maxAge, ok := getCacheMaxAge(header)
+	if !ok && rule != nil {
+		maxAge = rule.GetStatusTTL(statusCode)
+		// 无默认有效期，则根据Last-Modified获取启发式的有效期
+		if maxAge <= 0 && rule.ShouldUseHeuristicFreshness() {
+			maxAge = cachecontrol.HeuristicFreshness(statusCode, header)
+		}
+	}
+	if cacheRule != nil && cacheRule.MaxTTL > 0 && maxAge > cacheRule.MaxTTL {
+		maxAge = cacheRule.MaxTTL
+	}
 	return maxAge
 }
 
+// 根据Cache-Control的信息，获取stale-while-revalidate与stale-if-error的值，
+// 如果设置了must-revalidate或proxy-revalidate，则返回-1，表示不可使用过期数据
+func getCacheStale(header http.Header) (whileRevalidate, ifError int) {
+	cc := getEdgeCacheControl(header)
+	if !cc.CanServeStale() {
+		return -1, -1
+	}
+	if cc.StaleWhileRevalidate > 0 {
+		whileRevalidate = cc.StaleWhileRevalidate
+	}
+	if cc.StaleIfError > 0 {
+		ifError = cc.StaleIfError
+	}
+	return
+}
+
 // NewProxy create proxy middleware
 func NewProxy(s *server) elton.Handler {
 	return func(c *elton.Context) (err error) {
@@ -104,18 +193,32 @@ func NewProxy(s *server) elton.Handler {
 		}
 
 		reqHeader := c.Request.Header
-		var ifModifiedSince, ifNoneMatch string
+		var ifModifiedSince, ifNoneMatch, rangeValue, ifRange string
 		status := getCacheStatus(c)
 		// 针对fetching的请求，由于其最终状态未知，因此需要删除有可能导致304的请求，避免无法生成缓存
+		// 而range的请求也需要删除，获取完整的数据，由responder根据range截取
 		if status == cache.StatusFetching {
 			ifModifiedSince = reqHeader.Get(elton.HeaderIfModifiedSince)
 			ifNoneMatch = reqHeader.Get(elton.HeaderIfNoneMatch)
+			rangeValue = reqHeader.Get(headerRange)
+			ifRange = reqHeader.Get(headerIfRange)
 			if ifModifiedSince != "" {
 				reqHeader.Del(elton.HeaderIfModifiedSince)
 			}
 			if ifNoneMatch != "" {
 				reqHeader.Del(elton.HeaderIfNoneMatch)
 			}
+			if rangeValue != "" {
+				reqHeader.Del(headerRange)
+			}
+			if ifRange != "" {
+				reqHeader.Del(headerIfRange)
+			}
+		}
+		// 如果有过期的缓存数据，则使用其ETag与Last-Modified向upstream校验
+		revalidationResp := getRevalidationResp(c)
+		if status == cache.StatusFetching && revalidationResp != nil {
+			revalidationResp.SetConditionalHeader(reqHeader)
 		}
 
 		// url rewrite
@@ -143,8 +246,13 @@ func NewProxy(s *server) elton.Handler {
 			reqHeader.Set(elton.HeaderAcceptEncoding, upstream.Option.AcceptEncoding)
 		}
 
-		if l.ProxyTimeout != 0 {
-			ctx, cancel := context.WithTimeout(c.Context(), l.ProxyTimeout)
+		proxyTimeout := l.ProxyTimeout
+		// location未设置时使用默认的超时（如后台更新缓存）
+		if proxyTimeout == 0 {
+			proxyTimeout = getDefaultProxyTimeout(c)
+		}
+		if proxyTimeout != 0 {
+			ctx, cancel := context.WithTimeout(c.Context(), proxyTimeout)
 			defer cancel()
 			c.WithContext(ctx)
 		}
@@ -163,12 +271,22 @@ func NewProxy(s *server) elton.Handler {
 		}
 
 		// 恢复请求头
+		if revalidationResp != nil {
+			reqHeader.Del(elton.HeaderIfModifiedSince)
+			reqHeader.Del(elton.HeaderIfNoneMatch)
+		}
 		if ifModifiedSince != "" {
 			reqHeader.Set(elton.HeaderIfModifiedSince, ifModifiedSince)
 		}
 		if ifNoneMatch != "" {
 			reqHeader.Set(elton.HeaderIfNoneMatch, ifNoneMatch)
 		}
+		if rangeValue != "" {
+			reqHeader.Set(headerRange, rangeValue)
+		}
+		if ifRange != "" {
+			reqHeader.Set(headerIfRange, ifRange)
+		}
 		if acceptEncodingChanged {
 			reqHeader.Set(elton.HeaderAcceptEncoding, acceptEncoding)
 		}
@@ -195,24 +313,55 @@ func NewProxy(s *server) elton.Handler {
 			data = c.BodyBuffer.Bytes()
 		}
 
-		// 对于fetching的请求，从响应头中判断该请求缓存的有效期
-		if status == cache.StatusFetching {
-			maxAge := getCacheMaxAge(header)
+		// 校验过期数据时返回304，则使用原有的响应数据，只更新响应头（无需重新压缩）
+		var httpResp *cache.HTTPResponse
+		if status == cache.StatusFetching &&
+			revalidationResp != nil &&
+			c.StatusCode == http.StatusNotModified {
+			httpResp = revalidationResp.Refresh(header)
+			header = httpResp.Header
+		}
+
+		// 对于fetching与hit for pass的请求，从响应头中判断该请求缓存的有效期
+		// hit for pass的请求如果可缓存，则更新为可缓存
+		if status == cache.StatusFetching || status == cache.StatusHitForPass {
+			statusCode := c.StatusCode
+			if httpResp != nil {
+				statusCode = httpResp.StatusCode
+			}
+			var rule statusRule
+			if disp := cache.GetDispatcher(s.GetCache()); disp != nil {
+				rule = disp
+			}
+			cacheRule := l.GetCacheRule(c.Request.URL.Path, header.Get(elton.HeaderContentType))
+			maxAge := getStatusCacheMaxAge(statusCode, header, rule, cacheRule)
 			if maxAge > 0 {
+				// 删除不可缓存的字段（如忽略的Set-Cookie），避免其被缓存
+				for _, field := range getUncachedFields(header, cacheRule) {
+					header.Del(field)
+				}
 				setHTTPCacheMaxAge(c, maxAge)
+				whileRevalidate, ifError := getCacheStale(header)
+				setHTTPCacheStale(c, whileRevalidate, ifError)
 			}
 		}
+		// Surrogate-Control只用于pike的缓存，不返回给客户端
+		header.Del(headerSurrogateControl)
 
-		// 初始化http response时，如果已压缩，而且非gzip br，则会解压
-		httpResp, err := cache.NewHTTPResponse(c.StatusCode, header, header.Get(elton.HeaderContentEncoding), data)
-		if err != nil {
-			return
+		if httpResp == nil {
+			// 初始化http response时，如果已压缩，而且非gzip br，则会解压
+			httpResp, err = cache.NewHTTPResponse(c.StatusCode, header, header.Get(elton.HeaderContentEncoding), data)
+			if err != nil {
+				return
+			}
 		}
 
 		compressSrv, minLength, filter := s.GetCompress()
 		httpResp.CompressSrv = compressSrv
 		httpResp.CompressMinLength = minLength
 		httpResp.CompressContentTypeFilter = filter
+		// 按server的编码顺序预先压缩
+		httpResp.CompressEncodings = s.GetCompressEncodings()
 		setHTTPResp(c, httpResp)
 
 		// 重置context中由于proxy中间件影响的状态 statusCode, header, body
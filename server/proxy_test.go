@@ -36,6 +36,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/vicanso/elton"
 	"github.com/vicanso/elton/middleware"
+	"github.com/vicanso/hes"
 	"github.com/vicanso/pike/cache"
 	"github.com/vicanso/pike/config"
 	"github.com/vicanso/pike/location"
@@ -106,9 +107,237 @@ func TestGetCacheMaxAge(t *testing.T) {
 		if tt.existsAge != 0 {
 			h.Add("Age", strconv.Itoa(tt.existsAge))
 		}
-		age := getCacheMaxAge(h)
+		age, _ := getCacheMaxAge(h)
 		assert.Equal(tt.age, age)
 	}
+
+	// 设置了vary为*
+	h := http.Header{}
+	h.Set(elton.HeaderCacheControl, "max-age=10")
+	h.Set("Vary", "*")
+	age, ok := getCacheMaxAge(h)
+	assert.True(ok)
+	assert.Equal(0, age)
+
+	// vary的列表中包含*
+	h = http.Header{}
+	h.Set(elton.HeaderCacheControl, "max-age=10")
+	h.Set("Vary", "Accept-Encoding, *")
+	age, ok = getCacheMaxAge(h)
+	assert.True(ok)
+	assert.Equal(0, age)
+
+	// vary不包含*
+	h = http.Header{}
+	h.Set(elton.HeaderCacheControl, "max-age=10")
+	h.Add("Vary", "Accept-Encoding")
+	h.Add("Vary", "Origin")
+	age, ok = getCacheMaxAge(h)
+	assert.True(ok)
+	assert.Equal(10, age)
+
+	// no-cache限定的字段不影响是否可缓存
+	h = http.Header{}
+	h.Set(elton.HeaderCacheControl, `max-age=10, no-cache="Set-Cookie"`)
+	h.Set(elton.HeaderSetCookie, "jt=abc")
+	age, ok = getCacheMaxAge(h)
+	assert.True(ok)
+	assert.Equal(10, age)
+	assert.Equal([]string{
+		"Set-Cookie",
+	}, getUncachedFields(h, nil))
+
+	// 根据Expires获取有效期
+	h = http.Header{}
+	now := time.Now().UTC()
+	h.Set("Date", now.Format(http.TimeFormat))
+	h.Set("Expires", now.Add(time.Minute).Format(http.TimeFormat))
+	age, ok = getCacheMaxAge(h)
+	assert.True(ok)
+	assert.Equal(60, age)
+
+	// 优先使用Surrogate-Control
+	h = http.Header{}
+	h.Set(elton.HeaderCacheControl, "s-maxage=10")
+	h.Set("Surrogate-Control", "max-age=3600")
+	age, ok = getCacheMaxAge(h)
+	assert.True(ok)
+	assert.Equal(3600, age)
+
+	// 未设置max-age
+	h = http.Header{}
+	h.Set(elton.HeaderCacheControl, "public")
+	_, ok = getCacheMaxAge(h)
+	assert.False(ok)
+}
+
+type testStatusRule struct{}
+
+func (r *testStatusRule) IsCacheableStatus(statusCode int) bool {
+	return statusCode == 200 || statusCode == 404
+}
+
+func (r *testStatusRule) GetStatusTTL(statusCode int) int {
+	if statusCode == 404 {
+		return 30
+	}
+	return 0
+}
+
+func (r *testStatusRule) ShouldUseHeuristicFreshness() bool {
+	return true
+}
+
+func TestGetStatusCacheMaxAge(t *testing.T) {
+	assert := assert.New(t)
+
+	maxAgeHeader := http.Header{}
+	maxAgeHeader.Set(elton.HeaderCacheControl, "max-age=60")
+	noCacheHeader := http.Header{}
+	noCacheHeader.Set(elton.HeaderCacheControl, "no-cache")
+	privateHeader := http.Header{}
+	privateHeader.Set(elton.HeaderCacheControl, "private")
+	lastModifiedHeader := http.Header{}
+	now := time.Now().UTC()
+	lastModifiedHeader.Set("Date", now.Format(http.TimeFormat))
+	lastModifiedHeader.Set("Last-Modified", now.Add(-time.Hour).Format(http.TimeFormat))
+	cookieHeader := http.Header{}
+	cookieHeader.Set(elton.HeaderCacheControl, "max-age=60")
+	cookieHeader.Set(elton.HeaderSetCookie, "jt=abc")
+	tests := []struct {
+		statusCode int
+		header     http.Header
+		rule       statusRule
+		cacheRule  *location.CacheRule
+		maxAge     int
+	}{
+		// 无规则
+		{
+			statusCode: 500,
+			header:     maxAgeHeader,
+			maxAge:     60,
+		},
+		// 不可缓存的状态码
+		{
+			statusCode: 500,
+			header:     maxAgeHeader,
+			rule:       &testStatusRule{},
+			maxAge:     0,
+		},
+		// 使用响应的max-age
+		{
+			statusCode: 404,
+			header:     maxAgeHeader,
+			rule:       &testStatusRule{},
+			maxAge:     60,
+		},
+		// 使用状态码的默认有效期
+		{
+			statusCode: 404,
+			header:     http.Header{},
+			rule:       &testStatusRule{},
+			maxAge:     30,
+		},
+		// 设置了no-cache
+		{
+			statusCode: 404,
+			header:     noCacheHeader,
+			rule:       &testStatusRule{},
+			maxAge:     0,
+		},
+		// 无默认有效期
+		{
+			statusCode: 200,
+			header:     http.Header{},
+			rule:       &testStatusRule{},
+			maxAge:     0,
+		},
+		// 强制设置缓存有效期
+		{
+			statusCode: 200,
+			header:     privateHeader,
+			cacheRule: &location.CacheRule{
+				TTL: 10,
+			},
+			maxAge: 10,
+		},
+		// 强制设置缓存有效期，但有Set-Cookie
+		{
+			statusCode: 200,
+			header:     cookieHeader,
+			cacheRule: &location.CacheRule{
+				TTL: 10,
+			},
+			maxAge: 0,
+		},
+		// 忽略Set-Cookie
+		{
+			statusCode: 200,
+			header:     cookieHeader,
+			cacheRule: &location.CacheRule{
+				IgnoreSetCookie: true,
+			},
+			maxAge: 60,
+		},
+		// 限制缓存有效期
+		{
+			statusCode: 200,
+			header:     maxAgeHeader,
+			cacheRule: &location.CacheRule{
+				MaxTTL: 10,
+			},
+			maxAge: 10,
+		},
+		// 不可缓存
+		{
+			statusCode: 200,
+			header:     maxAgeHeader,
+			cacheRule: &location.CacheRule{
+				NoCache: true,
+			},
+			maxAge: 0,
+		},
+		// 启发式的缓存有效期
+		{
+			statusCode: 200,
+			header:     lastModifiedHeader,
+			rule:       &testStatusRule{},
+			maxAge:     360,
+		},
+		// 强制设置缓存有效期，但状态码不可缓存
+		{
+			statusCode: 500,
+			header:     http.Header{},
+			rule:       &testStatusRule{},
+			cacheRule: &location.CacheRule{
+				TTL: 10,
+			},
+			maxAge: 0,
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(tt.maxAge, getStatusCacheMaxAge(tt.statusCode, tt.header, tt.rule, tt.cacheRule))
+	}
+}
+
+func TestGetCacheStale(t *testing.T) {
+	assert := assert.New(t)
+
+	h := http.Header{}
+	whileRevalidate, ifError := getCacheStale(h)
+	assert.Equal(0, whileRevalidate)
+	assert.Equal(0, ifError)
+
+	h.Set(elton.HeaderCacheControl, "max-age=10, stale-while-revalidate=30, stale-if-error=60")
+	whileRevalidate, ifError = getCacheStale(h)
+	assert.Equal(30, whileRevalidate)
+	assert.Equal(60, ifError)
+
+	// must-revalidate不可使用过期数据
+	h.Set(elton.HeaderCacheControl, "max-age=10, must-revalidate, stale-while-revalidate=30")
+	whileRevalidate, ifError = getCacheStale(h)
+	assert.Equal(-1, whileRevalidate)
+	assert.Equal(-1, ifError)
 }
 
 func TestProxyMiddleware(t *testing.T) {
@@ -150,6 +379,17 @@ func TestProxyMiddleware(t *testing.T) {
 			return nil
 		})
 
+		e.GET("/revalidate", func(c *elton.Context) error {
+			c.CacheMaxAge(2 * time.Minute)
+			if c.GetRequestHeader(elton.HeaderIfNoneMatch) == `"1"` {
+				c.SetHeader("X-Refreshed", "1")
+				c.NotModified()
+				return nil
+			}
+			c.BodyBuffer = bytes.NewBufferString("new")
+			return nil
+		})
+
 		// e.POST("/")
 		_ = e.Serve(ln)
 	}()
@@ -276,4 +516,92 @@ func TestProxyMiddleware(t *testing.T) {
 		assert.Equal(serverOption.CompressMinLength, httpResp.CompressMinLength)
 		assert.Equal(serverOption.Compress, httpResp.CompressSrv)
 	}
+
+	// 使用过期数据的ETag校验，304则使用原有数据并更新响应头
+	for _, etag := range []string{`"1"`, `"2"`} {
+		c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/revalidate", nil))
+		setCacheStatus(c, cache.StatusFetching)
+		revalidationResp := &cache.HTTPResponse{
+			StatusCode: 200,
+			Header: http.Header{
+				"Etag": []string{
+					etag,
+				},
+			},
+			EncodedBodies: map[string][]byte{
+				"gzip": []byte("old"),
+			},
+		}
+		setRevalidationResp(c, revalidationResp)
+		c.Next = func() error {
+			return nil
+		}
+		err := fn(c)
+		assert.Nil(err)
+		assert.Empty(c.GetRequestHeader(elton.HeaderIfNoneMatch))
+		assert.Equal(120, getHTTPCacheMaxAge(c))
+		httpResp := getHTTPResp(c)
+		if etag == `"1"` {
+			assert.Equal(200, httpResp.StatusCode)
+			assert.Equal("old", string(httpResp.EncodedBodies["gzip"]))
+			assert.Equal("1", httpResp.Header.Get("X-Refreshed"))
+			assert.Equal(etag, httpResp.Header.Get(elton.HeaderETag))
+			// 原有的缓存数据不修改
+			assert.Empty(revalidationResp.Header.Get("X-Refreshed"))
+		} else {
+			assert.Equal("new", string(httpResp.RawBody))
+		}
+	}
+}
+
+func TestProxyDefaultTimeout(t *testing.T) {
+	assert := assert.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:")
+	assert.Nil(err)
+	defer ln.Close()
+
+	go func() {
+		e := elton.New()
+		e.GET("/hung", func(c *elton.Context) error {
+			time.Sleep(time.Second)
+			c.BodyBuffer = bytes.NewBufferString("hung")
+			return nil
+		})
+		_ = e.Serve(ln)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	location.Reset([]config.LocationConfig{
+		{
+			Name:     "test-default-timeout",
+			Upstream: "test-default-timeout",
+		},
+	})
+	upstream.Reset([]config.UpstreamConfig{
+		{
+			Name: "test-default-timeout",
+			Servers: []config.UpstreamServerConfig{
+				{
+					Addr: "http://" + ln.Addr().String(),
+				},
+			},
+		},
+	})
+	fn := NewProxy(NewServer(ServerOption{
+		Locations: []string{
+			"test-default-timeout",
+		},
+	}))
+
+	// location未设置proxy timeout时使用默认的超时
+	c := elton.NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/hung", nil))
+	setCacheStatus(c, cache.StatusFetching)
+	setDefaultProxyTimeout(c, 50*time.Millisecond)
+	c.Next = func() error {
+		return nil
+	}
+	start := time.Now()
+	err = fn(c)
+	assert.NotNil(err)
+	assert.Equal(http.StatusGatewayTimeout, err.(*hes.Error).StatusCode)
+	assert.Less(time.Since(start), 500*time.Millisecond)
 }
@@ -23,13 +23,49 @@
 package server
 
 import (
+	"net/http"
 	"strconv"
 
 	"github.com/vicanso/elton"
+	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/location"
 )
 
+// shouldFillRange check the response should be filled by the Range header,
+// only the complete response(the Range header is not forwarded) supports range
+func shouldFillRange(c *elton.Context) bool {
+	if c.Request.Method != http.MethodGet ||
+		c.GetRequestHeader(headerRange) == "" {
+		return false
+	}
+	switch getCacheStatus(c) {
+	case cache.StatusHit,
+		cache.StatusStale,
+		cache.StatusFetching:
+		return true
+	default:
+		return false
+	}
+}
+
+// isEdgeCached check the response is cached by pike,
+// the client cache headers are rewritten only for the cached response
+func isEdgeCached(c *elton.Context) bool {
+	switch getCacheStatus(c) {
+	case cache.StatusHit,
+		cache.StatusStale:
+		return true
+	case cache.StatusFetching,
+		cache.StatusHitForPass:
+		// 只有实际保存至缓存的响应（如206、304或过大的响应则不缓存）
+		return isCached(c)
+	default:
+		return false
+	}
+}
+
 // NewResponder create a responder middleware
-func NewResponder() elton.Handler {
+func NewResponder(s *server) elton.Handler {
 	return func(c *elton.Context) (err error) {
 		err = c.Next()
 		if err != nil {
@@ -41,7 +77,12 @@ func NewResponder() elton.Handler {
 			err = ErrInvalidResponse
 			return
 		}
-		err = httpResp.Fill(c)
+		encodings := s.GetCompressEncodings()
+		if shouldFillRange(c) {
+			err = httpResp.FillRange(c, encodings...)
+		} else {
+			err = httpResp.Fill(c, encodings...)
+		}
 		if err != nil {
 			return
 		}
@@ -52,6 +93,13 @@ func NewResponder() elton.Handler {
 		if age > 0 {
 			c.SetHeader(headerAge, strconv.Itoa(age))
 		}
+		// 根据location的配置调整返回给客户端的缓存响应头
+		if isEdgeCached(c) {
+			l := location.Get(c.Request.Host, c.Request.RequestURI, s.GetLocations()...)
+			if l != nil && l.ClientCache != nil {
+				l.ClientCache.Rewrite(c.Header())
+			}
+		}
 
 		c.SetHeader(headerCacheStatus, getCacheStatus(c).String())
 		return
@@ -23,12 +23,15 @@
 package server
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/vicanso/elton"
 	"github.com/vicanso/pike/cache"
+	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/location"
 )
 
 func TestResponderMiddleware(t *testing.T) {
@@ -59,7 +62,7 @@ func TestResponderMiddleware(t *testing.T) {
 			body:      []byte("abcd"),
 		},
 	}
-	fn := NewResponder()
+	fn := NewResponder(NewServer(ServerOption{}))
 	for _, tt := range tests {
 		c := tt.create()
 		c.Next = func() error {
@@ -74,3 +77,230 @@ func TestResponderMiddleware(t *testing.T) {
 		}
 	}
 }
+
+func TestResponderMiddlewareRange(t *testing.T) {
+	assert := assert.New(t)
+
+	tests := []struct {
+		method     string
+		status     cache.Status
+		statusCode int
+		body       string
+	}{
+		{
+			method:     "GET",
+			status:     cache.StatusHit,
+			statusCode: 206,
+			body:       "01",
+		},
+		{
+			method:     "GET",
+			status:     cache.StatusFetching,
+			statusCode: 206,
+			body:       "01",
+		},
+		// hit for pass的请求由upstream处理range
+		{
+			method:     "GET",
+			status:     cache.StatusHitForPass,
+			statusCode: 200,
+			body:       "0123456789",
+		},
+		{
+			method:     "HEAD",
+			status:     cache.StatusHit,
+			statusCode: 200,
+			body:       "0123456789",
+		},
+	}
+	fn := NewResponder(NewServer(ServerOption{}))
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", nil)
+		req.Header.Set("Range", "bytes=0-1")
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		setCacheStatus(c, tt.status)
+		setHTTPResp(c, &cache.HTTPResponse{
+			StatusCode: 200,
+			RawBody:    []byte("0123456789"),
+		})
+		c.Next = func() error {
+			return nil
+		}
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(tt.statusCode, c.StatusCode)
+		assert.Equal(tt.body, c.BodyBuffer.String())
+	}
+}
+
+func TestResponderMiddlewareEncodings(t *testing.T) {
+	assert := assert.New(t)
+
+	resp := &cache.HTTPResponse{
+		StatusCode: 200,
+		EncodedBodies: map[string][]byte{
+			"gzip": []byte("gzip"),
+			"br":   []byte("br"),
+			"zstd": []byte("zstd"),
+		},
+	}
+	tests := []struct {
+		encodings      []string
+		acceptEncoding string
+		encoding       string
+	}{
+		{
+			acceptEncoding: "gzip, br, zstd",
+			encoding:       "br",
+		},
+		{
+			encodings: []string{
+				"zstd",
+				"gzip",
+			},
+			acceptEncoding: "gzip, br, zstd",
+			encoding:       "zstd",
+		},
+		{
+			encodings: []string{
+				"zstd",
+				"gzip",
+			},
+			acceptEncoding: "gzip, br, zstd;q=0.5",
+			encoding:       "gzip",
+		},
+	}
+	for _, tt := range tests {
+		fn := NewResponder(NewServer(ServerOption{
+			CompressEncodings: tt.encodings,
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		setHTTPResp(c, resp)
+		c.Next = func() error {
+			return nil
+		}
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(tt.encoding, c.GetHeader(elton.HeaderContentEncoding))
+		assert.Equal(tt.encoding, c.BodyBuffer.String())
+		assert.Equal("Accept-Encoding", c.GetHeader("Vary"))
+	}
+
+	// 不接受identity且无可接受的编码
+	fn := NewResponder(NewServer(ServerOption{}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "deflate, *;q=0")
+	c := elton.NewContext(httptest.NewRecorder(), req)
+	setHTTPResp(c, &cache.HTTPResponse{
+		StatusCode: 200,
+		RawBody:    []byte("abcd"),
+	})
+	c.Next = func() error {
+		return nil
+	}
+	err := fn(c)
+	assert.Equal(cache.ErrNotAcceptable, err)
+}
+
+func TestResponderMiddlewareClientCache(t *testing.T) {
+	assert := assert.New(t)
+
+	location.Reset([]config.LocationConfig{
+		{
+			Name:     "client-cache",
+			Upstream: "test",
+			Prefixes: []string{
+				"/client-cache",
+			},
+			ClientCache: &config.ClientCacheConfig{
+				CacheControl: "public, max-age=60",
+			},
+		},
+	})
+	fn := NewResponder(NewServer(ServerOption{
+		Locations: []string{
+			"client-cache",
+		},
+	}))
+
+	tests := []struct {
+		status       cache.Status
+		maxAge       int
+		cached       bool
+		cacheControl string
+	}{
+		{
+			status:       cache.StatusHit,
+			cacheControl: "public, max-age=60",
+		},
+		{
+			status:       cache.StatusFetching,
+			maxAge:       3600,
+			cached:       true,
+			cacheControl: "public, max-age=60",
+		},
+		{
+			status:       cache.StatusHitForPass,
+			maxAge:       3600,
+			cached:       true,
+			cacheControl: "public, max-age=60",
+		},
+		// 有缓存有效期但未保存至缓存（如206或过大的响应）不调整
+		{
+			status:       cache.StatusHitForPass,
+			maxAge:       3600,
+			cacheControl: "s-maxage=3600",
+		},
+		{
+			status:       cache.StatusFetching,
+			maxAge:       3600,
+			cacheControl: "s-maxage=3600",
+		},
+		// 不可缓存的响应不调整
+		{
+			status:       cache.StatusFetching,
+			cacheControl: "no-cache",
+		},
+		{
+			status:       cache.StatusPassed,
+			cacheControl: "no-cache",
+		},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/client-cache", nil)
+		c := elton.NewContext(httptest.NewRecorder(), req)
+		setCacheStatus(c, tt.status)
+		setHTTPCacheMaxAge(c, tt.maxAge)
+		if tt.cached {
+			setCached(c)
+		}
+		setHTTPRespAge(c, 10)
+		cacheControl := "no-cache"
+		if tt.status == cache.StatusHit || tt.maxAge > 0 {
+			cacheControl = "s-maxage=3600"
+		}
+		setHTTPResp(c, &cache.HTTPResponse{
+			StatusCode: 200,
+			Header: http.Header{
+				"Cache-Control": []string{
+					cacheControl,
+				},
+			},
+			RawBody: []byte("Hello world!"),
+		})
+		c.Next = func() error {
+			return nil
+		}
+		err := fn(c)
+		assert.Nil(err)
+		assert.Equal(tt.cacheControl, c.GetHeader("Cache-Control"))
+		if tt.cacheControl == "public, max-age=60" {
+			assert.NotEmpty(c.GetHeader("Expires"))
+			assert.Empty(c.GetHeader("Age"))
+		} else {
+			assert.Equal("10", c.GetHeader("Age"))
+		}
+	}
+}
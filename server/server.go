@@ -26,6 +26,7 @@ import (
 	"net"
 	"net/http"
 	"regexp"
+	"strings"
 	"sync"
 	"time"
 
@@ -53,6 +54,9 @@ type (
 		compress                  string
 		compressMinLength         int
 		compressContentTypeFilter *regexp.Regexp
+		compressEncodings         []string
+		forceRefresh              bool
+		forceRefreshIPs           []*net.IPNet
 		processing                atomic.Int32
 		ln                        net.Listener
 		e                         *elton.Elton
@@ -76,6 +80,12 @@ type (
 		CompressMinLength int
 		// 压缩数据类型
 		CompressContentTypeFilter *regexp.Regexp
+		// 压缩编码的优先顺序，为空则使用默认顺序(br, zstd, gzip)
+		CompressEncodings []string
+		// 允许客户端通过no-cache强制刷新缓存
+		ForceRefresh bool
+		// 允许强制刷新缓存的客户端IP段，为空则不限制
+		ForceRefreshIPs []*net.IPNet
 	}
 )
 
@@ -88,6 +98,16 @@ const (
 	httpRespAgeKey = "_httpRespAge"
 	// httpCacheMaxAgeKey 缓存有效期
 	httpCacheMaxAgeKey = "_httpCacheMaxAge"
+	// httpCacheStaleWhileRevalidateKey 缓存的stale-while-revalidate
+	httpCacheStaleWhileRevalidateKey = "_httpCacheStaleWhileRevalidate"
+	// httpCacheStaleIfErrorKey 缓存的stale-if-error
+	httpCacheStaleIfErrorKey = "_httpCacheStaleIfError"
+	// revalidationRespKey 用于向upstream校验的过期缓存数据
+	revalidationRespKey = "_revalidationResp"
+	// defaultProxyTimeoutKey location未设置proxy timeout时使用的超时时长
+	defaultProxyTimeoutKey = "_defaultProxyTimeout"
+	// cachedKey 此次的响应是否已保存至缓存
+	cachedKey = "_cached"
 )
 
 const defaultCompressMinLength = 1024
@@ -97,6 +117,14 @@ var defaultServers = NewServers(nil)
 const (
 	headerAge         = "Age"
 	headerCacheStatus = "X-Status"
+	headerVary        = "Vary"
+	headerRange       = "Range"
+	headerIfRange     = "If-Range"
+	headerPragma      = "Pragma"
+
+	headerContentLocation = "Content-Location"
+	// headerSurrogateControl 用于设置缓存有效期的响应头，返回客户端前删除
+	headerSurrogateControl = "Surrogate-Control"
 )
 
 var (
@@ -104,6 +132,10 @@ var (
 
 	ErrCacheDispatcherNotFound = util.NewError("Available cache dispatcher not found", http.StatusServiceUnavailable)
 
+	ErrWaitTimeout = util.NewError("Wait for fetching timeout", http.StatusGatewayTimeout)
+
+	ErrOnlyIfCached = util.NewError("Response is not cached", http.StatusGatewayTimeout)
+
 	ErrLocationNotFound = util.NewError("Available location not found", http.StatusServiceUnavailable)
 
 	ErrUpstreamNotFound = util.NewError("Available upstream not found", http.StatusBadGateway)
@@ -145,6 +177,43 @@ func getHTTPCacheMaxAge(c *elton.Context) int {
 	return c.GetInt(httpCacheMaxAgeKey)
 }
 
+func setHTTPCacheStale(c *elton.Context, whileRevalidate, ifError int) {
+	c.Set(httpCacheStaleWhileRevalidateKey, whileRevalidate)
+	c.Set(httpCacheStaleIfErrorKey, ifError)
+}
+func getHTTPCacheStale(c *elton.Context) (whileRevalidate, ifError int) {
+	return c.GetInt(httpCacheStaleWhileRevalidateKey), c.GetInt(httpCacheStaleIfErrorKey)
+}
+
+func getRevalidationResp(c *elton.Context) *cache.HTTPResponse {
+	value, exists := c.Get(revalidationRespKey)
+	if !exists {
+		return nil
+	}
+	resp, ok := value.(*cache.HTTPResponse)
+	if !ok {
+		return nil
+	}
+	return resp
+}
+func setRevalidationResp(c *elton.Context, resp *cache.HTTPResponse) {
+	c.Set(revalidationRespKey, resp)
+}
+
+func setCached(c *elton.Context) {
+	c.Set(cachedKey, true)
+}
+func isCached(c *elton.Context) bool {
+	return c.GetBool(cachedKey)
+}
+
+func setDefaultProxyTimeout(c *elton.Context, timeout time.Duration) {
+	c.Set(defaultProxyTimeoutKey, timeout)
+}
+func getDefaultProxyTimeout(c *elton.Context) time.Duration {
+	return c.GetDuration(defaultProxyTimeoutKey)
+}
+
 // NewServer create a new server
 func NewServer(opt ServerOption) *server {
 	minLength := opt.CompressMinLength
@@ -161,6 +230,9 @@ func NewServer(opt ServerOption) *server {
 		compress:                  opt.Compress,
 		compressMinLength:         minLength,
 		compressContentTypeFilter: opt.CompressContentTypeFilter,
+		compressEncodings:         opt.CompressEncodings,
+		forceRefresh:              opt.ForceRefresh,
+		forceRefreshIPs:           opt.ForceRefreshIPs,
 	}
 }
 
@@ -273,6 +345,9 @@ func (s *server) Update(opt ServerOption) {
 	s.compress = opt.Compress
 	s.compressMinLength = opt.CompressMinLength
 	s.compressContentTypeFilter = opt.CompressContentTypeFilter
+	s.compressEncodings = opt.CompressEncodings
+	s.forceRefresh = opt.ForceRefresh
+	s.forceRefreshIPs = opt.ForceRefreshIPs
 }
 
 // GetCache get the cache of server
@@ -296,6 +371,42 @@ func (s *server) GetCompress() (name string, minLength int, filter *regexp.Regex
 	return s.compress, s.compressMinLength, s.compressContentTypeFilter
 }
 
+// GetCompressEncodings get the preference order of compress encodings
+func (s *server) GetCompressEncodings() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.compressEncodings
+}
+
+// AllowForceRefresh check the request can force to refresh the cache,
+// the ip of request is got from the remote address of connection
+func (s *server) AllowForceRefresh(req *http.Request) bool {
+	s.mutex.RLock()
+	forceRefresh := s.forceRefresh
+	ipNets := s.forceRefreshIPs
+	s.mutex.RUnlock()
+	if !forceRefresh {
+		return false
+	}
+	if len(ipNets) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range ipNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // Start start the server
 func (s *server) Start(useGoRoutine bool) (err error) {
 	s.mutex.Lock()
@@ -326,7 +437,7 @@ func (s *server) Start(useGoRoutine bool) (err error) {
 	// TODO 考虑是否自定义出错中间件，对于系统的error(category: "pike")触发告警
 	e.Use(middleware.NewDefaultError())
 	e.Use(middleware.NewDefaultFresh())
-	e.Use(NewResponder())
+	e.Use(NewResponder(s))
 	e.Use(NewCache(s))
 	e.Use(NewProxy(s))
 	e.ALL("/*", func(c *elton.Context) error {
@@ -389,6 +500,26 @@ func convertConfig(configs []config.ServerConfig) []ServerOption {
 		if item.CompressContentTypeFilter != "" {
 			reg, _ = regexp.Compile(item.CompressContentTypeFilter)
 		}
+		ipNets := make([]*net.IPNet, 0, len(item.ForceRefreshIPs))
+		for _, value := range item.ForceRefreshIPs {
+			// 单个IP则转换为CIDR
+			if !strings.Contains(value, "/") {
+				if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+					value += "/32"
+				} else {
+					value += "/128"
+				}
+			}
+			_, ipNet, err := net.ParseCIDR(value)
+			if err != nil {
+				log.Default().Error("parse force refresh ip fail",
+					zap.String("value", value),
+					zap.Error(err),
+				)
+				continue
+			}
+			ipNets = append(ipNets, ipNet)
+		}
 		opts = append(opts, ServerOption{
 			LogFormat:                 item.LogFormat,
 			Addr:                      item.Addr,
@@ -397,6 +528,9 @@ func convertConfig(configs []config.ServerConfig) []ServerOption {
 			Compress:                  item.Compress,
 			CompressMinLength:         int(minLength),
 			CompressContentTypeFilter: reg,
+			CompressEncodings:         item.CompressEncodings,
+			ForceRefresh:              item.ForceRefresh,
+			ForceRefreshIPs:           ipNets,
 		})
 	}
 	return opts
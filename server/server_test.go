@@ -23,6 +23,7 @@
 package server
 
 import (
+	"net/http/httptest"
 	"regexp"
 	"testing"
 
@@ -76,11 +77,16 @@ func TestServer(t *testing.T) {
 	cache := "cache-test"
 	compress := "compress-test"
 	filter := regexp.MustCompile(`text`)
+	encodings := []string{
+		"zstd",
+		"gzip",
+	}
 	s := NewServer(ServerOption{
 		Locations:                 locations,
 		Cache:                     cache,
 		Compress:                  compress,
 		CompressContentTypeFilter: filter,
+		CompressEncodings:         encodings,
 	})
 	defer s.Close()
 
@@ -90,6 +96,7 @@ func TestServer(t *testing.T) {
 	assert.Equal(compress, compressSrv)
 	assert.Equal(defaultCompressMinLength, compressMinLength)
 	assert.Equal(filter, compressContentTypeFilter)
+	assert.Equal(encodings, s.GetCompressEncodings())
 
 	err := s.Start(true)
 	assert.True(s.listening)
@@ -199,3 +206,35 @@ func TestDefaultServers(t *testing.T) {
 	s := Get("")
 	assert.NotNil(s)
 }
+
+func TestAllowForceRefresh(t *testing.T) {
+	assert := assert.New(t)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.168.1.10:5000"
+
+	s := NewServer(ServerOption{})
+	assert.False(s.AllowForceRefresh(req))
+
+	s = NewServer(ServerOption{
+		ForceRefresh: true,
+	})
+	assert.True(s.AllowForceRefresh(req))
+
+	opts := convertConfig([]config.ServerConfig{
+		{
+			ForceRefresh: true,
+			ForceRefreshIPs: []string{
+				"127.0.0.1",
+				"10.0.0.0/8",
+			},
+		},
+	})
+	assert.Equal(2, len(opts[0].ForceRefreshIPs))
+	s = NewServer(opts[0])
+	assert.False(s.AllowForceRefresh(req))
+	req.RemoteAddr = "10.1.1.1:5000"
+	assert.True(s.AllowForceRefresh(req))
+	req.RemoteAddr = "127.0.0.1:5000"
+	assert.True(s.AllowForceRefresh(req))
+}
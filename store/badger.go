@@ -116,6 +116,24 @@ func (bs *badgerStore) Delete(key []byte) (err error) {
 	})
 }
 
+// Scan scan the keys of badger which has the prefix
+func (bs *badgerStore) Scan(prefix []byte, fn func(key []byte) bool) (err error) {
+	return bs.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		// 只需要key，不预读取数据
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			if !fn(it.Item().KeyCopy(nil)) {
+				break
+			}
+		}
+		return nil
+	})
+}
+
 // Close close badger
 func (bs *badgerStore) Close() error {
 	return bs.db.Close()
@@ -51,3 +51,41 @@ func TestBadgerStore(t *testing.T) {
 	assert.Nil(err)
 
 }
+
+func TestBadgerStoreScan(t *testing.T) {
+	assert := assert.New(t)
+	badgerStore, err := newBadgerStore(os.TempDir())
+	assert.Nil(err)
+	defer badgerStore.Close()
+	keys := []string{
+		"GET test.com /users/1",
+		"GET test.com /users/2",
+		"GET test.com /books/1",
+	}
+	for _, key := range keys {
+		err = badgerStore.Set([]byte(key), []byte("value"), time.Minute)
+		assert.Nil(err)
+	}
+	defer func() {
+		for _, key := range keys {
+			_ = badgerStore.Delete([]byte(key))
+		}
+	}()
+
+	result := make([]string, 0)
+	err = badgerStore.Scan([]byte("GET test.com /users/"), func(key []byte) bool {
+		result = append(result, string(key))
+		return true
+	})
+	assert.Nil(err)
+	assert.Equal(keys[0:2], result)
+
+	// 返回false则停止
+	count := 0
+	err = badgerStore.Scan([]byte("GET test.com /"), func(key []byte) bool {
+		count++
+		return false
+	})
+	assert.Nil(err)
+	assert.Equal(1, count)
+}
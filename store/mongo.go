@@ -25,6 +25,7 @@ package store
 import (
 	"context"
 	"net/url"
+	"regexp"
 	"strings"
 	"time"
 
@@ -176,6 +177,34 @@ func (ms *mongoStore) Delete(key []byte) (err error) {
 	return
 }
 
+// Scan scans the keys of mongo which has the prefix
+func (ms *mongoStore) Scan(prefix []byte, fn func(key []byte) bool) (err error) {
+	filter := bson.M{}
+	if len(prefix) != 0 {
+		filter["key"] = bson.M{
+			"$regex": "^" + regexp.QuoteMeta(string(prefix)),
+		}
+	}
+	cursor, err := ms.collection().Find(context.Background(), filter, options.Find().SetProjection(bson.M{
+		"key": 1,
+	}))
+	if err != nil {
+		return
+	}
+	defer cursor.Close(context.Background())
+	for cursor.Next(context.Background()) {
+		result := mongoCache{}
+		err = cursor.Decode(&result)
+		if err != nil {
+			return
+		}
+		if !fn([]byte(result.Key)) {
+			break
+		}
+	}
+	return cursor.Err()
+}
+
 // Close closes mongo
 func (ms *mongoStore) Close() error {
 	return ms.client.Disconnect(context.TODO())
@@ -28,6 +28,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -135,6 +136,76 @@ func (rs *redisStore) Delete(key []byte) (err error) {
 	return cmd.Err()
 }
 
+// getScanPattern get the scan pattern of prefix, the glob characters are escaped
+func (rs *redisStore) getScanPattern(prefix []byte) string {
+	var b strings.Builder
+	for _, ch := range rs.getKey(prefix) {
+		switch ch {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(ch)
+	}
+	b.WriteRune('*')
+	return b.String()
+}
+
+// scanClient scan the keys of client
+func (rs *redisStore) scanClient(client redis.UniversalClient, pattern string, fn func(key []byte) bool) (done bool, err error) {
+	var cursor uint64
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), rs.timeout)
+		var keys []string
+		keys, cursor, err = client.Scan(ctx, cursor, pattern, 100).Result()
+		cancel()
+		if err != nil {
+			return
+		}
+		for _, key := range keys {
+			if !fn([]byte(strings.TrimPrefix(key, rs.prefix))) {
+				done = true
+				return
+			}
+		}
+		if cursor == 0 {
+			return
+		}
+	}
+}
+
+// Scan scan the keys of redis which has the prefix
+func (rs *redisStore) Scan(prefix []byte, fn func(key []byte) bool) (err error) {
+	pattern := rs.getScanPattern(prefix)
+	cluster, ok := rs.client.(*redis.ClusterClient)
+	if !ok {
+		_, err = rs.scanClient(rs.client, pattern, fn)
+		return
+	}
+	// cluster模式需要扫描所有的master节点
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mu := sync.Mutex{}
+	return cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		done, err := rs.scanClient(client, pattern, func(key []byte) bool {
+			// 各master节点并发扫描，回调函数需要串行执行
+			mu.Lock()
+			defer mu.Unlock()
+			if ctx.Err() != nil {
+				return false
+			}
+			if !fn(key) {
+				cancel()
+				return false
+			}
+			return true
+		})
+		if done {
+			return nil
+		}
+		return err
+	})
+}
+
 // Close close redis
 func (rs *redisStore) Close() error {
 	return rs.client.Close()
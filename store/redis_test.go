@@ -71,3 +71,35 @@ func TestNewRedisStore(t *testing.T) {
 
 	store.Close()
 }
+
+func TestRedisStoreScan(t *testing.T) {
+	assert := assert.New(t)
+
+	store, err := newRedisStore("redis://127.0.0.1:6379/?prefix=scan:")
+	assert.Nil(err)
+	defer store.Close()
+	rs := store.(*redisStore)
+	assert.Equal(`scan:GET test.com /users/\[1\]\*`, rs.getScanPattern([]byte("GET test.com /users/[1]")))
+
+	keys := []string{
+		"GET test.com /users/1",
+		"GET test.com /books/1",
+	}
+	for _, key := range keys {
+		err = store.Set([]byte(key), []byte("value"), time.Minute)
+		assert.Nil(err)
+	}
+	defer func() {
+		for _, key := range keys {
+			_ = store.Delete([]byte(key))
+		}
+	}()
+
+	result := make([]string, 0)
+	err = store.Scan([]byte("GET test.com /users/"), func(key []byte) bool {
+		result = append(result, string(key))
+		return true
+	})
+	assert.Nil(err)
+	assert.Equal(keys[0:1], result)
+}
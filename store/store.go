@@ -40,6 +40,8 @@ type Store interface {
 	Set(key []byte, data []byte, ttl time.Duration) (err error)
 	// Delete delete data from store
 	Delete(key []byte) (err error)
+	// Scan scan the keys of store which has the prefix, stop scanning if fn returns false
+	Scan(prefix []byte, fn func(key []byte) bool) (err error)
 	// Close close the store
 	Close() error
 }
@@ -0,0 +1,192 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package warm
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/vicanso/pike/upstream"
+)
+
+// maxSitemapDepth the max depth of sitemap index
+const maxSitemapDepth = 2
+
+// ErrUpstreamNotFound the upstream of sitemap is not found
+var ErrUpstreamNotFound = errors.New("the upstream of sitemap is not found")
+
+type (
+	// sitemap the sitemap(urlset) or sitemap index
+	sitemap struct {
+		XMLName  xml.Name
+		URLs     []sitemapLoc `xml:"url"`
+		Sitemaps []sitemapLoc `xml:"sitemap"`
+	}
+	sitemapLoc struct {
+		Loc string `xml:"loc"`
+	}
+)
+
+// ReadURLs reads the url list, one url per line, the empty line and the line starts with # are ignored
+func ReadURLs(r io.Reader) ([]string, error) {
+	urls := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	return urls, scanner.Err()
+}
+
+// ReadURLsFromFile reads the url list from local file
+func ReadURLsFromFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadURLs(f)
+}
+
+// parseSitemap parses the sitemap, it returns the url list and the sitemap list of sitemap index
+func parseSitemap(data []byte) (urls []string, sitemaps []string, err error) {
+	s := sitemap{}
+	err = xml.Unmarshal(data, &s)
+	if err != nil {
+		return
+	}
+	for _, item := range s.URLs {
+		if loc := strings.TrimSpace(item.Loc); loc != "" {
+			urls = append(urls, loc)
+		}
+	}
+	for _, item := range s.Sitemaps {
+		if loc := strings.TrimSpace(item.Loc); loc != "" {
+			sitemaps = append(sitemaps, loc)
+		}
+	}
+	return
+}
+
+// fetchFromUpstream fetches the data of url from the upstream, only the path and query of url are used
+func fetchFromUpstream(name, rawURL string) ([]byte, error) {
+	u := upstream.Get(name)
+	if u == nil {
+		return nil, ErrUpstreamNotFound
+	}
+	httpUpstream, done := u.HTTPUpstream.Next()
+	if httpUpstream == nil {
+		return nil, upstream.ErrUpstreamNotFound
+	}
+	if done != nil {
+		defer done()
+	}
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// 使用原url的host，请求upstream的地址
+	if req.URL.Host != "" {
+		req.Host = req.URL.Host
+	}
+	req.URL.Scheme = httpUpstream.URL.Scheme
+	req.URL.Host = httpUpstream.URL.Host
+	client := &http.Client{
+		Timeout: defaultTimeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch sitemap fail, status: %d", resp.StatusCode)
+	}
+	return data, nil
+}
+
+// FetchSitemap fetches the sitemap through the upstream and returns the url list,
+// the sitemaps of sitemap index are also fetched
+func FetchSitemap(upstreamName, sitemapURL string) ([]string, error) {
+	return fetchSitemap(upstreamName, sitemapURL, 0)
+}
+
+func fetchSitemap(upstreamName, sitemapURL string, depth int) ([]string, error) {
+	data, err := fetchFromUpstream(upstreamName, sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	urls, sitemaps, err := parseSitemap(data)
+	if err != nil {
+		return nil, err
+	}
+	if depth+1 >= maxSitemapDepth {
+		return urls, nil
+	}
+	for _, item := range sitemaps {
+		result, err := fetchSitemap(upstreamName, item, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, result...)
+	}
+	return urls, nil
+}
+
+// GetURLs gets the url list of warming from the url list, the local file and the sitemap fetched through the upstream
+func GetURLs(urls []string, file, upstreamName, sitemapURL string) ([]string, error) {
+	result := make([]string, 0, len(urls))
+	result = append(result, urls...)
+	if file != "" {
+		items, err := ReadURLsFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, items...)
+	}
+	if sitemapURL != "" {
+		items, err := FetchSitemap(upstreamName, sitemapURL)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, items...)
+	}
+	if len(result) == 0 {
+		return nil, ErrURLsIsEmpty
+	}
+	return result, nil
+}
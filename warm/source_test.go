@@ -0,0 +1,138 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package warm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vicanso/pike/config"
+	"github.com/vicanso/pike/upstream"
+)
+
+func TestReadURLs(t *testing.T) {
+	assert := assert.New(t)
+	urls, err := ReadURLs(strings.NewReader(`
+# 首页
+/
+ /users/me 
+
+http://test.com/books
+`))
+	assert.Nil(err)
+	assert.Equal([]string{
+		"/",
+		"/users/me",
+		"http://test.com/books",
+	}, urls)
+}
+
+func TestParseSitemap(t *testing.T) {
+	assert := assert.New(t)
+	urls, sitemaps, err := parseSitemap([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>http://test.com/</loc></url>
+	<url><loc> http://test.com/books </loc><lastmod>2021-01-01</lastmod></url>
+</urlset>`))
+	assert.Nil(err)
+	assert.Equal([]string{
+		"http://test.com/",
+		"http://test.com/books",
+	}, urls)
+	assert.Nil(sitemaps)
+
+	urls, sitemaps, err = parseSitemap([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>http://test.com/sitemap-books.xml</loc></sitemap>
+</sitemapindex>`))
+	assert.Nil(err)
+	assert.Nil(urls)
+	assert.Equal([]string{
+		"http://test.com/sitemap-books.xml",
+	}, sitemaps)
+
+	_, _, err = parseSitemap([]byte("abc"))
+	assert.NotNil(err)
+}
+
+func TestGetURLs(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := GetURLs(nil, "", "", "")
+	assert.Equal(ErrURLsIsEmpty, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "test.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			_, _ = w.Write([]byte(`<sitemapindex><sitemap><loc>http://test.com/sitemap-books.xml</loc></sitemap></sitemapindex>`))
+		case "/sitemap-books.xml":
+			_, _ = w.Write([]byte(`<urlset><url><loc>http://test.com/books</loc></url></urlset>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	upstreamName := "warm-test"
+	upstream.Reset([]config.UpstreamConfig{
+		{
+			Name: upstreamName,
+			Servers: []config.UpstreamServerConfig{
+				{
+					Addr: ts.URL,
+				},
+			},
+		},
+	})
+
+	f, err := ioutil.TempFile("", "")
+	assert.Nil(err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString("/users/me\n")
+	assert.Nil(err)
+	f.Close()
+
+	urls, err := GetURLs([]string{
+		"/",
+	}, f.Name(), upstreamName, "http://test.com/sitemap.xml")
+	assert.Nil(err)
+	assert.Equal([]string{
+		"/",
+		"/users/me",
+		"http://test.com/books",
+	}, urls)
+
+	_, err = GetURLs(nil, "", "not-found", "http://test.com/sitemap.xml")
+	assert.Equal(ErrUpstreamNotFound, err)
+
+	_, err = GetURLs(nil, "", upstreamName, "http://test.com/not-found.xml")
+	assert.NotNil(err)
+}
@@ -0,0 +1,361 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// 缓存预热，通过指定server请求url列表，使得url的响应在上线或清除缓存后预先缓存
+
+package warm
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultConcurrency default concurrency of warming
+	defaultConcurrency = 5
+	// defaultTimeout default timeout of warming request
+	defaultTimeout = 30 * time.Second
+	// maxTaskCount the max count of tasks to keep
+	maxTaskCount = 10
+	// maxRunningTaskCount the max count of running tasks
+	maxRunningTaskCount = 3
+	// MaxRate the max rate of warming
+	MaxRate = 10000
+)
+
+const headerCacheStatus = "X-Status"
+
+// ErrURLsIsEmpty the url list of warming is empty
+var ErrURLsIsEmpty = errors.New("the url list of warming is empty")
+
+// ErrRateIsInvalid the rate of warming is invalid
+var ErrRateIsInvalid = errors.New("the rate of warming should be 0-" + strconv.Itoa(MaxRate))
+
+// ErrTooManyTasks the count of running tasks is over limit
+var ErrTooManyTasks = errors.New("too many running warming tasks, please try again later")
+
+type (
+	// Option the option of warming
+	Option struct {
+		// Addr the address of server, e.g. 127.0.0.1:3015
+		Addr string
+		// Host the host of request if the url is not absolute
+		Host string
+		// URLs the url list, absolute url or path
+		URLs []string
+		// Concurrency the max number of requests at the same time
+		Concurrency int
+		// Rate the max number of requests per second, 0 means no limit
+		Rate int
+		// Timeout the timeout of request
+		Timeout time.Duration
+	}
+	// Result the result of warming url
+	Result struct {
+		URL string `json:"url,omitempty"`
+		// Status the status code of response
+		Status int `json:"status,omitempty"`
+		// CacheStatus the cache status of response(X-Status)
+		CacheStatus string `json:"cacheStatus,omitempty"`
+		// Consuming the consuming of request(ms)
+		Consuming int    `json:"consuming"`
+		Message   string `json:"message,omitempty"`
+	}
+	// Progress the progress of warming task
+	Progress struct {
+		ID         string    `json:"id,omitempty"`
+		Addr       string    `json:"addr,omitempty"`
+		Total      int       `json:"total"`
+		Done       int       `json:"done"`
+		Failed     int       `json:"failed"`
+		Finished   bool      `json:"finished"`
+		CreatedAt  time.Time `json:"createdAt,omitempty"`
+		FinishedAt time.Time `json:"finishedAt,omitempty"`
+		Results    []Result  `json:"results,omitempty"`
+	}
+	// Task the warming task
+	Task struct {
+		id        string
+		opt       Option
+		client    *http.Client
+		createdAt time.Time
+
+		mu         *sync.RWMutex
+		results    []Result
+		failed     int
+		finishedAt time.Time
+	}
+	tasks struct {
+		mu *sync.RWMutex
+		m  map[string]*Task
+	}
+)
+
+var defaultTasks = &tasks{
+	mu: &sync.RWMutex{},
+	m:  make(map[string]*Task),
+}
+
+// NewTask new a warming task
+func NewTask(opt Option) (*Task, error) {
+	if len(opt.URLs) == 0 {
+		return nil, ErrURLsIsEmpty
+	}
+	if opt.Rate < 0 || opt.Rate > MaxRate {
+		return nil, ErrRateIsInvalid
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = defaultConcurrency
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = defaultTimeout
+	}
+	now := time.Now()
+	return &Task{
+		id:        strconv.FormatInt(now.UnixNano(), 36),
+		opt:       opt,
+		createdAt: now,
+		client: &http.Client{
+			Timeout: opt.Timeout,
+			// 重定向的响应也需要缓存，因此不跟随
+			CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		mu:      &sync.RWMutex{},
+		results: make([]Result, 0, len(opt.URLs)),
+	}, nil
+}
+
+// ID get the id of task
+func (t *Task) ID() string {
+	return t.id
+}
+
+// newRequest new a request to server from the url
+func (t *Task) newRequest(rawURL string) (*http.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if host == "" {
+		host = t.opt.Host
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+t.opt.Addr+u.RequestURI(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if host != "" {
+		req.Host = host
+	}
+	return req, nil
+}
+
+// do requests the url through server
+func (t *Task) do(rawURL string) Result {
+	result := Result{
+		URL: rawURL,
+	}
+	startedAt := time.Now()
+	defer func() {
+		result.Consuming = int(time.Since(startedAt).Milliseconds())
+	}()
+	req, err := t.newRequest(rawURL)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	// 读取完整的响应数据，保证缓存完成
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	if err != nil {
+		result.Message = err.Error()
+	}
+	result.Status = resp.StatusCode
+	result.CacheStatus = resp.Header.Get(headerCacheStatus)
+	return result
+}
+
+// addResult add the result of url
+func (t *Task) addResult(result Result) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.results = append(t.results, result)
+	if result.Message != "" || result.Status >= http.StatusBadRequest {
+		t.failed++
+	}
+}
+
+// Run runs the task until all urls are done, the onResult is called after each url is done
+func (t *Task) Run(onResult func(Result)) {
+	urls := make(chan string)
+	go func() {
+		defer close(urls)
+		var ticker *time.Ticker
+		if t.opt.Rate > 0 {
+			// 保证间隔大于0，避免ticker panic
+			interval := time.Second / time.Duration(t.opt.Rate)
+			if interval <= 0 {
+				interval = time.Nanosecond
+			}
+			ticker = time.NewTicker(interval)
+			defer ticker.Stop()
+		}
+		for index, item := range t.opt.URLs {
+			// 按频率限制发送请求
+			if ticker != nil && index != 0 {
+				<-ticker.C
+			}
+			urls <- item
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < t.opt.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range urls {
+				result := t.do(item)
+				t.addResult(result)
+				if onResult != nil {
+					onResult(result)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	t.mu.Lock()
+	t.finishedAt = time.Now()
+	t.mu.Unlock()
+}
+
+// GetProgress get the progress of task, the results are returned if withResults is true
+func (t *Task) GetProgress(withResults bool) Progress {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	p := Progress{
+		ID:         t.id,
+		Addr:       t.opt.Addr,
+		Total:      len(t.opt.URLs),
+		Done:       len(t.results),
+		Failed:     t.failed,
+		Finished:   !t.finishedAt.IsZero(),
+		CreatedAt:  t.createdAt,
+		FinishedAt: t.finishedAt,
+	}
+	if withResults {
+		p.Results = make([]Result, len(t.results))
+		copy(p.Results, t.results)
+	}
+	return p
+}
+
+// add add the task, the oldest finished task is removed if the count is over limit,
+// ErrTooManyTasks is returned if the count of running tasks is over limit
+func (ts *tasks) add(t *Task) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	running := 0
+	for _, item := range ts.m {
+		if !item.GetProgress(false).Finished {
+			running++
+		}
+	}
+	if running >= maxRunningTaskCount {
+		return ErrTooManyTasks
+	}
+	ts.m[t.id] = t
+	if len(ts.m) <= maxTaskCount {
+		return nil
+	}
+	var oldest *Task
+	for _, item := range ts.m {
+		if item.GetProgress(false).Finished &&
+			(oldest == nil || item.createdAt.Before(oldest.createdAt)) {
+			oldest = item
+		}
+	}
+	if oldest != nil {
+		delete(ts.m, oldest.id)
+	}
+	return nil
+}
+
+// get get the task by id
+func (ts *tasks) get(id string) *Task {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.m[id]
+}
+
+// list list the progress of tasks, sorted by created time desc
+func (ts *tasks) list() []Progress {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	result := make([]Progress, 0, len(ts.m))
+	for _, item := range ts.m {
+		result = append(result, item.GetProgress(false))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Start starts the warming task in background, the progress can be got by the id of task,
+// ErrTooManyTasks is returned if the count of running tasks is over limit
+func Start(opt Option) (*Task, error) {
+	t, err := NewTask(opt)
+	if err != nil {
+		return nil, err
+	}
+	err = defaultTasks.add(t)
+	if err != nil {
+		return nil, err
+	}
+	go t.Run(nil)
+	return t, nil
+}
+
+// Get get the warming task by id
+func Get(id string) *Task {
+	return defaultTasks.get(id)
+}
+
+// List list the progress of warming tasks
+func List() []Progress {
+	return defaultTasks.list()
+}
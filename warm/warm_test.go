@@ -0,0 +1,180 @@
+// MIT License
+
+// Copyright (c) 2020 Tree Xie
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package warm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("X-Status", "fetching")
+		_, _ = w.Write([]byte(r.Host))
+	}))
+}
+
+func TestNewTask(t *testing.T) {
+	assert := assert.New(t)
+	_, err := NewTask(Option{})
+	assert.Equal(ErrURLsIsEmpty, err)
+
+	_, err = NewTask(Option{
+		URLs: []string{
+			"/",
+		},
+		Rate: MaxRate + 1,
+	})
+	assert.Equal(ErrRateIsInvalid, err)
+
+	task, err := NewTask(Option{
+		Addr: "127.0.0.1:3015",
+		Host: "test.com",
+		URLs: []string{
+			"/",
+		},
+	})
+	assert.Nil(err)
+	assert.NotEmpty(task.ID())
+	assert.Equal(defaultConcurrency, task.opt.Concurrency)
+
+	req, err := task.newRequest("/users/me?type=1")
+	assert.Nil(err)
+	assert.Equal("http://127.0.0.1:3015/users/me?type=1", req.URL.String())
+	assert.Equal("test.com", req.Host)
+
+	req, err = task.newRequest("https://pike.com/users/me")
+	assert.Nil(err)
+	assert.Equal("http://127.0.0.1:3015/users/me", req.URL.String())
+	assert.Equal("pike.com", req.Host)
+}
+
+func TestTaskRun(t *testing.T) {
+	assert := assert.New(t)
+	ts := newTestServer()
+	defer ts.Close()
+
+	task, err := NewTask(Option{
+		Addr: strings.TrimPrefix(ts.URL, "http://"),
+		URLs: []string{
+			"http://test.com/",
+			"/error",
+			"/users/me",
+		},
+		Concurrency: 2,
+		Rate:        20,
+	})
+	assert.Nil(err)
+	mu := sync.Mutex{}
+	results := make(map[string]Result)
+	startedAt := time.Now()
+	task.Run(func(result Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[result.URL] = result
+	})
+	// 每秒20个请求，3个请求至少需要100ms
+	assert.True(time.Since(startedAt) >= 100*time.Millisecond)
+	assert.Equal(3, len(results))
+	assert.Equal(http.StatusOK, results["http://test.com/"].Status)
+	assert.Equal("fetching", results["http://test.com/"].CacheStatus)
+	assert.Equal(http.StatusInternalServerError, results["/error"].Status)
+
+	progress := task.GetProgress(true)
+	assert.True(progress.Finished)
+	assert.Equal(3, progress.Total)
+	assert.Equal(3, progress.Done)
+	assert.Equal(1, progress.Failed)
+	assert.Equal(3, len(progress.Results))
+	assert.Nil(task.GetProgress(false).Results)
+}
+
+func TestTasks(t *testing.T) {
+	assert := assert.New(t)
+	ts := newTestServer()
+	defer ts.Close()
+
+	task, err := Start(Option{
+		Addr: strings.TrimPrefix(ts.URL, "http://"),
+		URLs: []string{
+			"/",
+		},
+	})
+	assert.Nil(err)
+	assert.Equal(task, Get(task.ID()))
+	assert.Equal(1, len(List()))
+
+	// 超过数量限制时删除最早完成的任务
+	ts1 := &tasks{
+		mu: &sync.RWMutex{},
+		m:  make(map[string]*Task),
+	}
+	var first *Task
+	for i := 0; i <= maxTaskCount; i++ {
+		item, _ := NewTask(Option{
+			URLs: []string{
+				"/",
+			},
+		})
+		item.id = strings.Repeat("a", i+1)
+		item.createdAt = time.Now().Add(time.Duration(i) * time.Second)
+		item.finishedAt = time.Now()
+		if first == nil {
+			first = item
+		}
+		assert.Nil(ts1.add(item))
+	}
+	assert.Equal(maxTaskCount, len(ts1.list()))
+	assert.Nil(ts1.get(first.ID()))
+
+	// 限制同时执行的任务数量
+	ts2 := &tasks{
+		mu: &sync.RWMutex{},
+		m:  make(map[string]*Task),
+	}
+	for i := 0; i <= maxRunningTaskCount; i++ {
+		item, _ := NewTask(Option{
+			URLs: []string{
+				"/",
+			},
+		})
+		item.id = strings.Repeat("b", i+1)
+		err = ts2.add(item)
+		if i < maxRunningTaskCount {
+			assert.Nil(err)
+		} else {
+			assert.Equal(ErrTooManyTasks, err)
+		}
+	}
+	assert.Equal(maxRunningTaskCount, len(ts2.list()))
+}